@@ -0,0 +1,283 @@
+// Package cache defined read-through loader
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+
+	drand "github.com/dup2X/gopkg/rand"
+	"github.com/dup2X/gopkg/redis"
+	"github.com/golang/groupcache/singleflight"
+)
+
+const (
+	defaultLoaderTTL   = time.Minute * 5
+	defaultNegativeTTL = time.Second * 5
+
+	// entry 头部: 1 字节标记 + 8 字节刷新时间 + 8 字节过期时间
+	entryHeaderSize = 17
+	entryValue      = 0
+	entryNegative   = 1
+)
+
+var (
+	// ErrNotFound 回源数据不存在，LoadFunc 返回该错误时结果按 negativeTTL 缓存
+	ErrNotFound = errors.New("cache: not found")
+
+	errBadEntry = errors.New("cache: bad entry")
+)
+
+// LoadFunc 缓存未命中时的回源函数，数据不存在时返回 ErrNotFound
+type LoadFunc func(ctx context.Context, key string) ([]byte, error)
+
+// LoaderOption loader 的可选参数
+type LoaderOption func(o *loaderOption)
+
+type loaderOption struct {
+	ttl          time.Duration
+	negativeTTL  time.Duration
+	refreshAhead time.Duration
+	local        Cacher
+	localTTL     time.Duration
+}
+
+// WithTTL 数据在 redis 中的过期时间，默认 5 分钟
+func WithTTL(ttl time.Duration) LoaderOption {
+	return func(o *loaderOption) {
+		o.ttl = ttl
+	}
+}
+
+// WithNegativeTTL 数据不存在时的缓存时间，默认 5 秒，为 0 时不缓存
+func WithNegativeTTL(ttl time.Duration) LoaderOption {
+	return func(o *loaderOption) {
+		o.negativeTTL = ttl
+	}
+}
+
+// WithRefreshAhead 在过期前 d 内随机选一个时间点后台刷新，默认为 ttl 的 1/5，为 0 时不提前刷新
+func WithRefreshAhead(d time.Duration) LoaderOption {
+	return func(o *loaderOption) {
+		o.refreshAhead = d
+	}
+}
+
+// WithLocal 在 redis 前加一层本地缓存，本地数据最多保留 ttl
+func WithLocal(c Cacher, ttl time.Duration) LoaderOption {
+	return func(o *loaderOption) {
+		o.local = c
+		o.localTTL = ttl
+	}
+}
+
+// Loader read-through 缓存，依次读取本地缓存、redis 和回源函数
+// 同一个 key 的并发回源合并为一次，redis 读写失败时直接回源
+type Loader struct {
+	m     *redis.Manager
+	opt   *loaderOption
+	group singleflight.Group
+	rnd   *rand.Rand
+
+	mu         sync.Mutex
+	refreshing map[string]struct{}
+}
+
+// NewLoader 返回使用 m 作为二级缓存的 Loader
+func NewLoader(m *redis.Manager, opts ...LoaderOption) *Loader {
+	opt := &loaderOption{
+		ttl:          defaultLoaderTTL,
+		negativeTTL:  defaultNegativeTTL,
+		refreshAhead: -1,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.refreshAhead < 0 {
+		opt.refreshAhead = opt.ttl / 5
+	}
+	if opt.refreshAhead > opt.ttl {
+		opt.refreshAhead = opt.ttl
+	}
+	return &Loader{
+		m:          m,
+		opt:        opt,
+		rnd:        drand.NewSeeded(),
+		refreshing: make(map[string]struct{}),
+	}
+}
+
+// entry 缓存中保存的数据
+type entry struct {
+	negative  bool
+	refreshAt time.Time
+	expireAt  time.Time
+	val       []byte
+}
+
+func (e *entry) encode() []byte {
+	buf := make([]byte, entryHeaderSize+len(e.val))
+	if e.negative {
+		buf[0] = entryNegative
+	}
+	binary.BigEndian.PutUint64(buf[1:], uint64(e.refreshAt.UnixNano()))
+	binary.BigEndian.PutUint64(buf[9:], uint64(e.expireAt.UnixNano()))
+	copy(buf[entryHeaderSize:], e.val)
+	return buf
+}
+
+func decodeEntry(buf []byte) (*entry, error) {
+	if len(buf) < entryHeaderSize || buf[0] > entryNegative {
+		return nil, errBadEntry
+	}
+	return &entry{
+		negative:  buf[0] == entryNegative,
+		refreshAt: time.Unix(0, int64(binary.BigEndian.Uint64(buf[1:]))),
+		expireAt:  time.Unix(0, int64(binary.BigEndian.Uint64(buf[9:]))),
+		val:       buf[entryHeaderSize:],
+	}, nil
+}
+
+func (e *entry) result() ([]byte, error) {
+	if e.negative {
+		return nil, ErrNotFound
+	}
+	return e.val, nil
+}
+
+// Get 读取 key，未命中时调用 load 回源并写入缓存
+func (l *Loader) Get(ctx context.Context, key string, load LoadFunc) ([]byte, error) {
+	now := time.Now()
+	if e := l.getLocal(key, now); e != nil {
+		return e.result()
+	}
+	if e := l.getRemote(ctx, key); e != nil {
+		l.setLocal(key, e, now)
+		if !now.Before(e.refreshAt) {
+			l.refresh(key, load)
+		}
+		return e.result()
+	}
+	v, err := l.group.Do(key, func() (interface{}, error) {
+		return l.load(ctx, key, load)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*entry).result()
+}
+
+// Del 删除本地和 redis 中的 key，数据更新后调用
+func (l *Loader) Del(ctx context.Context, key string) error {
+	if l.opt.local != nil {
+		l.opt.local.Del([]byte(key))
+	}
+	_, err := l.m.Del(ctx, key)
+	return err
+}
+
+// load 回源并写入缓存，ErrNotFound 之外的错误不缓存
+func (l *Loader) load(ctx context.Context, key string, load LoadFunc) (*entry, error) {
+	val, err := load(ctx, key)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	now := time.Now()
+	e := &entry{negative: err == ErrNotFound, val: val}
+	ttl := l.opt.ttl
+	if e.negative {
+		ttl = l.opt.negativeTTL
+	}
+	e.expireAt = now.Add(ttl)
+	e.refreshAt = e.expireAt
+	if !e.negative && l.opt.refreshAhead > 0 {
+		e.refreshAt = e.expireAt.Add(-l.jitter(l.opt.refreshAhead))
+	}
+	if ttl > 0 {
+		l.m.SetEx(ctx, key, ttlSeconds(ttl), e.encode())
+		l.setLocal(key, e, now)
+	}
+	return e, nil
+}
+
+// refresh 后台刷新 key，同一个 key 同时只有一个刷新任务
+func (l *Loader) refresh(key string, load LoadFunc) {
+	l.mu.Lock()
+	if _, ok := l.refreshing[key]; ok {
+		l.mu.Unlock()
+		return
+	}
+	l.refreshing[key] = struct{}{}
+	l.mu.Unlock()
+	go func() {
+		defer func() {
+			l.mu.Lock()
+			delete(l.refreshing, key)
+			l.mu.Unlock()
+		}()
+		l.group.Do(key, func() (interface{}, error) {
+			return l.load(context.Background(), key, load)
+		})
+	}()
+}
+
+func (l *Loader) getRemote(ctx context.Context, key string) *entry {
+	buf, err := redis.Bytes(l.m.Get(ctx, key))
+	if err != nil {
+		return nil
+	}
+	e, err := decodeEntry(buf)
+	if err != nil {
+		return nil
+	}
+	return e
+}
+
+func (l *Loader) getLocal(key string, now time.Time) *entry {
+	if l.opt.local == nil {
+		return nil
+	}
+	buf := l.opt.local.Get([]byte(key))
+	if buf == nil {
+		return nil
+	}
+	e, err := decodeEntry(buf)
+	if err != nil || !now.Before(e.expireAt) {
+		l.opt.local.Del([]byte(key))
+		return nil
+	}
+	return e
+}
+
+// setLocal 本地数据的过期时间不超过 localTTL，也不晚于 redis 中的数据
+func (l *Loader) setLocal(key string, e *entry, now time.Time) {
+	if l.opt.local == nil || l.opt.localTTL <= 0 {
+		return
+	}
+	local := *e
+	if exp := now.Add(l.opt.localTTL); exp.Before(local.expireAt) {
+		local.expireAt = exp
+	}
+	l.opt.local.Set([]byte(key), local.encode())
+}
+
+// jitter 返回 (d/2, d] 内的随机时长
+func (l *Loader) jitter(d time.Duration) time.Duration {
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + 1 + l.rnd.Int63n(int64(d)-half))
+}
+
+// ttlSeconds SETEX 的过期时间按秒向上取整
+func ttlSeconds(d time.Duration) int {
+	sec := int((d + time.Second - 1) / time.Second)
+	if sec < 1 {
+		sec = 1
+	}
+	return sec
+}
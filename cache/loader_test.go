@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/redis"
+	"github.com/dup2X/gopkg/redis/redistest"
+)
+
+func newTestLoader(t *testing.T, opts ...LoaderOption) (*redistest.Server, *Loader) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	mgr, err := redis.NewManager([]string{srv.Addr()}, "", redis.SetPoolSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mgr.Close() })
+	return srv, NewLoader(mgr, opts...)
+}
+
+func TestLoaderSingleflight(t *testing.T) {
+	_, l := newTestLoader(t)
+	var calls int32
+	load := func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond * 50)
+		return []byte("v:" + key), nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := l.Get(context.Background(), "k", load)
+			if err != nil || string(v) != "v:k" {
+				t.Error(string(v), err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatal(calls)
+	}
+	// 命中 redis，不再回源
+	if v, err := l.Get(context.Background(), "k", load); err != nil || string(v) != "v:k" || calls != 1 {
+		t.Fatal(string(v), err, calls)
+	}
+}
+
+func TestLoaderNegative(t *testing.T) {
+	srv, l := newTestLoader(t, WithNegativeTTL(time.Second))
+	ctx := context.Background()
+	var calls int32
+	load := func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, ErrNotFound
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := l.Get(ctx, "missing", load); err != ErrNotFound {
+			t.Fatal(err)
+		}
+	}
+	if calls != 1 {
+		t.Fatal(calls)
+	}
+	srv.FastForward(time.Second * 2)
+	l.Get(ctx, "missing", load)
+	if calls != 2 {
+		t.Fatal(calls)
+	}
+
+	// 其他错误不缓存
+	errLoad := errors.New("db down")
+	fail := func(ctx context.Context, key string) ([]byte, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errLoad
+	}
+	l.Get(ctx, "fail", fail)
+	if _, err := l.Get(ctx, "fail", fail); err != errLoad || calls != 4 {
+		t.Fatal(err, calls)
+	}
+}
+
+func TestLoaderRefreshAhead(t *testing.T) {
+	_, l := newTestLoader(t, WithTTL(time.Minute), WithRefreshAhead(time.Minute))
+	ctx := context.Background()
+	var ver int32
+	load := func(ctx context.Context, key string) ([]byte, error) {
+		if atomic.AddInt32(&ver, 1) == 1 {
+			return []byte("v1"), nil
+		}
+		return []byte("v2"), nil
+	}
+	if v, _ := l.Get(ctx, "k", load); string(v) != "v1" {
+		t.Fatal(string(v))
+	}
+	// 改写刷新时间，模拟进入提前刷新的窗口
+	e := l.getRemote(ctx, "k")
+	e.refreshAt = time.Now().Add(-time.Second)
+	l.m.SetEx(ctx, "k", 60, e.encode())
+
+	// 刷新期间返回旧值
+	if v, _ := l.Get(ctx, "k", load); string(v) != "v1" {
+		t.Fatal(string(v))
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if v, _ := l.Get(ctx, "k", load); string(v) == "v2" {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("not refreshed")
+}
+
+func TestLoaderLocal(t *testing.T) {
+	srv, l := newTestLoader(t, WithLocal(NewLocal(), time.Minute))
+	ctx := context.Background()
+	load := func(ctx context.Context, key string) ([]byte, error) {
+		return []byte("v"), nil
+	}
+	l.Get(ctx, "k", load)
+	gets := srv.Calls("GET")
+	if v, err := l.Get(ctx, "k", load); err != nil || string(v) != "v" {
+		t.Fatal(string(v), err)
+	}
+	if srv.Calls("GET") != gets {
+		t.Fatal("expect local hit")
+	}
+	if err := l.Del(ctx, "k"); err != nil {
+		t.Fatal(err)
+	}
+	if l.getLocal("k", time.Now()) != nil || l.getRemote(ctx, "k") != nil {
+		t.Fatal("not deleted")
+	}
+}
+
+func TestLoaderJitter(t *testing.T) {
+	l := NewLoader(nil)
+	for i := 0; i < 100; i++ {
+		if d := l.jitter(time.Second); d <= time.Second/2 || d > time.Second {
+			t.Fatal(d)
+		}
+	}
+	if ttlSeconds(time.Millisecond) != 1 || ttlSeconds(time.Millisecond*1500) != 2 {
+		t.Fatal("bad ttl")
+	}
+}
@@ -20,6 +20,14 @@ const (
 	LOCALTYPE = iota
 )
 
+// vote type
+const (
+	// VoteHealthy 节点恢复，重新参与负载均衡
+	VoteHealthy = iota
+	// VoteUnhealthy 节点故障，Get 时跳过该节点
+	VoteUnhealthy
+)
+
 //Balancer represents load balancing for downstream
 type Balancer interface {
 	Start(namespace string) error
@@ -78,6 +86,7 @@ var (
 	errNotFoundHostByDisf    = fmt.Errorf("disf not return any host")
 	errNotFoundHostByNodemgr = fmt.Errorf("nodemgr not return any host")
 	errBalancerType          = fmt.Errorf("invalid balacer type")
+	errVoteType              = fmt.Errorf("invalid vote type")
 )
 
 func newServerList(addrs []string) *serverList {
@@ -148,6 +157,20 @@ func (sl *serverList) GetHostPort() (addr string, port int, err error) {
 }
 
 func (sl *serverList) Vote(addr string, voteType int) error {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if _, ok := sl.state[addr]; !ok {
+		return nil
+	}
+	switch voteType {
+	case VoteHealthy:
+		sl.state[addr] = true
+	case VoteUnhealthy:
+		sl.state[addr] = false
+	default:
+		return errVoteType
+	}
 	return nil
 }
 
@@ -3,94 +3,30 @@ package dmysql
 
 import (
 	"bytes"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
-// Cond ...
-type Cond struct {
-	op    command
-	field string
-	val   interface{}
-}
+const maxIdentLen = 64
 
-func gen(conds []*Cond, orderBy, groupBy string, exp bool) (sqlPattern string, args []interface{}) {
-	if len(conds) == 0 {
-		return
-	}
-	bf := &bytes.Buffer{}
-	bf.WriteString("WHERE")
-	for i, cond := range conds {
-		switch cond.op {
-		case commandEQ:
-			bf.WriteString(" `" + cond.field + "` = ?")
-			args = append(args, cond.val)
-		case commandNE:
-			bf.WriteString(" `" + cond.field + "` != ?")
-			args = append(args, cond.val)
-		case commandGT:
-			bf.WriteString(" `" + cond.field + "` > ?")
-			args = append(args, cond.val)
-		case commandGTE:
-			bf.WriteString(" `" + cond.field + "` >= ?")
-			args = append(args, cond.val)
-		case commandLT:
-			bf.WriteString(" `" + cond.field + "` < ?")
-			args = append(args, cond.val)
-		case commandLTE:
-			bf.WriteString(" `" + cond.field + "` <= ?")
-			args = append(args, cond.val)
-		case commandLIKE:
-			bf.WriteString(" `" + cond.field + "` LIKE " + fmt.Sprint(cond.val))
-		case commandNLIKE:
-			bf.WriteString(" `" + cond.field + "` NOT LIKE " + fmt.Sprint(cond.val))
-		case commandIN:
-			vals, ok := cond.val.([]interface{})
-			if ok {
-				bf.WriteString(" `" + cond.field + "` IN (")
-				if len(vals) > 1 {
-					bf.WriteString(strings.Repeat("?,", len(vals)-1))
-				}
-				bf.WriteString("?)")
-				args = append(args, vals...)
-			} else {
-				bf.WriteString(" `" + cond.field + "` IN " + fmt.Sprintln(cond.val))
-			}
-		case commandNIN:
-			vals, ok := cond.val.([]interface{})
-			if ok {
-				bf.WriteString(" `" + cond.field + "` NOT IN (")
-				if len(vals) > 1 {
-					bf.WriteString(strings.Repeat("?,", len(vals)-1))
-				}
-				bf.WriteString("?)")
-				args = append(args, vals...)
-			} else {
-				bf.WriteString(" `" + cond.field + "` NOT IN " + fmt.Sprintln(cond.val))
-			}
-		}
-		if i != len(conds)-1 {
-			if exp {
-				bf.WriteString(" AND")
-			} else {
-				bf.WriteString(" OR")
-			}
-		}
-	}
-	if orderBy != "" {
-		if strings.HasPrefix(orderBy, "-") {
-			bf.WriteString(" ORDER BY `" + string([]byte(orderBy)[1:]) + "` DESC")
-		} else if strings.HasPrefix(orderBy, "+") {
-			bf.WriteString(" ORDER BY `" + string([]byte(orderBy)[1:]) + "`")
-		} else {
-			bf.WriteString(" ORDER BY `" + orderBy + "`")
-		}
-	}
-	if groupBy != "" {
-		bf.WriteString(" GROUP BY `" + groupBy + "`")
-	}
-	sqlPattern = bf.String()
-	return
+var (
+	// ErrInvalidIdentifier 表名或列名不合法
+	ErrInvalidIdentifier = errors.New("invalid identifier")
+
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	likeEscape = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+)
+
+// Cond 条件树的一个节点，叶子节点是单个字段的比较，And/Or/Not 组合子节点
+type Cond struct {
+	op       command
+	field    string
+	val      interface{}
+	children []*Cond
 }
 
 type command uint8
@@ -106,44 +42,432 @@ const (
 	commandNIN
 	commandLIKE
 	commandNLIKE
+	commandBETWEEN
+	commandNBETWEEN
+	commandISNULL
+	commandNOTNULL
+	commandEXPR
+	commandAND
+	commandOR
+	commandNOT
 )
 
+var compareOps = map[command]string{
+	commandEQ:  "=",
+	commandNE:  "!=",
+	commandGT:  ">",
+	commandGTE: ">=",
+	commandLT:  "<",
+	commandLTE: "<=",
+}
+
 // Eq ...
-func Eq(field string, val interface{}) *Cond { return &Cond{commandEQ, field, val} }
+func Eq(field string, val interface{}) *Cond { return &Cond{op: commandEQ, field: field, val: val} }
 
 // NotEq ...
-func NotEq(field string, val interface{}) *Cond { return &Cond{commandNE, field, val} }
+func NotEq(field string, val interface{}) *Cond { return &Cond{op: commandNE, field: field, val: val} }
 
 // Gt ...
-func Gt(field string, val interface{}) *Cond { return &Cond{commandGT, field, val} }
+func Gt(field string, val interface{}) *Cond { return &Cond{op: commandGT, field: field, val: val} }
 
 // Gte ...
-func Gte(field string, val interface{}) *Cond { return &Cond{commandGTE, field, val} }
+func Gte(field string, val interface{}) *Cond { return &Cond{op: commandGTE, field: field, val: val} }
 
 // Lt ...
-func Lt(field string, val interface{}) *Cond { return &Cond{commandLT, field, val} }
+func Lt(field string, val interface{}) *Cond { return &Cond{op: commandLT, field: field, val: val} }
 
 // Lte ...
-func Lte(field string, val interface{}) *Cond { return &Cond{commandLTE, field, val} }
+func Lte(field string, val interface{}) *Cond { return &Cond{op: commandLTE, field: field, val: val} }
 
-// In ...
-func In(field string, val interface{}) *Cond { return &Cond{commandIN, field, val} }
+// In field IN (val...)，val 可以是任意类型的 slice 或 array，空列表为恒假条件
+// 子查询需要使用 Expr，例如 Expr("`id` IN (SELECT `uid` FROM `t` WHERE `state` = ?)", 1)
+func In(field string, val interface{}) *Cond { return &Cond{op: commandIN, field: field, val: val} }
 
-// NotIn ...
-func NotIn(field string, val interface{}) *Cond { return &Cond{commandNIN, field, val} }
+// NotIn field NOT IN (val...)，空列表为恒真条件
+func NotIn(field string, val interface{}) *Cond { return &Cond{op: commandNIN, field: field, val: val} }
 
-// Like ...
-func Like(field string, val interface{}) *Cond { return &Cond{commandLIKE, field, val} }
+// Like field LIKE val，val 作为参数绑定，用户输入需要先经过 EscapeLike
+func Like(field string, val interface{}) *Cond { return &Cond{op: commandLIKE, field: field, val: val} }
 
-// NotLike ...
-func NotLike(field string, val interface{}) *Cond { return &Cond{commandNLIKE, field, val} }
+// NotLike field NOT LIKE val
+func NotLike(field string, val interface{}) *Cond {
+	return &Cond{op: commandNLIKE, field: field, val: val}
+}
 
-// Or ...
-func Or(conds []*Cond, orderBy, groupBy string) (sqlPattern string, args []interface{}) {
-	return gen(conds, orderBy, groupBy, false)
+// Between field BETWEEN lo AND hi
+func Between(field string, lo, hi interface{}) *Cond {
+	return &Cond{op: commandBETWEEN, field: field, val: []interface{}{lo, hi}}
 }
 
-// And ...
+// NotBetween field NOT BETWEEN lo AND hi
+func NotBetween(field string, lo, hi interface{}) *Cond {
+	return &Cond{op: commandNBETWEEN, field: field, val: []interface{}{lo, hi}}
+}
+
+// IsNull field IS NULL
+func IsNull(field string) *Cond { return &Cond{op: commandISNULL, field: field} }
+
+// IsNotNull field IS NOT NULL
+func IsNotNull(field string) *Cond { return &Cond{op: commandNOTNULL, field: field} }
+
+// Expr 原样输出的 sql 片段，参数使用 ? 占位，例如 Expr("`a` + `b` > ?", 10)
+func Expr(sqlPattern string, args ...interface{}) *Cond {
+	return &Cond{op: commandEXPR, field: sqlPattern, val: args}
+}
+
+// All 用 AND 连接所有条件，nil 条件被忽略
+func All(conds ...*Cond) *Cond { return &Cond{op: commandAND, children: conds} }
+
+// Any 用 OR 连接所有条件，nil 条件被忽略
+func Any(conds ...*Cond) *Cond { return &Cond{op: commandOR, children: conds} }
+
+// And 生成用 AND 连接的 WHERE 条件，orderBy、groupBy 可以为空
+// 条件的值全部通过 ? 绑定，Like 的值不再需要自带引号
+// 列名不合法时返回恒假条件，args 中带有构造错误，传给 MySQL 执行时返回该错误并通过 WithLogger 记录
+//
+// Deprecated: 使用 Where(All(...)).OrderBy(...).GroupBy(...).Build()
 func And(conds []*Cond, orderBy, groupBy string) (sqlPattern string, args []interface{}) {
-	return gen(conds, orderBy, groupBy, true)
+	return legacyWhere(All(conds...), len(conds), orderBy, groupBy)
+}
+
+// Or 生成用 OR 连接的 WHERE 条件，orderBy、groupBy 可以为空
+//
+// Deprecated: 使用 Where(Any(...)).OrderBy(...).GroupBy(...).Build()
+func Or(conds []*Cond, orderBy, groupBy string) (sqlPattern string, args []interface{}) {
+	return legacyWhere(Any(conds...), len(conds), orderBy, groupBy)
+}
+
+func legacyWhere(cond *Cond, n int, orderBy, groupBy string) (string, []interface{}) {
+	if n == 0 {
+		return "", nil
+	}
+	cl := Where(cond)
+	if groupBy != "" {
+		cl.GroupBy(groupBy)
+	}
+	if orderBy != "" {
+		cl.OrderBy(orderBy)
+	}
+	sqlPattern, args, err := cl.Build()
+	if err != nil {
+		// 没有返回错误的途径，不能退化为无条件，避免 Update/Delete 作用于全表
+		// 错误放在参数中，由 MySQL 执行前检查并返回
+		return "WHERE 1 = 0", []interface{}{condError{err}}
+	}
+	return sqlPattern, args
+}
+
+// condError And/Or 构造条件失败时放在返回的参数中
+// 没有实现 driver.Valuer，绕过 MySQL 直接交给 database/sql 执行也会失败
+type condError struct {
+	err error
+}
+
+// checkCondArgs 返回 args 中 And/Or 的构造错误
+func checkCondArgs(args []interface{}) error {
+	for _, arg := range args {
+		if e, ok := arg.(condError); ok {
+			return e.err
+		}
+	}
+	return nil
+}
+
+// Not 对条件取反
+func Not(cond *Cond) *Cond { return &Cond{op: commandNOT, children: []*Cond{cond}} }
+
+// Build 返回不带 WHERE 的条件表达式和参数，空条件返回空串
+func (c *Cond) Build() (sqlPattern string, args []interface{}, err error) {
+	bf := &bytes.Buffer{}
+	if args, err = c.build(bf, nil); err != nil {
+		return "", nil, err
+	}
+	return bf.String(), args, nil
+}
+
+func (c *Cond) empty() bool {
+	if c == nil {
+		return true
+	}
+	switch c.op {
+	case commandAND, commandOR, commandNOT:
+		for _, child := range c.children {
+			if !child.empty() {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func (c *Cond) build(bf *bytes.Buffer, args []interface{}) ([]interface{}, error) {
+	if c.empty() {
+		return args, nil
+	}
+	switch c.op {
+	case commandAND, commandOR:
+		return c.buildChildren(bf, args)
+	case commandNOT:
+		bf.WriteString("NOT (")
+		args, err := c.children[0].build(bf, args)
+		bf.WriteString(")")
+		return args, err
+	case commandEXPR:
+		bf.WriteString(c.field)
+		return append(args, c.val.([]interface{})...), nil
+	}
+	field, err := quoteIdent(c.field)
+	if err != nil {
+		return nil, err
+	}
+	switch c.op {
+	case commandISNULL:
+		bf.WriteString(field + " IS NULL")
+	case commandNOTNULL:
+		bf.WriteString(field + " IS NOT NULL")
+	case commandBETWEEN:
+		bf.WriteString(field + " BETWEEN ? AND ?")
+		args = append(args, c.val.([]interface{})...)
+	case commandNBETWEEN:
+		bf.WriteString(field + " NOT BETWEEN ? AND ?")
+		args = append(args, c.val.([]interface{})...)
+	case commandLIKE:
+		bf.WriteString(field + " LIKE ?")
+		args = append(args, c.val)
+	case commandNLIKE:
+		bf.WriteString(field + " NOT LIKE ?")
+		args = append(args, c.val)
+	case commandIN, commandNIN:
+		vals := listValues(c.val)
+		if len(vals) == 0 {
+			// IN () 不是合法的 sql，空列表直接输出恒假/恒真条件
+			if c.op == commandIN {
+				bf.WriteString("1 = 0")
+			} else {
+				bf.WriteString("1 = 1")
+			}
+			return args, nil
+		}
+		bf.WriteString(field)
+		if c.op == commandNIN {
+			bf.WriteString(" NOT")
+		}
+		bf.WriteString(" IN (" + strings.Repeat("?,", len(vals)-1) + "?)")
+		args = append(args, vals...)
+	default:
+		bf.WriteString(field + " " + compareOps[c.op] + " ?")
+		args = append(args, c.val)
+	}
+	return args, nil
+}
+
+func (c *Cond) buildChildren(bf *bytes.Buffer, args []interface{}) ([]interface{}, error) {
+	sep := " AND "
+	if c.op == commandOR {
+		sep = " OR "
+	}
+	children := make([]*Cond, 0, len(c.children))
+	for _, child := range c.children {
+		if !child.empty() {
+			children = append(children, child)
+		}
+	}
+	var err error
+	for i, child := range children {
+		if i > 0 {
+			bf.WriteString(sep)
+		}
+		// 只有一个子条件时不需要括号
+		paren := len(children) > 1 && child.compound()
+		if paren {
+			bf.WriteString("(")
+		}
+		if args, err = child.build(bf, args); err != nil {
+			return nil, err
+		}
+		if paren {
+			bf.WriteString(")")
+		}
+	}
+	return args, nil
+}
+
+// listValues 将 slice 或 array 展开为参数列表，[]byte 和 driver.Valuer 作为单个值
+func listValues(val interface{}) []interface{} {
+	if vals, ok := val.([]interface{}); ok {
+		return vals
+	}
+	rv := reflect.ValueOf(val)
+	if !rv.IsValid() {
+		return []interface{}{nil}
+	}
+	if rv.Type().Implements(valuerType) {
+		return []interface{}{val}
+	}
+	switch rv.Kind() {
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return []interface{}{val}
+		}
+	case reflect.Array:
+	default:
+		return []interface{}{val}
+	}
+	vals := make([]interface{}, rv.Len())
+	for i := range vals {
+		vals[i] = rv.Index(i).Interface()
+	}
+	return vals
+}
+
+// EscapeLike 转义 LIKE 中的通配符，用于拼接用户输入，例如 Like("name", "%"+EscapeLike(input)+"%")
+func EscapeLike(s string) string {
+	return likeEscape.Replace(s)
+}
+
+// quoteIdent 校验并转义标识符，支持 db.table.column 形式，每一段都用反引号包裹
+func quoteIdent(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidIdentifier, name)
+	}
+	for i, p := range parts {
+		if p == "" || len(p) > maxIdentLen || strings.IndexByte(p, 0) >= 0 || strings.TrimSpace(p) != p {
+			return "", fmt.Errorf("%w: %q", ErrInvalidIdentifier, name)
+		}
+		parts[i] = "`" + strings.Replace(p, "`", "``", -1) + "`"
+	}
+	return strings.Join(parts, "."), nil
+}
+
+func quoteIdents(names []string) (string, error) {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		q, err := quoteIdent(name)
+		if err != nil {
+			return "", err
+		}
+		quoted[i] = q
+	}
+	return strings.Join(quoted, ","), nil
+}
+
+// compound And/Or 作为子条件时需要加括号
+func (c *Cond) compound() bool {
+	if c.op == commandEXPR {
+		return true
+	}
+	if c.op != commandAND && c.op != commandOR {
+		return false
+	}
+	n := 0
+	for _, child := range c.children {
+		if !child.empty() {
+			n++
+		}
+	}
+	return n > 1
+}
+
+// Clause WHERE 以及 GROUP BY、HAVING、ORDER BY、LIMIT 子句
+type Clause struct {
+	where   *Cond
+	groupBy []string
+	having  *Cond
+	orderBy []string
+	limit   int64
+	offset  int64
+}
+
+// Where 返回以 cond 为条件的子句，cond 可以为 nil
+func Where(cond *Cond) *Clause {
+	return &Clause{where: cond}
+}
+
+// GroupBy 分组字段
+func (cl *Clause) GroupBy(fields ...string) *Clause {
+	cl.groupBy = append(cl.groupBy, fields...)
+	return cl
+}
+
+// Having 分组后的过滤条件
+func (cl *Clause) Having(cond *Cond) *Clause {
+	cl.having = cond
+	return cl
+}
+
+// OrderBy 排序字段，"-id" 表示降序，"id" 或 "+id" 表示升序
+func (cl *Clause) OrderBy(fields ...string) *Clause {
+	cl.orderBy = append(cl.orderBy, fields...)
+	return cl
+}
+
+// Limit 最多返回 n 行
+func (cl *Clause) Limit(n int64) *Clause {
+	cl.limit = n
+	return cl
+}
+
+// Offset 跳过前 n 行
+func (cl *Clause) Offset(n int64) *Clause {
+	cl.offset = n
+	return cl
+}
+
+// Build 返回以 WHERE 开头的子句和参数，可以直接传给 Select、Update 和 Delete
+func (cl *Clause) Build() (sqlPattern string, args []interface{}, err error) {
+	var parts []string
+	if !cl.where.empty() {
+		bf := bytes.NewBufferString("WHERE ")
+		if args, err = cl.where.build(bf, args); err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, bf.String())
+	}
+	if len(cl.groupBy) > 0 {
+		fields, err := quoteIdents(cl.groupBy)
+		if err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, "GROUP BY "+fields)
+	}
+	if !cl.having.empty() {
+		bf := bytes.NewBufferString("HAVING ")
+		if args, err = cl.having.build(bf, args); err != nil {
+			return "", nil, err
+		}
+		parts = append(parts, bf.String())
+	}
+	if len(cl.orderBy) > 0 {
+		orders := make([]string, len(cl.orderBy))
+		for i, field := range cl.orderBy {
+			desc := strings.HasPrefix(field, "-")
+			if desc || strings.HasPrefix(field, "+") {
+				field = field[1:]
+			}
+			if orders[i], err = quoteIdent(field); err != nil {
+				return "", nil, err
+			}
+			if desc {
+				orders[i] += " DESC"
+			}
+		}
+		parts = append(parts, "ORDER BY "+strings.Join(orders, ","))
+	}
+	if cl.limit > 0 {
+		parts = append(parts, "LIMIT "+strconv.FormatInt(cl.limit, 10))
+	}
+	if cl.offset > 0 {
+		if cl.limit <= 0 {
+			// mysql 的 OFFSET 必须跟在 LIMIT 之后
+			parts = append(parts, "LIMIT 18446744073709551615")
+		}
+		parts = append(parts, "OFFSET "+strconv.FormatInt(cl.offset, 10))
+	}
+	return strings.Join(parts, " "), args, nil
+}
+
+func (cl *Clause) hasWhere() bool {
+	return cl != nil && !cl.where.empty()
 }
@@ -1,8 +1,15 @@
 package dmysql
 
 import (
+	"context"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/logger"
 )
 
 func TestCond(t *testing.T) {
@@ -15,23 +22,221 @@ func TestCond(t *testing.T) {
 		Gte("m", 92),
 		In("state", []interface{}{1, 2, 3}),
 		NotIn("type", []interface{}{101, 102}),
-		Like("atr", "'%xx'"),
-		NotLike("atr1", "'%xx%'"),
+		Like("atr", "%xx"),
+		NotLike("atr1", "%xx%"),
+	}
+	sql, args, err := All(conds...).Build()
+	exp := "`name` = ? AND `age` != ? AND `level` < ? AND `le` <= ? AND `l` > ? AND `m` >= ? AND " +
+		"`state` IN (?,?,?) AND `type` NOT IN (?,?) AND `atr` LIKE ? AND `atr1` NOT LIKE ?"
+	if err != nil || sql != exp {
+		t.Fatal(sql, err)
+	}
+	if !reflect.DeepEqual(args, []interface{}{"james", 1, 21, 2, 120, 92, 1, 2, 3, 101, 102, "%xx", "%xx%"}) {
+		t.Fatal(args)
+	}
+
+	sql, args, err = Any(conds[:2]...).Build()
+	if err != nil || sql != "`name` = ? OR `age` != ?" || len(args) != 2 {
+		t.Fatal(sql, args, err)
+	}
+}
+
+func TestCondNested(t *testing.T) {
+	cases := []struct {
+		cond *Cond
+		sql  string
+		args []interface{}
+	}{
+		{
+			All(Eq("a", 1), Any(Eq("b", 2), In("c", []interface{}{3, 4}))),
+			"`a` = ? AND (`b` = ? OR `c` IN (?,?))",
+			[]interface{}{1, 2, 3, 4},
+		},
+		{
+			Any(All(Eq("a", 1), Eq("b", 2)), Not(Any(IsNull("c"), Between("d", 1, 9)))),
+			"(`a` = ? AND `b` = ?) OR NOT (`c` IS NULL OR `d` BETWEEN ? AND ?)",
+			[]interface{}{1, 2, 1, 9},
+		},
+		{
+			All(nil, Any(Eq("a", 1)), All(), IsNotNull("b"), NotBetween("c", 1, 2)),
+			"`a` = ? AND `b` IS NOT NULL AND `c` NOT BETWEEN ? AND ?",
+			[]interface{}{1, 1, 2},
+		},
+		{
+			All(Eq("a", 1), Expr("`b` + `c` > ? OR `d` = ?", 2, 3)),
+			"`a` = ? AND (`b` + `c` > ? OR `d` = ?)",
+			[]interface{}{1, 2, 3},
+		},
+		{All(Any(), nil), "", nil},
+	}
+	for _, c := range cases {
+		sql, args, err := c.cond.Build()
+		if err != nil || sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Fatal(sql, args, err)
+		}
+	}
+}
+
+type testValuer []int
+
+func (v testValuer) Value() (driver.Value, error) { return "1,2", nil }
+
+func TestCondIn(t *testing.T) {
+	now := time.Now()
+	cases := []struct {
+		cond *Cond
+		sql  string
+		args []interface{}
+	}{
+		{In("id", []int64{1, 2}), "`id` IN (?,?)", []interface{}{int64(1), int64(2)}},
+		{In("name", [2]string{"a", "b"}), "`name` IN (?,?)", []interface{}{"a", "b"}},
+		{In("id", 3), "`id` IN (?)", []interface{}{3}},
+		{In("raw", []byte("ab")), "`raw` IN (?)", []interface{}{[]byte("ab")}},
+		{In("v", testValuer{1}), "`v` IN (?)", []interface{}{testValuer{1}}},
+		{In("ctime", []time.Time{now}), "`ctime` IN (?)", []interface{}{now}},
+		{In("gate", "(select gate from t)"), "`gate` IN (?)", []interface{}{"(select gate from t)"}},
+		{In("id", []int{}), "1 = 0", nil},
+		{NotIn("id", []string(nil)), "1 = 1", nil},
+		{All(Eq("a", 1), In("id", []uint16{})), "`a` = ? AND 1 = 0", []interface{}{1}},
+	}
+	for _, c := range cases {
+		sql, args, err := c.cond.Build()
+		if err != nil || sql != c.sql || !reflect.DeepEqual(args, c.args) {
+			t.Fatal(sql, args, err)
+		}
+	}
+}
+
+func TestQuoteIdent(t *testing.T) {
+	cases := []struct {
+		name, quoted string
+	}{
+		{"id", "`id`"},
+		{"t.id", "`t`.`id`"},
+		{"db.t.id", "`db`.`t`.`id`"},
+		{"a`b", "`a``b`"},
+		{"中文", "`中文`"},
+	}
+	for _, c := range cases {
+		if q, err := quoteIdent(c.name); err != nil || q != c.quoted {
+			t.Fatal(q, err)
+		}
+	}
+	for _, name := range []string{"", "a..b", "a.b.c.d", " id", "a\x00", string(make([]byte, 65))} {
+		if _, err := quoteIdent(name); !errors.Is(err, ErrInvalidIdentifier) {
+			t.Fatal(name, err)
+		}
+	}
+	if _, _, err := Where(Eq("a` = 1 OR `1", 1)).Build(); err != nil {
+		t.Fatal(err)
+	}
+	if sql, _, _ := Eq("a` = 1 OR `1", 1).Build(); sql != "`a`` = 1 OR ``1` = ?" {
+		t.Fatal(sql)
+	}
+	if _, _, err := Where(nil).OrderBy("-").Build(); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatal(err)
+	}
+	if _, err := wrapTable("a.b.c"); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatal(err)
+	}
+	if _, err := (&MySQL{}).Insert(context.Background(), "t", map[string]interface{}{"": 1}); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatal(err)
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if s := EscapeLike(`50%_a\b`); s != `50\%\_a\\b` {
+		t.Fatal(s)
+	}
+}
+
+func TestClause(t *testing.T) {
+	sql, args, err := Where(All(Eq("a", 1), Any(Eq("b", 2), Eq("c", 3)))).
+		GroupBy("type", "state").
+		Having(Gt("cnt", 10)).
+		OrderBy("-id", "+name", "t.age").
+		Limit(10).
+		Offset(20).
+		Build()
+	exp := "WHERE `a` = ? AND (`b` = ? OR `c` = ?) GROUP BY `type`,`state` HAVING `cnt` > ? " +
+		"ORDER BY `id` DESC,`name`,`t`.`age` LIMIT 10 OFFSET 20"
+	if err != nil || sql != exp || !reflect.DeepEqual(args, []interface{}{1, 2, 3, 10}) {
+		t.Fatal(sql, args, err)
+	}
+
+	if sql, args, _ = Where(nil).OrderBy("id").Build(); sql != "ORDER BY `id`" || args != nil {
+		t.Fatal(sql, args)
+	}
+	if sql, _, _ = Where(nil).Offset(5).Build(); sql != "LIMIT 18446744073709551615 OFFSET 5" {
+		t.Fatal(sql)
 	}
+	if Where(All()).hasWhere() || (*Clause)(nil).hasWhere() || !Where(Eq("a", 1)).hasWhere() {
+		t.Fatal("hasWhere")
+	}
+}
+
+func TestDeleteWhereEmpty(t *testing.T) {
+	m := &MySQL{}
+	if _, err := m.DeleteWhere(context.Background(), "t", Where(All()).Limit(1)); err != ErrEmptyCondition {
+		t.Fatal(err)
+	}
+	if _, err := m.UpdateWhere(context.Background(), "t", map[string]interface{}{"a": 1}, nil); err != ErrEmptyCondition {
+		t.Fatal(err)
+	}
+	if _, err := m.UpdateWhere(context.Background(), "t", map[string]interface{}{"a": 1}, Where(nil).OrderBy("id")); err != ErrEmptyCondition {
+		t.Fatal(err)
+	}
+}
+
+func TestLegacyAndOr(t *testing.T) {
+	conds := []*Cond{Eq("a", 1), In("b", []interface{}{2, 3}), Like("c", "%x")}
 	sql, args := And(conds, "-id", "type")
-	fmt.Println(sql)
-	fmt.Printf("%v\n", args)
+	exp := "WHERE `a` = ? AND `b` IN (?,?) AND `c` LIKE ? GROUP BY `type` ORDER BY `id` DESC"
+	if sql != exp || !reflect.DeepEqual(args, []interface{}{1, 2, 3, "%x"}) {
+		t.Fatal(sql, args)
+	}
+	if sql, _ = Or(conds[:2], "", ""); sql != "WHERE `a` = ? OR `b` IN (?,?)" {
+		t.Fatal(sql)
+	}
+	if sql, args = And(nil, "id", ""); sql != "" || args != nil {
+		t.Fatal(sql, args)
+	}
+	sql, args = And([]*Cond{Eq("a", 1)}, "-", "")
+	if sql != "WHERE 1 = 0" || !errors.Is(checkCondArgs(args), ErrInvalidIdentifier) {
+		t.Fatal(sql, args)
+	}
+}
 
-	sql, args = And(conds, "+id", "type")
-	fmt.Println(sql)
-	fmt.Printf("%v\n", args)
+// errLog 只记录 Errorf
+type errLog struct {
+	logger.Logger
+	errs []string
+}
 
-	conds = append(conds, In("gate", "(select gate from table)"))
-	sql, args = And(conds, "id", "type")
-	fmt.Println(sql)
-	fmt.Printf("%v\n", args)
+func (l *errLog) Errorf(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Sprintf(format, args...))
+}
+
+func TestLegacyAndOrError(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 1)
+	log := &errLog{}
+	mgr.opt.copt.log = log
+	conn, _ := mgr.Get()
+	defer mgr.Put(conn)
+	ctx := context.Background()
 
-	sql, args = Or(conds, "id", "type")
-	fmt.Println(sql)
-	fmt.Printf("%v\n", args)
+	// 构造失败的条件在执行时返回错误，不会变成查不到数据的 sql
+	where, args := Or([]*Cond{Eq("a..b", 1)}, "", "")
+	if err := conn.Select(ctx, "t", []string{"*"}, where, args...); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatal(err)
+	}
+	if _, err := conn.Update(ctx, "t", map[string]interface{}{"a": 1}, where, args...); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Fatal(err)
+	}
+	if got := fdb.statements(); len(got) != 0 {
+		t.Fatal(got)
+	}
+	if len(log.errs) != 2 {
+		t.Fatal(log.errs)
+	}
 }
@@ -0,0 +1,244 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDriver 记录执行过的 sql 的 database/sql 驱动，用于离线测试
+type fakeDriver struct{}
+
+var (
+	fakeDBs   sync.Map
+	fakeSeq   int
+	fakeSeqMu sync.Mutex
+)
+
+func init() {
+	sql.Register("dmysql_fake", fakeDriver{})
+}
+
+type fakeDB struct {
+	mu   sync.Mutex
+	log  []string
+	rows map[string]*fakeRows
+	errs map[string]error
+	// nextID 下一次插入的自增值，每个 (?...) 占用一个
+	nextID int64
+	// args 每次 Exec 的参数
+	args [][]driver.Value
+	// prepared 每条 sql 的预处理次数
+	prepared map[string]int
+}
+
+// fakeRows 查询 query 时返回的结果
+type fakeRows struct {
+	cols []string
+	vals [][]driver.Value
+	pos  int
+}
+
+func (d *fakeDB) record(q string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, q)
+	for prefix, err := range d.errs {
+		if strings.HasPrefix(q, prefix) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *fakeDB) setRows(query string, cols []string, vals ...[]driver.Value) {
+	d.mu.Lock()
+	d.rows[query] = &fakeRows{cols: cols, vals: vals}
+	d.mu.Unlock()
+}
+
+func (d *fakeDB) setErr(prefix string, err error) {
+	d.mu.Lock()
+	d.errs[prefix] = err
+	d.mu.Unlock()
+}
+
+func (d *fakeDB) statements() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.log...)
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	// 通过 New 打开时 name 是完整的 dsn，按 tcp(host:port) 中的地址查找
+	if s := strings.Index(name, "tcp("); s >= 0 {
+		if e := strings.IndexByte(name[s:], ')'); e > 0 {
+			name = name[s+len("tcp(") : s+e]
+		}
+	}
+	v, ok := fakeDBs.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("fake db %s not found", name)
+	}
+	return &fakeConn{db: v.(*fakeDB)}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.db.mu.Lock()
+	c.db.prepared[query]++
+	c.db.mu.Unlock()
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	q := "BEGIN"
+	if opts.Isolation != 0 {
+		q += " " + sql.IsolationLevel(opts.Isolation).String()
+	}
+	if opts.ReadOnly {
+		q += " READ ONLY"
+	}
+	if err := c.db.record(q); err != nil {
+		return nil, err
+	}
+	return &fakeTx{db: c.db}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) > 0 {
+		return nil, driver.ErrSkip
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := c.db.record(query); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+type fakeTx struct {
+	db *fakeDB
+}
+
+func (tx *fakeTx) Commit() error   { return tx.db.record("COMMIT") }
+func (tx *fakeTx) Rollback() error { return tx.db.record("ROLLBACK") }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if err := s.db.record(s.query); err != nil {
+		return nil, err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.args = append(s.db.args, args)
+	id := s.db.nextID
+	s.db.nextID += int64(strings.Count(s.query, "(?"))
+	return fakeResult{id: id}, nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if err := s.db.record(s.query); err != nil {
+		return nil, err
+	}
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	rows, ok := s.db.rows[s.query]
+	if !ok {
+		return &fakeRows{}, nil
+	}
+	return &fakeRows{cols: rows.cols, vals: rows.vals}, nil
+}
+
+type fakeResult struct {
+	id int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) { return r.id, nil }
+func (fakeResult) RowsAffected() (int64, error)   { return 1, nil }
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.vals) {
+		return io.EOF
+	}
+	copy(dest, r.vals[r.pos])
+	r.pos++
+	return nil
+}
+
+// newFakeManager 返回使用 fakeDriver 的 Manager，连接池中有 size 个连接，共享同一个 fakeDB
+func newFakeManager(t *testing.T, size int) (*Manager, *fakeDB) {
+	fakeSeqMu.Lock()
+	fakeSeq++
+	name := fmt.Sprintf("fake%d", fakeSeq)
+	fakeSeqMu.Unlock()
+	fdb := &fakeDB{rows: make(map[string]*fakeRows), errs: make(map[string]error), nextID: 1,
+		prepared: make(map[string]int)}
+	fakeDBs.Store(name, fdb)
+
+	opt := &option{poolSize: size, mode: AcquireConnModeUnblock, copt: &connectionOption{}}
+	mgr := &Manager{pool: make(chan *MySQL, size), opt: opt}
+	for i := 0; i < size; i++ {
+		db, err := sql.Open("dmysql_fake", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mgr.Put(&MySQL{db: db, opt: opt.copt})
+	}
+	t.Cleanup(func() {
+		for len(mgr.pool) > 0 {
+			(<-mgr.pool).Close()
+		}
+		fakeDBs.Delete(name)
+	})
+	return mgr, fdb
+}
+
+var errFake = errors.New("fake error")
+
+// newFakeReplica 返回使用 fakeDriver 的从库，SHOW SLAVE STATUS 返回 lag
+func newFakeReplica(t *testing.T, addr string, lag driver.Value) (*replica, *fakeDB) {
+	fakeSeqMu.Lock()
+	fakeSeq++
+	name := fmt.Sprintf("fake%d", fakeSeq)
+	fakeSeqMu.Unlock()
+	fdb := &fakeDB{rows: make(map[string]*fakeRows), errs: make(map[string]error), nextID: 1,
+		prepared: make(map[string]int)}
+	fakeDBs.Store(name, fdb)
+	fdb.setRows(showSlaveStatus, []string{"Slave_IO_State", "Seconds_Behind_Master"}, []driver.Value{"", lag})
+	db, err := sql.Open("dmysql_fake", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fakeDBs.Delete(name)
+	})
+	return &replica{addr: addr, db: db}, fdb
+}
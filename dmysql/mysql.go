@@ -14,14 +14,17 @@ import (
 	"time"
 
 	dctx "github.com/dup2X/gopkg/context"
+	"github.com/dup2X/gopkg/ctxutil"
 	"github.com/dup2X/gopkg/discovery"
 	"github.com/dup2X/gopkg/elapsed"
 
 	_ "github.com/go-sql-driver/mysql" // call init to register mysql driver
 )
 
+// mysqlDriver 测试中替换为 fake driver
+var mysqlDriver = "mysql"
+
 const (
-	mysqlDriver     = "mysql"
 	defaultCharset  = "utf8"
 	defaultPoolSize = 8
 
@@ -46,7 +49,9 @@ var (
 	// ErrAcquiredConnTimeout acquire connection timed out
 	ErrAcquiredConnTimeout = errors.New("acquire connection timed out")
 	// ErrNotOpened close or nil db
-	ErrNotOpened        = errors.New("close or nil db")
+	ErrNotOpened = errors.New("close or nil db")
+	// ErrTimeout ctx 或 SLA 的截止时间已到，sql 被中断
+	ErrTimeout          = errors.New("mysql query timeout")
 	errNotSameFieldData = errors.New("batch data has different num of field")
 )
 
@@ -69,6 +74,7 @@ type Manager struct {
 	Connected    int
 	balancer     discovery.Balancer
 	disfBalancer discovery.Balancer
+	replicas     *replicaSet
 
 	mu         sync.Mutex
 	activeConn int64
@@ -103,9 +109,25 @@ func New(hosts []string, usr, passwd, db, charset string, opts ...Option) (*Mana
 	cnt, err := mgr.initPool()
 	mgr.Connected = cnt
 	if mgr.opt.keepSilent && mgr.Connected > 0 {
-		return mgr, nil
+		err = nil
+	}
+	if err != nil {
+		return mgr, err
+	}
+	// 主库可用之后再打开从库，避免初始化失败时留下从库连接和探活协程
+	if len(opt.replicaHosts) > 0 {
+		if mgr.replicas, err = mgr.openReplicas(opt.replicaHosts); err != nil {
+			mgr.Close()
+			return nil, err
+		}
+		// 连接池中的连接在打开从库之前创建，补上从库
+		for i := len(mgr.pool); i > 0; i-- {
+			conn := <-mgr.pool
+			conn.replicas = mgr.replicas
+			mgr.pool <- conn
+		}
 	}
-	return mgr, err
+	return mgr, nil
 }
 
 func (mgr *Manager) initPool() (usable int, err error) {
@@ -131,6 +153,44 @@ func (mgr *Manager) initPool() (usable int, err error) {
 	return usable, nil
 }
 
+func (mgr *Manager) openReplicas(hosts []string) (*replicaSet, error) {
+	replicas := make([]*replica, 0, len(hosts))
+	for _, host := range hosts {
+		hp, err := newAddress(host)
+		if err == nil {
+			db := newMySQL(hp, mgr.opt.copt)
+			if err = db.connect(); err == nil {
+				mgr.opt.limitConns(db.db)
+				replicas = append(replicas, &replica{addr: host, db: db.db})
+				continue
+			}
+		}
+		for _, r := range replicas {
+			r.db.Close()
+		}
+		return nil, err
+	}
+	rs := newReplicaSet(replicas, mgr.opt)
+	// 第一次检查也在后台执行，慢从库不会阻塞 New
+	go rs.watch()
+	return rs, nil
+}
+
+// Close 停止从库检查并关闭从库和连接池中空闲的连接，使用中的连接在归还时关闭
+func (mgr *Manager) Close() {
+	if mgr.replicas != nil {
+		mgr.replicas.close()
+	}
+	for {
+		select {
+		case conn := <-mgr.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
 func (mgr *Manager) newDB() (*MySQL, error) {
 	var (
 		err  error
@@ -154,6 +214,7 @@ func (mgr *Manager) newDB() (*MySQL, error) {
 	if err != nil {
 		return nil, err
 	}
+	db.replicas = mgr.replicas
 	return db, nil
 }
 
@@ -214,8 +275,16 @@ type MySQL struct {
 	db   *sql.DB
 	tx   *sql.Tx
 	rows *sql.Rows
-	rs   sql.Result
-	addr *address
+	// cancel 释放 rows 使用的 ctx，rows 关闭时调用
+	cancel context.CancelFunc
+	rs     sql.Result
+	addr   *address
+	// replicas 读请求使用的从库，为 nil 时只使用主库
+	replicas *replicaSet
+	// maxPacket 主库的 max_allowed_packet
+	maxPacket int
+	// stmts 预处理语句缓存，WithStmtCacheSize 大于 0 时使用
+	stmts *stmtCache
 
 	opt *connectionOption
 }
@@ -262,6 +331,9 @@ func (m *MySQL) connect() (err error) {
 
 // Execute low level api to exec sql
 func (m *MySQL) Execute(ctx context.Context, sqlPattern string, args ...interface{}) (err error) {
+	if err = m.checkCondArgs(ctx, sqlPattern, args); err != nil {
+		return err
+	}
 	et := elapsed.New()
 	et.Start()
 	if m.opt.debug {
@@ -271,32 +343,37 @@ func (m *MySQL) Execute(ctx context.Context, sqlPattern string, args ...interfac
 			m.opt.log.Debugf("_mysql||%s||sql:%s values:%+v", ctx, sqlPattern, args)
 		}
 	}
-	var stmt *sql.Stmt
-	if m.rows != nil {
-		m.rows.Close()
-		m.rows = nil
-	}
-	if m.tx != nil {
-		stmt, err = m.tx.Prepare(sqlPattern)
-	} else {
-		stmt, err = m.db.Prepare(sqlPattern)
+	m.closeRows()
+	ctx, cancel, err := withDeadline(ctx)
+	if err != nil {
+		return err
 	}
+	defer cancel()
+	stmt, release, err := m.prepare(ctx, sqlPattern)
 	defer func() {
-		if stmt != nil {
-			stmt.Close()
-		}
+		release()
 		dctx.AddMysqlElapsed(ctx, et.Stop())
 	}()
 	if err != nil {
-		return
+		return timeoutError(ctx, err)
 	}
 
-	m.rs, err = stmt.Exec(args...)
-	return
+	m.rs, err = stmt.ExecContext(ctx, args...)
+	return timeoutError(ctx, err)
 }
 
 // Query do query
 func (m *MySQL) Query(ctx context.Context, sqlPattern string, args ...interface{}) (err error) {
+	m.closeRows()
+	m.rows, m.cancel, err = m.query(ctx, sqlPattern, args...)
+	return err
+}
+
+// query 执行查询，返回的 cancel 需要在 rows 关闭时调用
+func (m *MySQL) query(ctx context.Context, sqlPattern string, args ...interface{}) (*sql.Rows, context.CancelFunc, error) {
+	if err := m.checkCondArgs(ctx, sqlPattern, args); err != nil {
+		return nil, nil, err
+	}
 	et := elapsed.New()
 	et.Start()
 	if m.opt.debug {
@@ -306,41 +383,89 @@ func (m *MySQL) Query(ctx context.Context, sqlPattern string, args ...interface{
 			m.opt.log.Debugf("_mysql||%s||sql:%s values:%+v", ctx, sqlPattern, args)
 		}
 	}
-	if m.rows != nil {
-		m.rows.Close()
-		m.rows = nil
+	qctx, cancel, err := withDeadline(ctx)
+	if err != nil {
+		return nil, nil, err
 	}
+	var rows *sql.Rows
 	if m.tx != nil {
-		m.rows, err = m.tx.Query(sqlPattern, args...)
+		rows, err = m.tx.QueryContext(qctx, sqlPattern, args...)
 	} else {
-		m.rows, err = m.db.Query(sqlPattern, args...)
+		rows, err = m.readDB(ctx).QueryContext(qctx, sqlPattern, args...)
 	}
 	dctx.AddMysqlElapsed(ctx, et.Stop())
-	return
+	if err != nil {
+		cancel()
+		return nil, nil, timeoutError(qctx, err)
+	}
+	// 截止时间需要覆盖读取结果的过程，在 rows 关闭时释放
+	return rows, cancel, nil
 }
 
-// Begin tr begin
-func (m *MySQL) Begin(ctx context.Context) (err error) {
-	m.tx, err = m.db.Begin()
+// checkCondArgs 参数中带有 And/Or 的构造错误时记录日志并返回该错误，不执行 sql
+func (m *MySQL) checkCondArgs(ctx context.Context, sqlPattern string, args []interface{}) error {
+	err := checkCondArgs(args)
+	if err != nil && m.opt.log != nil {
+		m.opt.log.Errorf("_mysql||%s||sql:%s err:%v", ctx, sqlPattern, err)
+	}
+	return err
+}
+
+// endRows 结果读取完毕，关闭 rows，读取中途出错时返回该错误，否则返回 io.EOF
+func (m *MySQL) endRows(ctx context.Context) error {
+	err := m.rows.Err()
+	m.closeRows()
 	if err != nil {
-		return
+		return timeoutError(ctx, err)
+	}
+	return io.EOF
+}
+
+// readDB 返回读请求使用的 db，有健康的从库且未通过 ForcePrimary 指定主库时使用从库
+func (m *MySQL) readDB(ctx context.Context) *sql.DB {
+	if m.replicas == nil || usePrimary(ctx) {
+		return m.db
+	}
+	if db := m.replicas.pick(); db != nil {
+		return db
 	}
+	return m.db
+}
+
+// closeRows 关闭上一次查询的结果
+func (m *MySQL) closeRows() (err error) {
 	if m.rows != nil {
 		err = m.rows.Close()
+		m.rows = nil
+	}
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
 	}
 	return
 }
 
+// Begin tr begin
+// ctx 结束时事务会被回滚，截止时间需要覆盖整个事务
+func (m *MySQL) Begin(ctx context.Context) (err error) {
+	if _, err = slaDeadline(ctx); err != nil {
+		return err
+	}
+	m.tx, err = m.db.BeginTx(ctx, nil)
+	if err != nil {
+		m.tx = nil
+		return timeoutError(ctx, err)
+	}
+	return m.closeRows()
+}
+
 // Commit tx commit
 func (m *MySQL) Commit(ctx context.Context) (err error) {
 	if m.tx == nil {
 		return ErrNilTransaction
 	}
-	if m.rows != nil {
-		err = m.rows.Close()
-		if err != nil {
-			return
-		}
+	if err = m.closeRows(); err != nil {
+		return
 	}
 	err = m.tx.Commit()
 	m.tx = nil
@@ -352,11 +477,8 @@ func (m *MySQL) RollBack(ctx context.Context) (err error) {
 	if m.tx == nil {
 		return ErrNilTransaction
 	}
-	if m.rows != nil {
-		err = m.rows.Close()
-		if err != nil {
-			return
-		}
+	if err = m.closeRows(); err != nil {
+		return
 	}
 	err = m.tx.Rollback()
 	m.tx = nil
@@ -382,9 +504,16 @@ func (m *MySQL) Insert(ctx context.Context, table string, kvPairs map[string]int
 		values[i] = kvPairs[field]
 		i++
 	}
-	keyStr := "`" + strings.Join(keys, "`,`") + "`"
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	keyStr, err := quoteIdents(keys)
+	if err != nil {
+		return -1, err
+	}
 	valStr := strings.Join(pos, ",")
-	sqlPattern := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", wrapTable(table), keyStr, valStr)
+	sqlPattern := fmt.Sprintf("INSERT INTO %s(%s) VALUES(%s)", tabName, keyStr, valStr)
 	err = m.Execute(ctx, sqlPattern, values...)
 	if err == nil {
 		lastID = m.LastInsertID(ctx)
@@ -411,7 +540,14 @@ func (m *MySQL) MultiInsert(ctx context.Context, table string, batchData []map[s
 		placeHolder = append(placeHolder, "?")
 	}
 	placeHolderStr := fmt.Sprintf("(%s)", strings.Join(placeHolder, ","))
-	keyStr := "`" + strings.Join(keys, "`,`") + "`"
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	keyStr, err := quoteIdents(keys)
+	if err != nil {
+		return -1, err
+	}
 
 	for _, each := range batchData {
 		if len(each) != len(keys) {
@@ -419,28 +555,27 @@ func (m *MySQL) MultiInsert(ctx context.Context, table string, batchData []map[s
 		}
 	}
 
-	sqlPattern := bytes.NewBufferString(fmt.Sprintf("INSERT INTO %s(%s) VALUES ", wrapTable(table), keyStr))
+	sqlPattern := bytes.NewBufferString(fmt.Sprintf("INSERT INTO %s(%s) VALUES ", tabName, keyStr))
 	for i := range batchData {
 		sqlPattern.WriteString(placeHolderStr)
 		if i < len(batchData)-1 {
 			sqlPattern.WriteString(",")
 		}
 	}
-	var stmt *sql.Stmt
-	if m.tx != nil {
-		stmt, err = m.tx.Prepare(sqlPattern.String())
-	} else {
-		stmt, err = m.db.Prepare(sqlPattern.String())
+	m.closeRows()
+	ctx, cancel, err := withDeadline(ctx)
+	if err != nil {
+		return -1, err
 	}
+	defer cancel()
+	stmt, release, err := m.prepare(ctx, sqlPattern.String())
 	defer func() {
-		if stmt != nil {
-			stmt.Close()
-		}
+		release()
 		dctx.AddMysqlElapsed(ctx, et.Stop())
 	}()
 
 	if err != nil {
-		return
+		return -1, timeoutError(ctx, err)
 	}
 	values := make([]interface{}, len(keys)*len(batchData))
 	var index = 0
@@ -450,11 +585,11 @@ func (m *MySQL) MultiInsert(ctx context.Context, table string, batchData []map[s
 			index++
 		}
 	}
-	m.rs, err = stmt.Exec(values...)
+	m.rs, err = stmt.ExecContext(ctx, values...)
 	if err == nil {
 		lastID = m.LastInsertID(ctx)
 	}
-	return
+	return lastID, timeoutError(ctx, err)
 }
 
 // Upsert ...
@@ -474,25 +609,32 @@ func (m *MySQL) Upsert(ctx context.Context, table string, data map[string]interf
 		placeHolder = append(placeHolder, "?")
 	}
 	placeHolderStr := fmt.Sprintf("(%s)", strings.Join(placeHolder, ","))
-	keyStr := "`" + strings.Join(dataKeys, "`,`") + "`"
-	tableName := wrapTable(table)
+	tableName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	keyStr, err := quoteIdents(dataKeys)
+	if err != nil {
+		return -1, err
+	}
 	sqlPattern := bytes.NewBufferString(
 		fmt.Sprintf("INSERT INTO %s(%s) VALUES %s", tableName, keyStr, placeHolderStr))
 
 	if len(updateKeys) > 0 {
 		fmt.Fprintf(sqlPattern, " ON DUPLICATE KEY UPDATE ")
 		for idx, k := range updateKeys {
-			fmt.Fprintf(sqlPattern, "`%s` = VALUES(`%s`)", k, k)
+			k, err = quoteIdent(k)
+			if err != nil {
+				return -1, err
+			}
+			fmt.Fprintf(sqlPattern, "%s = VALUES(%s)", k, k)
 			if idx < len(updateKeys)-1 {
 				fmt.Fprintf(sqlPattern, ",")
 			}
 		}
 	}
 
-	var (
-		stmt *sql.Stmt
-		sql  = sqlPattern.String()
-	)
+	sql := sqlPattern.String()
 	if m.opt.debug {
 		if m.opt.log == nil {
 			fmt.Printf("_mysql||%s||sql:%s\n", ctx, sql)
@@ -501,33 +643,34 @@ func (m *MySQL) Upsert(ctx context.Context, table string, data map[string]interf
 		}
 	}
 
-	if m.tx != nil {
-		stmt, err = m.tx.Prepare(sql)
-	} else {
-		stmt, err = m.db.Prepare(sql)
+	m.closeRows()
+	ctx, cancel, err := withDeadline(ctx)
+	if err != nil {
+		return -1, err
 	}
+	defer cancel()
+	stmt, release, err := m.prepare(ctx, sql)
 	defer func() {
-		if stmt != nil {
-			stmt.Close()
-		}
+		release()
 		dctx.AddMysqlElapsed(ctx, et.Stop())
 	}()
 
 	if err != nil {
-		return
+		return -1, timeoutError(ctx, err)
 	}
 	values := make([]interface{}, len(dataKeys))
 	for i, key := range dataKeys {
 		values[i] = data[key]
 	}
-	m.rs, err = stmt.Exec(values...)
+	m.rs, err = stmt.ExecContext(ctx, values...)
 	if err == nil {
 		lastID = m.LastInsertID(ctx)
 	}
-	return
+	return lastID, timeoutError(ctx, err)
 }
 
-// Update ...
+// Update condPattern 为 WHERE 及之后的 sql，由调用方拼接
+// 新代码使用 UpdateWhere，条件由 Cond 构造，值全部绑定为参数，空条件时不会更新全表
 func (m *MySQL) Update(ctx context.Context, table string, updator map[string]interface{}, condPattern string,
 	condArgs ...interface{}) (affect int64, err error) {
 	if table == "" {
@@ -544,9 +687,16 @@ func (m *MySQL) Update(ctx context.Context, table string, updator map[string]int
 		vals        = make([]interface{}, length)
 		i           int
 	)
-	tabName = wrapTable(table)
+	tabName, err = wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
 	for field := range updator {
-		updatePairs[i] = "`" + field + "`=?"
+		quoted, err := quoteIdent(field)
+		if err != nil {
+			return -1, err
+		}
+		updatePairs[i] = quoted + "=?"
 		vals[i] = updator[field]
 		i++
 	}
@@ -562,7 +712,8 @@ func (m *MySQL) Update(ctx context.Context, table string, updator map[string]int
 	return
 }
 
-// Delete ...
+// Delete condPattern 为 WHERE 及之后的 sql，由调用方拼接
+// 新代码使用 DeleteWhere，条件由 Cond 构造，值全部绑定为参数，空条件时不会删除全表
 func (m *MySQL) Delete(ctx context.Context, table string, condPattern string, condArgs ...interface{}) (affect int64, err error) {
 	if table == "" {
 		return -1, ErrEmptyTable
@@ -574,7 +725,10 @@ func (m *MySQL) Delete(ctx context.Context, table string, condPattern string, co
 	var (
 		tabName string
 	)
-	tabName = wrapTable(table)
+	tabName, err = wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
 	sqlPattern := fmt.Sprintf("DELETE FROM %s %s", tabName, condPattern)
 	err = m.Execute(ctx, sqlPattern, condArgs...)
 	if err == nil {
@@ -583,26 +737,74 @@ func (m *MySQL) Delete(ctx context.Context, table string, condPattern string, co
 	return
 }
 
-// Select ...
+// Select condPattern 为 WHERE 及之后的 sql，由调用方拼接
+// 新代码使用 SelectWhere，条件由 Cond 构造，值全部绑定为参数
 func (m *MySQL) Select(ctx context.Context, table string, fields []string, condPattern string, condArgs ...interface{}) error {
+	sqlPattern, err := selectSQL(table, fields, condPattern)
+	if err != nil {
+		return err
+	}
+	return m.Query(ctx, sqlPattern, condArgs...)
+}
+
+func selectSQL(table string, fields []string, condPattern string) (string, error) {
 	if table == "" {
-		return ErrEmptyTable
+		return "", ErrEmptyTable
 	}
-	if fields == nil || len(fields) == 0 {
-		return ErrEmptyValues
+	if len(fields) == 0 {
+		return "", ErrEmptyValues
+	}
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return "", err
 	}
-	tabName := wrapTable(table)
 	fieldStr := ""
 	if len(fields) == 1 && fields[0] == matchAllMask {
 		fieldStr = fields[0]
-	} else {
-		fieldStr = "`" + strings.Join(fields, "`,`") + "`"
+	} else if fieldStr, err = quoteIdents(fields); err != nil {
+		return "", err
 	}
 	sqlPattern := fmt.Sprintf("SELECT %s FROM %s", fieldStr, tabName)
 	if condPattern != "" {
 		sqlPattern += " " + condPattern
 	}
-	return m.Query(ctx, sqlPattern, condArgs...)
+	return sqlPattern, nil
+}
+
+// SelectWhere 使用 Clause 作为条件查询，clause 可以为 nil
+func (m *MySQL) SelectWhere(ctx context.Context, table string, fields []string, clause *Clause) error {
+	if clause == nil {
+		return m.Select(ctx, table, fields, "")
+	}
+	condPattern, condArgs, err := clause.Build()
+	if err != nil {
+		return err
+	}
+	return m.Select(ctx, table, fields, condPattern, condArgs...)
+}
+
+// UpdateWhere 使用 Clause 作为条件更新，没有 WHERE 条件时返回 ErrEmptyCondition，不会更新全表
+func (m *MySQL) UpdateWhere(ctx context.Context, table string, updator map[string]interface{}, clause *Clause) (affect int64, err error) {
+	if !clause.hasWhere() {
+		return -1, ErrEmptyCondition
+	}
+	condPattern, condArgs, err := clause.Build()
+	if err != nil {
+		return -1, err
+	}
+	return m.Update(ctx, table, updator, condPattern, condArgs...)
+}
+
+// DeleteWhere 使用 Clause 作为条件删除，没有 WHERE 条件时返回 ErrEmptyCondition
+func (m *MySQL) DeleteWhere(ctx context.Context, table string, clause *Clause) (affect int64, err error) {
+	if !clause.hasWhere() {
+		return -1, ErrEmptyCondition
+	}
+	condPattern, condArgs, err := clause.Build()
+	if err != nil {
+		return -1, err
+	}
+	return m.Delete(ctx, table, condPattern, condArgs...)
 }
 
 // FetchRow ...
@@ -637,17 +839,13 @@ func (m *MySQL) fetchRow(ctx context.Context) (rows Row, err error) {
 		}
 		return rows, err
 	}
-	m.rows.Close()
-	return nil, io.EOF
+	return nil, m.endRows(ctx)
 }
 
 // FetchOneRow ...
 func (m *MySQL) FetchOneRow(ctx context.Context) (row Row, err error) {
 	row, err = m.fetchRow(ctx)
-	if m.rows != nil {
-		m.rows.Close()
-		m.rows = nil
-	}
+	m.closeRows()
 	return
 }
 
@@ -707,8 +905,7 @@ func (m *MySQL) fetchRowMap(ctx context.Context) (rowMap RowMap, err error) {
 		}
 		return rowMap, nil
 	}
-	m.rows = nil
-	return nil, io.EOF
+	return nil, m.endRows(ctx)
 }
 
 // FetchRowMapInterface ...
@@ -744,8 +941,7 @@ func (m *MySQL) fetchRowMapInterface(ctx context.Context) (rowMapIntf map[string
 		}
 		return rowMapIntf, nil
 	}
-	m.rows = nil
-	return nil, io.EOF
+	return nil, m.endRows(ctx)
 }
 
 // FetchAllMap ...
@@ -796,17 +992,21 @@ func (m *MySQL) Ping() error {
 
 // Close ...
 func (m *MySQL) Close() error {
-	if m.rows != nil {
-		m.rows.Close()
+	m.closeRows()
+	if m.stmts != nil {
+		m.stmts.close()
 	}
 	m.tx = nil
 	m.rs = nil
-	m.rows = nil
 	return m.db.Close()
 }
 
-func wrapTable(table string) string {
-	return "`" + strings.Replace(table, ".", "`.`", -1) + "`"
+// wrapTable 校验并转义表名，支持 db.table 形式
+func wrapTable(table string) (string, error) {
+	if strings.Count(table, ".") > 1 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidIdentifier, table)
+	}
+	return quoteIdent(table)
 }
 
 // RowMap row result
@@ -834,3 +1034,51 @@ func newAddress(str string) (*address, error) {
 func (ad *address) String() string {
 	return fmt.Sprintf("%s:%s", ad.host, ad.port)
 }
+
+// slaDeadline 根据 ctx 中的请求开始时间和超时时间计算 SLA 截止时间
+// ctx 中没有 SLA 信息时返回零值，SLA 已耗尽时返回 ErrTimeout
+func slaDeadline(ctx context.Context) (time.Time, error) {
+	inTs, err := ctxutil.GetRequestInTs(ctx)
+	if err != nil || inTs <= 0 {
+		return time.Time{}, nil
+	}
+	timeout, err := ctxutil.GetRequestTimeout(ctx)
+	if err != nil || timeout <= 0 {
+		return time.Time{}, nil
+	}
+	deadline := time.Unix(0, (inTs+timeout)*int64(time.Millisecond))
+	if !time.Now().Before(deadline) {
+		return deadline, ErrTimeout
+	}
+	return deadline, nil
+}
+
+// withDeadline 返回带截止时间的 ctx，取 ctx 自身截止时间和 SLA 截止时间中较早的一个
+func withDeadline(ctx context.Context) (context.Context, context.CancelFunc, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if err := ctx.Err(); err != nil {
+		return ctx, nil, timeoutError(ctx, err)
+	}
+	deadline, err := slaDeadline(ctx)
+	if err != nil {
+		return ctx, nil, err
+	}
+	if d, ok := ctx.Deadline(); deadline.IsZero() || ok && !deadline.Before(d) {
+		return ctx, func() {}, nil
+	}
+	nctx, cancel := context.WithDeadline(ctx, deadline)
+	return nctx, cancel, nil
+}
+
+// timeoutError 将 database/sql 因截止时间返回的错误统一为 ErrTimeout
+func timeoutError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) || ctx != nil && ctx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
@@ -2,6 +2,8 @@
 package dmysql
 
 import (
+	"database/sql"
+	"sync"
 	"time"
 
 	"github.com/dup2X/gopkg/logger"
@@ -21,6 +23,11 @@ type connectionOption struct {
 	writeTimeout     time.Duration
 	debug            bool
 	log              logger.Logger
+	maxAllowedPacket int
+	stmtCacheSize    int
+
+	locOnce sync.Once
+	tz      *time.Location
 }
 
 type option struct {
@@ -33,11 +40,26 @@ type option struct {
 	keepSilent  bool
 	disfEnable  bool
 	log         logger.Logger
+
+	replicaHosts         []string
+	maxReplicaLag        time.Duration
+	replicaCheckInterval time.Duration
 }
 
 // Option option func
 type Option func(o *option)
 
+// limitConns 从库的 sql.DB 被所有连接共享，连接数与主库连接池一致：
+// 最多 maxConnSize(未设置时为 poolSize) 个连接，保留 poolSize 个空闲连接
+func (o *option) limitConns(db *sql.DB) {
+	maxOpen := o.maxConnSize
+	if maxOpen < o.poolSize {
+		maxOpen = o.poolSize
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(o.poolSize)
+}
+
 // WithPoolSize set pool size
 func WithPoolSize(size int) Option {
 	return func(o *option) {
@@ -45,7 +67,7 @@ func WithPoolSize(size int) Option {
 	}
 }
 
-// WithMaxConnSize set max pool size
+// WithMaxConnSize set max pool size，同时作为每个从库的最大连接数
 func WithMaxConnSize(size int) Option {
 	return func(o *option) {
 		o.maxConnSize = size
@@ -136,3 +158,39 @@ func WithAcquireConnMode(mode AcquireConnMode) Option {
 		o.mode = mode
 	}
 }
+
+// WithReplicas 设置从库地址，读请求发往健康的从库，写请求和事务使用 New 传入的主库
+func WithReplicas(hosts []string) Option {
+	return func(o *option) {
+		o.replicaHosts = hosts
+	}
+}
+
+// WithMaxReplicaLag 从库延迟超过 lag 时不再参与读，默认 5s
+func WithMaxReplicaLag(lag time.Duration) Option {
+	return func(o *option) {
+		o.maxReplicaLag = lag
+	}
+}
+
+// WithReplicaCheckInterval 检查从库延迟的间隔，默认 3s
+func WithReplicaCheckInterval(interval time.Duration) Option {
+	return func(o *option) {
+		o.replicaCheckInterval = interval
+	}
+}
+
+// WithMaxAllowedPacket 设置 MultiInsertStructs 拆分语句的上限，默认查询主库的 max_allowed_packet
+func WithMaxAllowedPacket(size int) Option {
+	return func(o *option) {
+		o.copt.maxAllowedPacket = size
+	}
+}
+
+// WithStmtCacheSize 每个连接缓存 size 条预处理语句(LRU)，默认 0 不缓存
+// 语句会在 database/sql 的每个底层连接上预处理，注意服务端的 max_prepared_stmt_count
+func WithStmtCacheSize(size int) Option {
+	return func(o *option) {
+		o.copt.stmtCacheSize = size
+	}
+}
@@ -0,0 +1,207 @@
+// Package dmysql ...
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dup2X/gopkg/logger"
+)
+
+const (
+	defaultMaxReplicaLag        = time.Second * 5
+	defaultReplicaCheckInterval = time.Second * 3
+
+	showSlaveStatus = "SHOW SLAVE STATUS"
+)
+
+var (
+	// ErrNotReplica SHOW SLAVE STATUS 没有返回复制信息
+	ErrNotReplica = errors.New("host is not a replica")
+	// ErrReplicationStopped 复制线程已停止，Seconds_Behind_Master 为 NULL
+	ErrReplicationStopped = errors.New("replication stopped")
+	// ErrReplicaLag 从库延迟超过 WithMaxReplicaLag
+	ErrReplicaLag = errors.New("replica lag too large")
+)
+
+type primaryKey struct{}
+
+// ForcePrimary 返回的 ctx 上的读请求发往主库，用于写后立即读
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+func usePrimary(ctx context.Context) bool {
+	v, _ := ctx.Value(primaryKey{}).(bool)
+	return v
+}
+
+// replica 一个从库，所有连接共享同一个 sql.DB
+type replica struct {
+	addr    string
+	db      *sql.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+// setHealth 更新健康状态，返回状态是否变化
+func (r *replica) setHealth(healthy bool) bool {
+	var v int32
+	if healthy {
+		v = 1
+	}
+	return atomic.SwapInt32(&r.healthy, v) != v
+}
+
+// replicaSet 从库集合，定期检查延迟，延迟过大或不可用的从库不参与轮询
+// 从库在第一次检查通过之前不参与轮询，读请求发往主库
+type replicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     uint32
+	log      logger.Logger
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newReplicaSet(replicas []*replica, opt *option) *replicaSet {
+	rs := &replicaSet{
+		replicas: replicas,
+		maxLag:   opt.maxReplicaLag,
+		interval: opt.replicaCheckInterval,
+		log:      opt.log,
+		done:     make(chan struct{}),
+	}
+	if rs.maxLag <= 0 {
+		rs.maxLag = defaultMaxReplicaLag
+	}
+	if rs.interval <= 0 {
+		rs.interval = defaultReplicaCheckInterval
+	}
+	return rs
+}
+
+// pick 轮询返回一个健康的从库，没有健康的从库时返回 nil
+func (rs *replicaSet) pick() *sql.DB {
+	n := uint32(len(rs.replicas))
+	if n == 0 {
+		return nil
+	}
+	start := atomic.AddUint32(&rs.next, 1)
+	for i := uint32(0); i < n; i++ {
+		if r := rs.replicas[(start+i)%n]; r.isHealthy() {
+			return r.db
+		}
+	}
+	return nil
+}
+
+// watch 立即检查一次，之后每隔 interval 检查
+func (rs *replicaSet) watch() {
+	rs.checkAll()
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-rs.done:
+			return
+		case <-ticker.C:
+			rs.checkAll()
+		}
+	}
+}
+
+// checkAll 并发检查所有从库，一轮最多耗时 interval
+func (rs *replicaSet) checkAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), rs.interval)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, r := range rs.replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			err := rs.check(ctx, r.db)
+			if r.setHealth(err == nil) && rs.log != nil {
+				if err != nil {
+					rs.log.Warnf("_mysql_replica||addr=%s||out of rotation||err=%v", r.addr, err)
+				} else {
+					rs.log.Infof("_mysql_replica||addr=%s||back to rotation", r.addr)
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+}
+
+// check 通过 SHOW SLAVE STATUS 检查从库延迟
+func (rs *replicaSet) check(ctx context.Context, db *sql.DB) error {
+	lag, err := replicaLag(ctx, db)
+	if err != nil {
+		return err
+	}
+	if lag > rs.maxLag {
+		return ErrReplicaLag
+	}
+	return nil
+}
+
+// replicaLag 返回 Seconds_Behind_Master
+func replicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, showSlaveStatus)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrNotReplica
+	}
+	values := make([]sql.NullString, len(cols))
+	scanArgs := make([]interface{}, len(cols))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	if err = rows.Scan(scanArgs...); err != nil {
+		return 0, err
+	}
+	for i, col := range cols {
+		// 8.0.22 之后的 SHOW REPLICA STATUS 使用 Seconds_Behind_Source
+		if col != "Seconds_Behind_Master" && col != "Seconds_Behind_Source" {
+			continue
+		}
+		if !values[i].Valid {
+			return 0, ErrReplicationStopped
+		}
+		sec, err := strconv.ParseInt(values[i].String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(sec) * time.Second, nil
+	}
+	return 0, ErrNotReplica
+}
+
+func (rs *replicaSet) close() {
+	rs.once.Do(func() {
+		close(rs.done)
+		for _, r := range rs.replicas {
+			r.db.Close()
+		}
+	})
+}
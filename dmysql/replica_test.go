@@ -0,0 +1,198 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReplicaRouting(t *testing.T) {
+	mgr, primary := newFakeManager(t, 1)
+	r1, fr1 := newFakeReplica(t, "r1", int64(0))
+	r2, fr2 := newFakeReplica(t, "r2", int64(100))
+	r3, fr3 := newFakeReplica(t, "r3", nil)
+	rs := newReplicaSet([]*replica{r1, r2, r3}, &option{maxReplicaLag: time.Second, replicaCheckInterval: time.Hour})
+	defer rs.close()
+	// 第一次检查之前不参与轮询
+	if rs.pick() != nil {
+		t.Fatal("unchecked replica in rotation")
+	}
+	rs.checkAll()
+	if !r1.isHealthy() || r2.isHealthy() || r3.isHealthy() {
+		t.Fatal("health")
+	}
+	if _, err := replicaLag(context.Background(), r3.db); err != ErrReplicationStopped {
+		t.Fatal(err)
+	}
+
+	conn, _ := mgr.Get()
+	conn.replicas = rs
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := conn.Select(ctx, "t", []string{"*"}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Update(ctx, "t", map[string]interface{}{"a": 1}, "WHERE `id` = ?", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Query(ForcePrimary(ctx), "SELECT 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Begin(ctx); err != nil {
+		t.Fatal(err)
+	}
+	conn.Query(ctx, "SELECT 2")
+	conn.Commit(ctx)
+
+	exp := []string{showSlaveStatus, "SELECT * FROM `t`", "SELECT * FROM `t`", "SELECT * FROM `t`"}
+	if got := fr1.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(got)
+	}
+	if got := fr2.statements(); !reflect.DeepEqual(got, []string{showSlaveStatus}) {
+		t.Fatal(got)
+	}
+	if got := fr3.statements(); !reflect.DeepEqual(got, []string{showSlaveStatus, showSlaveStatus}) {
+		t.Fatal(got)
+	}
+	exp = []string{"UPDATE `t` SET `a`=? WHERE `id` = ?", "SELECT 1", "BEGIN", "SELECT 2", "COMMIT"}
+	if got := primary.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(got)
+	}
+
+	// 从库全部延迟时回退到主库，恢复后重新参与轮询
+	fr1.setRows(showSlaveStatus, []string{"Seconds_Behind_Master"}, []driver.Value{int64(30)})
+	rs.checkAll()
+	if rs.pick() != nil || conn.readDB(ctx) != conn.db {
+		t.Fatal("lagging replica still in rotation")
+	}
+	fr2.setRows(showSlaveStatus, []string{"Seconds_Behind_Master"}, []driver.Value{int64(1)})
+	rs.checkAll()
+	if conn.readDB(ctx) != r2.db {
+		t.Fatal("replica not back to rotation")
+	}
+	mgr.Put(conn)
+}
+
+func TestOpenReplicas(t *testing.T) {
+	// 只完成 TCP 握手不回复的从库
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	mgr := &Manager{opt: &option{
+		poolSize:             4,
+		maxConnSize:          10,
+		replicaCheckInterval: time.Hour,
+		copt:                 &connectionOption{charset: "utf8"},
+	}}
+	start := time.Now()
+	rs, err := mgr.openReplicas([]string{ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rs.close()
+	if time.Since(start) > time.Second {
+		t.Fatal("openReplicas blocked on the first check")
+	}
+	if rs.pick() != nil {
+		t.Fatal("unchecked replica in rotation")
+	}
+	if n := rs.replicas[0].db.Stats().MaxOpenConnections; n != 10 {
+		t.Fatal(n)
+	}
+}
+
+func TestNewPrimaryDown(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+	replica, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replica.Close()
+
+	// 主库不可用时不打开从库，不会留下探活协程
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		mgr, err := New([]string{dead}, "u", "p", "db", "utf8",
+			WithReplicas([]string{replica.Addr().String()}), WithDialTimeout(time.Millisecond*100))
+		if err == nil {
+			t.Fatal("expect error")
+		}
+		if mgr != nil && mgr.replicas != nil {
+			t.Fatal("replicas opened")
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := runtime.NumGoroutine(); n >= before+10 {
+		t.Fatal(before, n)
+	}
+}
+
+func TestNewWithReplicas(t *testing.T) {
+	newDB := func(addr string) *fakeDB {
+		fdb := &fakeDB{rows: make(map[string]*fakeRows), errs: make(map[string]error), nextID: 1,
+			prepared: make(map[string]int)}
+		fakeDBs.Store(addr, fdb)
+		t.Cleanup(func() { fakeDBs.Delete(addr) })
+		return fdb
+	}
+	primary, replica := newDB("primary:3306"), newDB("replica:3306")
+	replica.setRows(showSlaveStatus, []string{"Seconds_Behind_Master"}, []driver.Value{int64(0)})
+	mysqlDriver = "dmysql_fake"
+	defer func() { mysqlDriver = "mysql" }()
+
+	mgr, err := New([]string{"primary:3306"}, "u", "p", "db", "utf8", WithPoolSize(2),
+		WithReplicas([]string{"replica:3306"}), WithAcquireConnMode(AcquireConnModeUnblock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	deadline := time.Now().Add(time.Second)
+	for mgr.replicas.pick() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("replica not checked")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// 初始化时创建的每个连接都读从库、写主库
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		conn, err := mgr.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mgr.Put(conn)
+		if err = conn.Select(ctx, "t", []string{"*"}, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = conn.Update(ctx, "t", map[string]interface{}{"a": 1}, "WHERE `id` = ?", 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	selects := 0
+	for _, s := range replica.statements() {
+		if s == "SELECT * FROM `t`" {
+			selects++
+		}
+	}
+	if selects != 2 {
+		t.Fatal(replica.statements())
+	}
+	exp := []string{"UPDATE `t` SET `a`=? WHERE `id` = ?", "UPDATE `t` SET `a`=? WHERE `id` = ?"}
+	if got := primary.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(got)
+	}
+}
@@ -0,0 +1,210 @@
+// Package dmysql ...
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+var (
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	rowMapType = reflect.TypeOf(RowMap{})
+)
+
+// Rows QueryRows 返回的游标，逐行读取结果，不影响 MySQL 上的其他查询，使用完需要 Close
+// 事务中 Rows 占用事务的连接，Close 之前不能在同一事务中执行其他 sql
+type Rows struct {
+	rows   *sql.Rows
+	ctx    context.Context
+	cancel context.CancelFunc
+	loc    *time.Location
+	cols   []string
+
+	scanner     *structScanner
+	scannerType reflect.Type
+}
+
+// QueryRows 执行查询并返回游标，适合读取大量结果
+// Query 把结果保存在 MySQL 上供 Fetch 系列方法读取，为了不改变 Query 的签名，游标通过单独的 QueryRows 返回
+func (m *MySQL) QueryRows(ctx context.Context, sqlPattern string, args ...interface{}) (*Rows, error) {
+	rows, cancel, err := m.query(ctx, sqlPattern, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &Rows{rows: rows, ctx: ctx, cancel: cancel, loc: m.opt.location()}, nil
+}
+
+// SelectRows 与 SelectWhere 相同，返回游标，clause 可以为 nil
+func (m *MySQL) SelectRows(ctx context.Context, table string, fields []string, clause *Clause) (*Rows, error) {
+	var (
+		condPattern string
+		condArgs    []interface{}
+		err         error
+	)
+	if clause != nil {
+		if condPattern, condArgs, err = clause.Build(); err != nil {
+			return nil, err
+		}
+	}
+	sqlPattern, err := selectSQL(table, fields, condPattern)
+	if err != nil {
+		return nil, err
+	}
+	return m.QueryRows(ctx, sqlPattern, condArgs...)
+}
+
+// Next 移动到下一行，没有更多结果或出错时返回 false，通过 Err 区分
+func (r *Rows) Next() bool {
+	return r.rows.Next()
+}
+
+// Err 返回遍历过程中的错误，超时返回 ErrTimeout
+func (r *Rows) Err() error {
+	return timeoutError(r.ctx, r.rows.Err())
+}
+
+// Close 关闭游标，可以重复调用
+func (r *Rows) Close() error {
+	err := r.rows.Close()
+	if r.cancel != nil {
+		r.cancel()
+		r.cancel = nil
+	}
+	return err
+}
+
+// Columns 返回结果的列名
+func (r *Rows) Columns() ([]string, error) {
+	if r.cols == nil {
+		cols, err := r.rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+		r.cols = cols
+	}
+	return r.cols, nil
+}
+
+// Scan 与 sql.Rows.Scan 相同
+func (r *Rows) Scan(dest ...interface{}) error {
+	return r.rows.Scan(dest...)
+}
+
+// ScanStruct 将当前行写入结构体指针 dest，规则与 FetchStruct 相同
+func (r *Rows) ScanStruct(dest interface{}) error {
+	v, err := structValue(dest)
+	if err != nil {
+		return err
+	}
+	return r.scanStruct(v)
+}
+
+func (r *Rows) scanStruct(v reflect.Value) error {
+	if r.scannerType != v.Type() {
+		cols, err := r.Columns()
+		if err != nil {
+			return err
+		}
+		s, err := newStructScanner(v.Type(), cols, r.loc)
+		if err != nil {
+			return err
+		}
+		r.scanner, r.scannerType = s, v.Type()
+	}
+	return r.scanner.scan(r.rows, v)
+}
+
+// ScanMap 返回当前行的 列名 => 值，NULL 为空字符串
+func (r *Rows) ScanMap() (RowMap, error) {
+	cols, err := r.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.RawBytes, len(cols))
+	scanArgs := make([]interface{}, len(cols))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	if err = r.rows.Scan(scanArgs...); err != nil {
+		return nil, err
+	}
+	rowMap := make(RowMap, len(cols))
+	for i, col := range cols {
+		rowMap[col] = string(values[i])
+	}
+	return rowMap, nil
+}
+
+// ForEachBatch 每读取 size 行调用一次 fn，最后不足 size 行也会调用，结束后关闭游标
+// fn 为 func([]T) error、func([]*T) error 或 func([]RowMap) error，T 为结构体
+// fn 返回错误时停止遍历并返回该错误，每批使用新的切片，fn 可以持有
+func (r *Rows) ForEachBatch(size int, fn interface{}) (err error) {
+	defer func() {
+		if cerr := r.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	fv := reflect.ValueOf(fn)
+	if !fv.IsValid() || fv.Kind() == reflect.Func && fv.IsNil() {
+		return fmt.Errorf("%w: nil fn", ErrInvalidDest)
+	}
+	ft := fv.Type()
+	if ft.Kind() != reflect.Func || ft.NumIn() != 1 || ft.In(0).Kind() != reflect.Slice ||
+		ft.NumOut() != 1 || ft.Out(0) != errorType {
+		return fmt.Errorf("%w: %T, need func([]T) error", ErrInvalidDest, fn)
+	}
+	if size <= 0 {
+		size = 1
+	}
+	sliceType := ft.In(0)
+	et := sliceType.Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	if et != rowMapType && et.Kind() != reflect.Struct || isPtr && et == rowMapType {
+		return fmt.Errorf("%w: %T, need func([]T) error", ErrInvalidDest, fn)
+	}
+
+	call := func(batch reflect.Value) error {
+		if out := fv.Call([]reflect.Value{batch})[0]; !out.IsNil() {
+			return out.Interface().(error)
+		}
+		return nil
+	}
+	batch := reflect.MakeSlice(sliceType, 0, size)
+	for r.Next() {
+		var ev reflect.Value
+		if et == rowMapType {
+			rowMap, err := r.ScanMap()
+			if err != nil {
+				return err
+			}
+			ev = reflect.ValueOf(rowMap)
+		} else {
+			ev = reflect.New(et)
+			if err = r.scanStruct(ev.Elem()); err != nil {
+				return err
+			}
+			if !isPtr {
+				ev = ev.Elem()
+			}
+		}
+		if batch = reflect.Append(batch, ev); batch.Len() == size {
+			if err = call(batch); err != nil {
+				return err
+			}
+			batch = reflect.MakeSlice(sliceType, 0, size)
+		}
+	}
+	if err = r.Err(); err != nil {
+		return err
+	}
+	if batch.Len() > 0 {
+		return call(batch)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type item struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func setItems(fdb *fakeDB, query string, n int) {
+	vals := make([][]driver.Value, n)
+	for i := range vals {
+		vals[i] = []driver.Value{int64(i + 1), []byte("n")}
+	}
+	fdb.setRows(query, []string{"id", "name"}, vals...)
+}
+
+func TestRows(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+	setItems(fdb, "SELECT `id`,`name` FROM `item` WHERE `id` > ?", 3)
+	fdb.setRows("SELECT 1", []string{"1"}, []driver.Value{[]byte("1")})
+
+	rows, err := conn.SelectRows(ctx, "item", []string{"id", "name"}, Where(Gt("id", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []item
+	for rows.Next() {
+		// 遍历过程中同一个 MySQL 上的其他查询不影响游标
+		if err := conn.Query(ctx, "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+		if one, err := conn.FetchOne(ctx); err != nil || one != "1" {
+			t.Fatal(one, err)
+		}
+		var it item
+		if err := rows.ScanStruct(&it); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, it)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []item{{1, "n"}, {2, "n"}, {3, "n"}}) {
+		t.Fatal(got)
+	}
+	rows.Close()
+
+	rows, _ = conn.QueryRows(ctx, "SELECT `id`,`name` FROM `item` WHERE `id` > ?", 0)
+	rows.Next()
+	if m, err := rows.ScanMap(); err != nil || !reflect.DeepEqual(m, RowMap{"id": "1", "name": "n"}) {
+		t.Fatal(m, err)
+	}
+	rows.Close()
+
+	if _, err := conn.SelectRows(ctx, "", []string{"id"}, nil); err != ErrEmptyTable {
+		t.Fatal(err)
+	}
+}
+
+func TestForEachBatch(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+	setItems(fdb, "SELECT items", 7)
+
+	var sizes []int
+	var last []*item
+	rows, _ := conn.QueryRows(ctx, "SELECT items")
+	err := rows.ForEachBatch(3, func(batch []*item) error {
+		sizes = append(sizes, len(batch))
+		last = batch
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(sizes, []int{3, 3, 1}) || last[0].ID != 7 {
+		t.Fatal(sizes, err)
+	}
+
+	var n int
+	rows, _ = conn.QueryRows(ctx, "SELECT items")
+	err = rows.ForEachBatch(2, func(batch []RowMap) error {
+		n += len(batch)
+		return nil
+	})
+	if err != nil || n != 7 {
+		t.Fatal(n, err)
+	}
+
+	var calls int
+	rows, _ = conn.QueryRows(ctx, "SELECT items")
+	err = rows.ForEachBatch(2, func(batch []item) error {
+		calls++
+		return errFake
+	})
+	if err != errFake || calls != 1 {
+		t.Fatal(calls, err)
+	}
+
+	for _, fn := range []interface{}{
+		func(batch []int) error { return nil },
+		func(batch []*RowMap) error { return nil },
+		func(batch []item) {},
+		"fn",
+		nil,
+		(func(batch []item) error)(nil),
+	} {
+		rows, _ = conn.QueryRows(ctx, "SELECT items")
+		if err = rows.ForEachBatch(2, fn); !errors.Is(err, ErrInvalidDest) {
+			t.Fatal(err)
+		}
+	}
+
+	fdb.setRows("SELECT unknown", []string{"nick"}, []driver.Value{[]byte("a")})
+	rows, _ = conn.QueryRows(ctx, "SELECT unknown")
+	if err = rows.ForEachBatch(2, func(batch []item) error { return nil }); !errors.Is(err, ErrUnknownColumn) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,119 @@
+// Package dmysql ...
+package dmysql
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/dup2X/gopkg/metrics"
+)
+
+const (
+	metricStmtCacheHit  = "mysql_stmt_cache_hit"
+	metricStmtCacheMiss = "mysql_stmt_cache_miss"
+)
+
+// stmtCache 按 sql 缓存预处理语句的 LRU，淘汰时关闭语句
+type stmtCache struct {
+	size int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type stmtEntry struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+func newStmtCache(size int) *stmtCache {
+	return &stmtCache{
+		size:  size,
+		ll:    list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get 返回缓存的语句，没有时在 db 上预处理并加入缓存
+func (c *stmtCache) get(ctx context.Context, db *sql.DB, query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	if e, ok := c.items[query]; ok {
+		c.ll.MoveToFront(e)
+		c.mu.Unlock()
+		metrics.Add(metricStmtCacheHit, 1)
+		return e.Value.(*stmtEntry).stmt, nil
+	}
+	c.mu.Unlock()
+	metrics.Add(metricStmtCacheMiss, 1)
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[query]; ok {
+		stmt.Close()
+		c.ll.MoveToFront(e)
+		return e.Value.(*stmtEntry).stmt, nil
+	}
+	c.items[query] = c.ll.PushFront(&stmtEntry{query: query, stmt: stmt})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		entry := e.Value.(*stmtEntry)
+		delete(c.items, entry.query)
+		entry.stmt.Close()
+	}
+	return stmt, nil
+}
+
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// close 关闭所有缓存的语句
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.items {
+		e.Value.(*stmtEntry).stmt.Close()
+	}
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+func nop() {}
+
+// prepare 返回预处理语句，使用完调用 release
+// 开启缓存时从缓存中获取，事务中通过 tx.Stmt 得到绑定事务的副本
+func (m *MySQL) prepare(ctx context.Context, sqlPattern string) (stmt *sql.Stmt, release func(), err error) {
+	if m.opt.stmtCacheSize <= 0 {
+		if m.tx != nil {
+			stmt, err = m.tx.PrepareContext(ctx, sqlPattern)
+		} else {
+			stmt, err = m.db.PrepareContext(ctx, sqlPattern)
+		}
+		if err != nil {
+			return nil, nop, err
+		}
+		return stmt, func() { stmt.Close() }, nil
+	}
+	if m.stmts == nil {
+		m.stmts = newStmtCache(m.opt.stmtCacheSize)
+	}
+	if stmt, err = m.stmts.get(ctx, m.db, sqlPattern); err != nil {
+		return nil, nop, err
+	}
+	if m.tx == nil {
+		return stmt, nop, nil
+	}
+	// 关闭事务副本不会关闭缓存中的语句
+	txStmt := m.tx.StmtContext(ctx, stmt)
+	return txStmt, func() { txStmt.Close() }, nil
+}
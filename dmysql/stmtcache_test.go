@@ -0,0 +1,51 @@
+package dmysql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	conn.opt.stmtCacheSize = 2
+	ctx := context.Background()
+
+	for _, q := range []string{"UPDATE a", "UPDATE a", "UPDATE b", "UPDATE c", "UPDATE a"} {
+		if err := conn.Execute(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exp := map[string]int{"UPDATE a": 2, "UPDATE b": 1, "UPDATE c": 1}
+	if !reflect.DeepEqual(fdb.prepared, exp) || conn.stmts.len() != 2 {
+		t.Fatal(fdb.prepared, conn.stmts.len())
+	}
+
+	err := conn.withTx(ctx, nil, func(tx *Tx) error {
+		if err := tx.Execute(ctx, "UPDATE a"); err != nil {
+			return err
+		}
+		_, err := tx.Insert(ctx, "t", map[string]interface{}{"x": 1})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 事务中的语句同样进入缓存，事务结束后缓存的语句仍然可用
+	if _, ok := conn.stmts.items["INSERT INTO `t`(`x`) VALUES(?)"]; !ok || conn.stmts.len() != 2 {
+		t.Fatal("tx stmt not cached")
+	}
+	if err := conn.Execute(ctx, "UPDATE a"); err != nil {
+		t.Fatal(err)
+	}
+	exp2 := []string{"UPDATE a", "UPDATE a", "UPDATE b", "UPDATE c", "UPDATE a",
+		"BEGIN", "UPDATE a", "INSERT INTO `t`(`x`) VALUES(?)", "COMMIT", "UPDATE a"}
+	if got := fdb.statements(); !reflect.DeepEqual(got, exp2) {
+		t.Fatal(got)
+	}
+
+	conn.stmts.close()
+	if conn.stmts.len() != 0 {
+		t.Fatal("cache not closed")
+	}
+}
@@ -0,0 +1,319 @@
+// Package dmysql ...
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+const structTag = "db"
+
+var (
+	// ErrUnknownColumn 结果中的列在结构体中没有对应的字段
+	ErrUnknownColumn = errors.New("column has no matching struct field")
+	// ErrInvalidDest 目标不是结构体指针或结构体切片指针
+	ErrInvalidDest = errors.New("invalid scan destination")
+
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+
+	structInfos sync.Map
+)
+
+// structField 结构体中与列对应的字段
+type structField struct {
+	name string
+	// index 字段在结构体中的路径，经过嵌入结构体时长度大于 1
+	index []int
+	// omitEmpty 写入时零值字段不出现在 sql 中
+	omitEmpty bool
+	// autoIncr 自增主键，写入时为零值则跳过，插入后回填
+	autoIncr bool
+	// primary 主键，UpdateStruct 的条件
+	primary bool
+}
+
+type structInfo struct {
+	fields   []*structField
+	byName   map[string]*structField
+	autoIncr *structField
+}
+
+// getStructInfo 解析结构体的 db tag，结果按类型缓存
+// 没有 tag 的字段使用字段名，tag 为 "-" 的字段忽略，未设置 tag 的嵌入结构体展开
+// tag 选项: omitempty 零值不写入，pk 主键，autoincr 自增主键
+func getStructInfo(t reflect.Type) *structInfo {
+	if v, ok := structInfos.Load(t); ok {
+		return v.(*structInfo)
+	}
+	info := &structInfo{byName: make(map[string]*structField)}
+	collectFields(info, t, nil)
+	for _, f := range info.fields {
+		if f.autoIncr && info.autoIncr == nil {
+			info.autoIncr = f
+		}
+	}
+	v, _ := structInfos.LoadOrStore(t, info)
+	return v.(*structInfo)
+}
+
+func collectFields(info *structInfo, t reflect.Type, parent []int) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get(structTag)
+		if tag == "-" {
+			continue
+		}
+		index := make([]int, len(parent)+1)
+		copy(index, parent)
+		index[len(parent)] = i
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct && !isScalarStruct(ft) {
+			collectFields(info, ft, index)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		// 外层字段优先于嵌入结构体中的同名字段
+		if old, ok := info.byName[name]; ok && len(old.index) <= len(index) {
+			continue
+		}
+		sf := &structField{name: name, index: index}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				sf.omitEmpty = true
+			case "pk":
+				sf.primary = true
+			case "autoincr":
+				sf.autoIncr, sf.primary = true, true
+			}
+		}
+		if old, ok := info.byName[name]; ok {
+			// 被外层同名字段覆盖
+			for i, f := range info.fields {
+				if f == old {
+					info.fields = append(info.fields[:i], info.fields[i+1:]...)
+					break
+				}
+			}
+		}
+		info.byName[name] = sf
+		info.fields = append(info.fields, sf)
+	}
+}
+
+// isScalarStruct 作为单个列处理的结构体，如 time.Time、sql.NullString
+func isScalarStruct(t reflect.Type) bool {
+	return t == timeType || reflect.PtrTo(t).Implements(scannerType)
+}
+
+// fieldByIndex 返回 index 对应的字段，路径上为 nil 的嵌入结构体指针会被分配
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// structScanner 按列顺序生成 Scan 的参数
+type structScanner struct {
+	fields []*structField
+	loc    *time.Location
+}
+
+func newStructScanner(t reflect.Type, cols []string, loc *time.Location) (*structScanner, error) {
+	info := getStructInfo(t)
+	s := &structScanner{fields: make([]*structField, len(cols)), loc: loc}
+	for i, col := range cols {
+		f, ok := info.byName[col]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q in %s", ErrUnknownColumn, col, t)
+		}
+		s.fields[i] = f
+	}
+	return s, nil
+}
+
+// scan 将当前行写入结构体 v
+func (s *structScanner) scan(rows *sql.Rows, v reflect.Value) error {
+	args := make([]interface{}, len(s.fields))
+	for i, f := range s.fields {
+		fv := fieldByIndex(v, f.index)
+		switch {
+		case fv.Type() == timeType:
+			args[i] = &timeScanner{dest: fv, loc: s.loc}
+		case fv.Kind() == reflect.Ptr && fv.Type().Elem() == timeType:
+			args[i] = &timeScanner{dest: fv, loc: s.loc, nullable: true}
+		default:
+			// 其余类型(含 sql.Scanner、sql.Null*、指针)交给 database/sql 转换
+			args[i] = fv.Addr().Interface()
+		}
+	}
+	return rows.Scan(args...)
+}
+
+// timeScanner 支持 parseTime=false 时驱动返回的 []byte 时间
+type timeScanner struct {
+	dest     reflect.Value
+	loc      *time.Location
+	nullable bool
+}
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+	"15:04:05",
+}
+
+func (ts *timeScanner) Scan(src interface{}) error {
+	var t time.Time
+	switch v := src.(type) {
+	case nil:
+		if !ts.nullable {
+			return errors.New("converting NULL to time.Time is unsupported")
+		}
+		ts.dest.Set(reflect.Zero(ts.dest.Type()))
+		return nil
+	case time.Time:
+		t = v
+	case []byte:
+		return ts.Scan(string(v))
+	case string:
+		if v == "0000-00-00" || v == "0000-00-00 00:00:00" {
+			break
+		}
+		var err error
+		for _, layout := range timeLayouts {
+			if t, err = time.ParseInLocation(layout, v, ts.loc); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("converting %q to time.Time: %v", v, err)
+		}
+	default:
+		return fmt.Errorf("unsupported Scan, storing %T into time.Time", src)
+	}
+	if ts.nullable {
+		ts.dest.Set(reflect.ValueOf(&t))
+	} else {
+		ts.dest.Set(reflect.ValueOf(t))
+	}
+	return nil
+}
+
+// location 返回 WithLoc 设置的时区，默认与驱动一致为 UTC
+func (o *connectionOption) location() *time.Location {
+	o.locOnce.Do(func() {
+		o.tz = time.UTC
+		if o.loc == "" {
+			return
+		}
+		name, err := url.QueryUnescape(o.loc)
+		if err != nil {
+			name = o.loc
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			o.tz = loc
+		}
+	})
+	return o.tz
+}
+
+// FetchStruct 将查询结果的第一行写入结构体指针 dest，并关闭结果，没有结果时返回 ErrMissMatchRow
+// 按 db tag 匹配列，列没有对应字段或类型转换失败时返回错误
+func (m *MySQL) FetchStruct(ctx context.Context, dest interface{}) (err error) {
+	defer m.closeRows()
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T, need struct pointer", ErrInvalidDest, dest)
+	}
+	if m.rows == nil {
+		return ErrMissMatchRow
+	}
+	cols, err := m.rows.Columns()
+	if err != nil {
+		return err
+	}
+	s, err := newStructScanner(v.Elem().Type(), cols, m.opt.location())
+	if err != nil {
+		return err
+	}
+	if !m.rows.Next() {
+		if err = m.endRows(ctx); err != io.EOF {
+			return err
+		}
+		return ErrMissMatchRow
+	}
+	return s.scan(m.rows, v.Elem())
+}
+
+// FetchAllStructs 将查询结果全部追加到 dest，dest 为 *[]T 或 *[]*T
+func (m *MySQL) FetchAllStructs(ctx context.Context, dest interface{}) (err error) {
+	defer m.closeRows()
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: %T, need slice pointer", ErrInvalidDest, dest)
+	}
+	slice := v.Elem()
+	et := slice.Type().Elem()
+	isPtr := et.Kind() == reflect.Ptr
+	if isPtr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T, need slice of struct", ErrInvalidDest, dest)
+	}
+	if m.rows == nil {
+		return nil
+	}
+	cols, err := m.rows.Columns()
+	if err != nil {
+		return err
+	}
+	s, err := newStructScanner(et, cols, m.opt.location())
+	if err != nil {
+		return err
+	}
+	for m.rows.Next() {
+		ev := reflect.New(et)
+		if err = s.scan(m.rows, ev.Elem()); err != nil {
+			return err
+		}
+		if isPtr {
+			slice = reflect.Append(slice, ev)
+		} else {
+			slice = reflect.Append(slice, ev.Elem())
+		}
+	}
+	v.Elem().Set(slice)
+	if err = m.endRows(ctx); err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type upperString string
+
+func (s *upperString) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("upperString: %T", src)
+	}
+	*s = upperString(strings.ToUpper(string(b)))
+	return nil
+}
+
+type Base struct {
+	ID    uint64    `db:"id"`
+	Ctime time.Time `db:"ctime"`
+}
+
+type Extra struct {
+	Remark string `db:"remark"`
+}
+
+type user struct {
+	Base
+	*Extra
+	Name    string         `db:"name"`
+	Age     int8           `db:"age"`
+	Vip     bool           `db:"vip"`
+	Email   sql.NullString `db:"email"`
+	Score   *float64       `db:"score"`
+	Login   *time.Time     `db:"login"`
+	Code    upperString    `db:"code"`
+	Ignored string         `db:"-"`
+	private string
+}
+
+func fetchConn(t *testing.T) (*MySQL, *fakeDB) {
+	mgr, fdb := newFakeManager(t, 1)
+	conn, _ := mgr.Get()
+	t.Cleanup(func() { mgr.Put(conn) })
+	return conn, fdb
+}
+
+func TestFetchStruct(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+	cols := []string{"id", "ctime", "remark", "name", "age", "vip", "email", "score", "login", "code"}
+	fdb.setRows("SELECT u", cols,
+		[]driver.Value{[]byte("18446744073709551615"), []byte("2020-01-02 03:04:05"), []byte("r"), []byte("tom"),
+			[]byte("-3"), []byte("1"), nil, []byte("1.5"), time.Unix(100, 0), []byte("ab")},
+		[]driver.Value{[]byte("2"), []byte("2020-01-02"), []byte(""), []byte("jack"),
+			[]byte("4"), []byte("0"), []byte("a@b"), nil, nil, []byte("cd")},
+	)
+
+	var u user
+	if err := conn.Query(ctx, "SELECT u"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.FetchStruct(ctx, &u); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 18446744073709551615 || u.Name != "tom" || u.Age != -3 || !u.Vip || u.Email.Valid ||
+		u.Score == nil || *u.Score != 1.5 || u.Login == nil || !u.Login.Equal(time.Unix(100, 0)) ||
+		u.Code != "AB" || u.Extra == nil || u.Remark != "r" ||
+		!u.Ctime.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("%+v", u)
+	}
+	if conn.rows != nil {
+		t.Fatal("rows not closed")
+	}
+	if err := conn.FetchStruct(ctx, &u); err != ErrMissMatchRow {
+		t.Fatal(err)
+	}
+
+	var us []*user
+	conn.Query(ctx, "SELECT u")
+	if err := conn.FetchAllStructs(ctx, &us); err != nil {
+		t.Fatal(err)
+	}
+	if len(us) != 2 || us[1].Email.String != "a@b" || us[1].Score != nil || us[1].Login != nil || us[1].Vip ||
+		us[1].Ctime.Day() != 2 {
+		t.Fatalf("%+v", us)
+	}
+
+	var vs []user
+	conn.Query(ctx, "SELECT nothing")
+	if err := conn.FetchAllStructs(ctx, &vs); err != nil || len(vs) != 0 {
+		t.Fatal(vs, err)
+	}
+}
+
+func TestFetchStructError(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+	fdb.setRows("SELECT unknown", []string{"name", "nick"}, []driver.Value{[]byte("tom"), []byte("t")})
+	fdb.setRows("SELECT overflow", []string{"age"}, []driver.Value{[]byte("300")})
+	fdb.setRows("SELECT null", []string{"name"}, []driver.Value{nil})
+	fdb.setRows("SELECT time", []string{"ctime"}, []driver.Value{[]byte("yesterday")})
+
+	var u user
+	conn.Query(ctx, "SELECT unknown")
+	if err := conn.FetchStruct(ctx, &u); !errors.Is(err, ErrUnknownColumn) {
+		t.Fatal(err)
+	}
+	for _, q := range []string{"SELECT overflow", "SELECT null", "SELECT time"} {
+		conn.Query(ctx, q)
+		if err := conn.FetchStruct(ctx, &u); err == nil || err == ErrMissMatchRow {
+			t.Fatal(q, err)
+		}
+	}
+	if err := conn.FetchStruct(ctx, u); !errors.Is(err, ErrInvalidDest) {
+		t.Fatal(err)
+	}
+	if err := conn.FetchAllStructs(ctx, &[]int{}); !errors.Is(err, ErrInvalidDest) {
+		t.Fatal(err)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	if loc := (&connectionOption{loc: "Asia%2FShanghai"}).location(); loc.String() != "Asia/Shanghai" {
+		t.Fatal(loc)
+	}
+	if loc := (&connectionOption{}).location(); loc != time.UTC {
+		t.Fatal(loc)
+	}
+}
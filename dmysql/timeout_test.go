@@ -0,0 +1,78 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/ctxutil"
+)
+
+func TestContextTimeout(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 1)
+	conn, _ := mgr.Get()
+	defer mgr.Put(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	if err := conn.Execute(ctx, "UPDATE t SET a = 1"); err != ErrTimeout {
+		t.Fatal(err)
+	}
+	if err := conn.Query(ctx, "SELECT 1"); err != ErrTimeout {
+		t.Fatal(err)
+	}
+	if _, err := conn.Insert(ctx, "t", map[string]interface{}{"a": 1}); err != ErrTimeout {
+		t.Fatal(err)
+	}
+	if got := fdb.statements(); len(got) != 0 {
+		t.Fatal(got)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := conn.Execute(canceled, "UPDATE t SET a = 1"); err != context.Canceled {
+		t.Fatal(err)
+	}
+}
+
+func TestSLATimeout(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 2)
+	conn, _ := mgr.Get()
+	defer mgr.Put(conn)
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	spent := ctxutil.SetRequestTimeout(ctxutil.SetRequestInTs(context.Background(), now-200), 100)
+	if err := conn.Execute(spent, "UPDATE t SET a = 1"); err != ErrTimeout {
+		t.Fatal(err)
+	}
+	if err := conn.Begin(spent); err != ErrTimeout || conn.tx != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.WithTx(spent, nil, func(tx *Tx) error { return nil }); err != ErrTimeout {
+		t.Fatal(err)
+	}
+	if got := fdb.statements(); len(got) != 0 {
+		t.Fatal(got)
+	}
+
+	ctx := ctxutil.SetRequestTimeout(ctxutil.SetRequestInTs(context.Background(), now), 60000)
+	fctx, _, err := withDeadline(ctx)
+	if d, ok := fctx.Deadline(); err != nil || !ok || d.After(time.Now().Add(time.Minute)) {
+		t.Fatal(d, ok, err)
+	}
+	early, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if fctx, _, _ = withDeadline(early); fctx != early {
+		t.Fatal("ctx deadline should win")
+	}
+
+	fdb.setRows("SELECT a FROM t", []string{"a"}, []driver.Value{"1"})
+	if err := conn.Query(ctx, "SELECT a FROM t"); err != nil || conn.cancel == nil {
+		t.Fatal(err)
+	}
+	if all, err := conn.FetchAll(ctx); err != nil || len(all) != 1 || conn.cancel != nil {
+		t.Fatal(all, err)
+	}
+}
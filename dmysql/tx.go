@@ -0,0 +1,253 @@
+// Package dmysql ...
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTxManaged WithTx 中的事务由 WithTx 负责提交和回滚
+	ErrTxManaged = errors.New("transaction is managed by WithTx")
+	// ErrInTransaction 连接上已经有未结束的事务
+	ErrInTransaction = errors.New("connection already in transaction")
+)
+
+// Tx WithTx 中使用的事务连接，只提供查询和写入方法，事务由 WithTx 和 Savepoint 控制
+type Tx struct {
+	m *MySQL
+	// savepoint 嵌套深度
+	depth int
+}
+
+// WithTx 从连接池取出连接并开启事务，fn 返回 nil 时提交，返回错误或 panic 时回滚
+// opts 可以为 nil，连接总会归还到连接池
+func (mgr *Manager) WithTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	conn, err := mgr.Get()
+	if err != nil {
+		return err
+	}
+	defer mgr.Put(conn)
+	return conn.withTx(ctx, opts, fn)
+}
+
+func (m *MySQL) withTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *Tx) error) (err error) {
+	if m.tx != nil {
+		return ErrInTransaction
+	}
+	m.closeRows()
+	if _, err = slaDeadline(ctx); err != nil {
+		return err
+	}
+	if m.tx, err = m.db.BeginTx(ctx, opts); err != nil {
+		m.tx = nil
+		return timeoutError(ctx, err)
+	}
+	tx := &Tx{m: m}
+	defer func() {
+		m.closeRows()
+		sqlTx := m.tx
+		m.tx = nil
+		if r := recover(); r != nil {
+			sqlTx.Rollback()
+			panic(r)
+		}
+		if err != nil {
+			sqlTx.Rollback()
+			return
+		}
+		err = sqlTx.Commit()
+	}()
+	return fn(tx)
+}
+
+// Savepoint 在当前事务中开启一个 savepoint，fn 返回错误或 panic 时只回滚到 savepoint
+// fn 返回的错误会继续返回给调用方，由调用方决定是否回滚整个事务
+func (tx *Tx) Savepoint(ctx context.Context, fn func(tx *Tx) error) (err error) {
+	if tx.m.tx == nil {
+		return ErrNilTransaction
+	}
+	name := fmt.Sprintf("sp_%d", tx.depth+1)
+	if _, err = tx.m.tx.ExecContext(ctx, "SAVEPOINT "+name); err != nil {
+		return err
+	}
+	tx.depth++
+	defer func() {
+		tx.depth--
+		if r := recover(); r != nil {
+			tx.m.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			panic(r)
+		}
+		if err != nil {
+			tx.m.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+name)
+			return
+		}
+		_, err = tx.m.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+name)
+	}()
+	return fn(tx)
+}
+
+// Begin 返回 ErrTxManaged，嵌套事务使用 Savepoint
+func (tx *Tx) Begin(ctx context.Context) error {
+	return ErrTxManaged
+}
+
+// Commit 返回 ErrTxManaged，fn 返回 nil 时自动提交
+func (tx *Tx) Commit(ctx context.Context) error {
+	return ErrTxManaged
+}
+
+// RollBack 返回 ErrTxManaged，fn 返回错误时自动回滚
+func (tx *Tx) RollBack(ctx context.Context) error {
+	return ErrTxManaged
+}
+
+// Close 返回 ErrTxManaged，连接由 WithTx 归还到连接池
+func (tx *Tx) Close() error {
+	return ErrTxManaged
+}
+
+// 以下方法转发到事务所在的连接，与 MySQL 的同名方法相同
+
+// Execute 同 MySQL.Execute
+func (tx *Tx) Execute(ctx context.Context, sqlPattern string, args ...interface{}) error {
+	return tx.m.Execute(ctx, sqlPattern, args...)
+}
+
+// Query 同 MySQL.Query
+func (tx *Tx) Query(ctx context.Context, sqlPattern string, args ...interface{}) error {
+	return tx.m.Query(ctx, sqlPattern, args...)
+}
+
+// QueryRows 同 MySQL.QueryRows
+func (tx *Tx) QueryRows(ctx context.Context, sqlPattern string, args ...interface{}) (*Rows, error) {
+	return tx.m.QueryRows(ctx, sqlPattern, args...)
+}
+
+// Insert 同 MySQL.Insert
+func (tx *Tx) Insert(ctx context.Context, table string, kvPairs map[string]interface{}) (int64, error) {
+	return tx.m.Insert(ctx, table, kvPairs)
+}
+
+// MultiInsert 同 MySQL.MultiInsert
+func (tx *Tx) MultiInsert(ctx context.Context, table string, batchData []map[string]interface{}) (int64, error) {
+	return tx.m.MultiInsert(ctx, table, batchData)
+}
+
+// Upsert 同 MySQL.Upsert
+func (tx *Tx) Upsert(ctx context.Context, table string, data map[string]interface{}, updateKeys []string) (int64, error) {
+	return tx.m.Upsert(ctx, table, data, updateKeys)
+}
+
+// Update 同 MySQL.Update
+func (tx *Tx) Update(ctx context.Context, table string, updator map[string]interface{}, condPattern string,
+	condArgs ...interface{}) (int64, error) {
+	return tx.m.Update(ctx, table, updator, condPattern, condArgs...)
+}
+
+// Delete 同 MySQL.Delete
+func (tx *Tx) Delete(ctx context.Context, table string, condPattern string, condArgs ...interface{}) (int64, error) {
+	return tx.m.Delete(ctx, table, condPattern, condArgs...)
+}
+
+// Select 同 MySQL.Select
+func (tx *Tx) Select(ctx context.Context, table string, fields []string, condPattern string, condArgs ...interface{}) error {
+	return tx.m.Select(ctx, table, fields, condPattern, condArgs...)
+}
+
+// SelectWhere 同 MySQL.SelectWhere
+func (tx *Tx) SelectWhere(ctx context.Context, table string, fields []string, clause *Clause) error {
+	return tx.m.SelectWhere(ctx, table, fields, clause)
+}
+
+// SelectRows 同 MySQL.SelectRows
+func (tx *Tx) SelectRows(ctx context.Context, table string, fields []string, clause *Clause) (*Rows, error) {
+	return tx.m.SelectRows(ctx, table, fields, clause)
+}
+
+// UpdateWhere 同 MySQL.UpdateWhere
+func (tx *Tx) UpdateWhere(ctx context.Context, table string, updator map[string]interface{}, clause *Clause) (int64, error) {
+	return tx.m.UpdateWhere(ctx, table, updator, clause)
+}
+
+// DeleteWhere 同 MySQL.DeleteWhere
+func (tx *Tx) DeleteWhere(ctx context.Context, table string, clause *Clause) (int64, error) {
+	return tx.m.DeleteWhere(ctx, table, clause)
+}
+
+// InsertStruct 同 MySQL.InsertStruct
+func (tx *Tx) InsertStruct(ctx context.Context, table string, v interface{}) (int64, error) {
+	return tx.m.InsertStruct(ctx, table, v)
+}
+
+// UpsertStruct 同 MySQL.UpsertStruct
+func (tx *Tx) UpsertStruct(ctx context.Context, table string, v interface{}, updateKeys ...string) (int64, error) {
+	return tx.m.UpsertStruct(ctx, table, v, updateKeys...)
+}
+
+// UpdateStruct 同 MySQL.UpdateStruct
+func (tx *Tx) UpdateStruct(ctx context.Context, table string, v interface{}) (int64, error) {
+	return tx.m.UpdateStruct(ctx, table, v)
+}
+
+// MultiInsertStructs 同 MySQL.MultiInsertStructs
+func (tx *Tx) MultiInsertStructs(ctx context.Context, table string, rows interface{}) (int64, error) {
+	return tx.m.MultiInsertStructs(ctx, table, rows)
+}
+
+// FetchRow 同 MySQL.FetchRow
+func (tx *Tx) FetchRow(ctx context.Context) (Row, error) {
+	return tx.m.FetchRow(ctx)
+}
+
+// FetchOneRow 同 MySQL.FetchOneRow
+func (tx *Tx) FetchOneRow(ctx context.Context) (Row, error) {
+	return tx.m.FetchOneRow(ctx)
+}
+
+// FetchOne 同 MySQL.FetchOne
+func (tx *Tx) FetchOne(ctx context.Context) (string, error) {
+	return tx.m.FetchOne(ctx)
+}
+
+// FetchAll 同 MySQL.FetchAll
+func (tx *Tx) FetchAll(ctx context.Context) ([]Row, error) {
+	return tx.m.FetchAll(ctx)
+}
+
+// FetchRowMap 同 MySQL.FetchRowMap
+func (tx *Tx) FetchRowMap(ctx context.Context) (RowMap, error) {
+	return tx.m.FetchRowMap(ctx)
+}
+
+// FetchRowMapInterface 同 MySQL.FetchRowMapInterface
+func (tx *Tx) FetchRowMapInterface(ctx context.Context) (map[string]interface{}, error) {
+	return tx.m.FetchRowMapInterface(ctx)
+}
+
+// FetchAllMap 同 MySQL.FetchAllMap
+func (tx *Tx) FetchAllMap(ctx context.Context) ([]RowMap, error) {
+	return tx.m.FetchAllMap(ctx)
+}
+
+// FetchStruct 同 MySQL.FetchStruct
+func (tx *Tx) FetchStruct(ctx context.Context, dest interface{}) error {
+	return tx.m.FetchStruct(ctx, dest)
+}
+
+// FetchAllStructs 同 MySQL.FetchAllStructs
+func (tx *Tx) FetchAllStructs(ctx context.Context, dest interface{}) error {
+	return tx.m.FetchAllStructs(ctx, dest)
+}
+
+// LastInsertID 同 MySQL.LastInsertID
+func (tx *Tx) LastInsertID(ctx context.Context) int64 {
+	return tx.m.LastInsertID(ctx)
+}
+
+// AffectRows 同 MySQL.AffectRows
+func (tx *Tx) AffectRows(ctx context.Context) int64 {
+	return tx.m.AffectRows(ctx)
+}
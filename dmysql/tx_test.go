@@ -0,0 +1,136 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestWithTx(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 1)
+	ctx := context.Background()
+
+	err := mgr.WithTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *Tx) error {
+		if _, err := tx.Insert(ctx, "t", map[string]interface{}{"a": 1}); err != nil {
+			return err
+		}
+		return tx.Commit(ctx)
+	})
+	if err != ErrTxManaged {
+		t.Fatal(err)
+	}
+	if len(mgr.pool) != 1 {
+		t.Fatal("conn not returned")
+	}
+
+	err = mgr.WithTx(ctx, &sql.TxOptions{ReadOnly: true}, func(tx *Tx) error {
+		return tx.Select(ctx, "t", []string{"*"}, "")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"BEGIN Serializable",
+		"INSERT INTO `t`(`a`) VALUES(?)",
+		"ROLLBACK",
+		"BEGIN READ ONLY",
+		"SELECT * FROM `t`",
+		"COMMIT",
+	}
+	if got := fdb.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(got)
+	}
+}
+
+func TestWithTxPanic(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 1)
+	ctx := context.Background()
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatal(r)
+			}
+		}()
+		mgr.WithTx(ctx, nil, func(tx *Tx) error {
+			panic("boom")
+		})
+	}()
+	if got := fdb.statements(); !reflect.DeepEqual(got, []string{"BEGIN", "ROLLBACK"}) {
+		t.Fatal(got)
+	}
+	conn, err := mgr.Get()
+	if err != nil || conn.tx != nil {
+		t.Fatal("conn not reset", err)
+	}
+	mgr.Put(conn)
+}
+
+func TestSavepoint(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 1)
+	ctx := context.Background()
+	err := mgr.WithTx(ctx, nil, func(tx *Tx) error {
+		err := tx.Savepoint(ctx, func(tx *Tx) error {
+			return tx.Savepoint(ctx, func(tx *Tx) error {
+				return errFake
+			})
+		})
+		if err != errFake {
+			t.Fatal(err)
+		}
+		return tx.Savepoint(ctx, func(tx *Tx) error { return nil })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"BEGIN",
+		"SAVEPOINT sp_1",
+		"SAVEPOINT sp_2",
+		"ROLLBACK TO SAVEPOINT sp_2",
+		"ROLLBACK TO SAVEPOINT sp_1",
+		"SAVEPOINT sp_1",
+		"RELEASE SAVEPOINT sp_1",
+		"COMMIT",
+	}
+	if got := fdb.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(got)
+	}
+}
+
+func TestWithTxBeginError(t *testing.T) {
+	mgr, fdb := newFakeManager(t, 1)
+	fdb.setErr("BEGIN", errFake)
+	if err := mgr.WithTx(context.Background(), nil, func(tx *Tx) error { return nil }); err != errFake {
+		t.Fatal(err)
+	}
+	if len(mgr.pool) != 1 {
+		t.Fatal("conn not returned")
+	}
+}
+
+func TestTxHidesConn(t *testing.T) {
+	typ := reflect.TypeOf(Tx{})
+	for i := 0; i < typ.NumField(); i++ {
+		if f := typ.Field(i); f.PkgPath == "" || f.Anonymous {
+			t.Fatalf("Tx exposes field %s", f.Name)
+		}
+	}
+	// 转发的方法与 MySQL 的签名一致
+	txType, mType := reflect.TypeOf(&Tx{}), reflect.TypeOf(&MySQL{})
+	for i := 0; i < txType.NumMethod(); i++ {
+		m := txType.Method(i)
+		if m.Name == "Savepoint" {
+			continue
+		}
+		mm, ok := mType.MethodByName(m.Name)
+		if !ok || mm.Type.NumIn() != m.Type.NumIn() || mm.Type.NumOut() != m.Type.NumOut() {
+			t.Fatalf("Tx.%s does not match MySQL.%s", m.Name, m.Name)
+		}
+		for j := 1; j < m.Type.NumIn(); j++ {
+			if m.Type.In(j) != mm.Type.In(j) {
+				t.Fatalf("Tx.%s arg %d mismatch", m.Name, j)
+			}
+		}
+	}
+}
@@ -0,0 +1,405 @@
+// Package dmysql ...
+package dmysql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMaxAllowedPacket 无法查询 max_allowed_packet 时使用 MySQL 5.7 的默认值
+	defaultMaxAllowedPacket = 4 << 20
+	// packetReserved 为协议头等预留的字节数
+	packetReserved = 1 << 10
+	// maxPlaceholders 预处理语句最多支持的参数个数
+	maxPlaceholders = 65535
+)
+
+// ErrNoPrimaryKey 结构体没有 pk 或 autoincr 字段
+var ErrNoPrimaryKey = errors.New("struct has no primary key field")
+
+// structRow 结构体中需要写入的列和值
+type structRow struct {
+	cols []string
+	vals []interface{}
+	// auto 零值的自增主键，插入后回填
+	auto reflect.Value
+}
+
+// lookupField 返回 index 对应的字段，路径上有 nil 的嵌入结构体指针时返回 false
+func lookupField(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// newStructRow 按字段顺序取出需要写入的列，跳过零值的 omitempty 字段和自增主键
+func newStructRow(info *structInfo, v reflect.Value) *structRow {
+	row := &structRow{}
+	for _, f := range info.fields {
+		fv, ok := lookupField(v, f.index)
+		if !ok {
+			continue
+		}
+		if f.autoIncr && fv.IsZero() {
+			if f == info.autoIncr {
+				row.auto = fv
+			}
+			continue
+		}
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		row.cols = append(row.cols, f.name)
+		row.vals = append(row.vals, fv.Interface())
+	}
+	return row
+}
+
+// structValue 返回 dest 指向的结构体
+func structValue(dest interface{}) (reflect.Value, error) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("%w: %T, need struct pointer", ErrInvalidDest, dest)
+	}
+	return v.Elem(), nil
+}
+
+// setAutoIncr 回填自增主键
+func setAutoIncr(v reflect.Value, id int64) {
+	if !v.IsValid() || id <= 0 {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if !v.OverflowInt(id) {
+			v.SetInt(id)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if !v.OverflowUint(uint64(id)) {
+			v.SetUint(uint64(id))
+		}
+	}
+}
+
+func insertPrefix(verb, tabName string, cols []string) (string, error) {
+	keyStr, err := quoteIdents(cols)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s(%s) VALUES ", verb, tabName, keyStr), nil
+}
+
+func placeholders(n int) string {
+	return "(" + strings.Repeat("?,", n-1) + "?)"
+}
+
+// InsertStruct 按 db tag 插入结构体指针 v，插入后回填零值的自增主键
+func (m *MySQL) InsertStruct(ctx context.Context, table string, v interface{}) (lastID int64, err error) {
+	sv, err := structValue(v)
+	if err != nil {
+		return -1, err
+	}
+	row := newStructRow(getStructInfo(sv.Type()), sv)
+	if len(row.cols) == 0 {
+		return -1, ErrEmptyValues
+	}
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	prefix, err := insertPrefix("INSERT INTO", tabName, row.cols)
+	if err != nil {
+		return -1, err
+	}
+	if err = m.Execute(ctx, prefix+placeholders(len(row.cols)), row.vals...); err != nil {
+		return -1, err
+	}
+	lastID = m.LastInsertID(ctx)
+	setAutoIncr(row.auto, lastID)
+	return lastID, nil
+}
+
+// UpsertStruct 插入结构体指针 v，主键或唯一键冲突时更新 updateKeys 指定的列
+// updateKeys 为空时更新除主键外所有写入的列，插入或更新后都会回填自增主键
+func (m *MySQL) UpsertStruct(ctx context.Context, table string, v interface{}, updateKeys ...string) (lastID int64, err error) {
+	sv, err := structValue(v)
+	if err != nil {
+		return -1, err
+	}
+	info := getStructInfo(sv.Type())
+	row := newStructRow(info, sv)
+	if len(row.cols) == 0 {
+		return -1, ErrEmptyValues
+	}
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	prefix, err := insertPrefix("INSERT INTO", tabName, row.cols)
+	if err != nil {
+		return -1, err
+	}
+	if len(updateKeys) == 0 {
+		for _, col := range row.cols {
+			if !info.byName[col].primary {
+				updateKeys = append(updateKeys, col)
+			}
+		}
+	}
+	var updates []string
+	for _, k := range updateKeys {
+		if k, err = quoteIdent(k); err != nil {
+			return -1, err
+		}
+		updates = append(updates, fmt.Sprintf("%s = VALUES(%s)", k, k))
+	}
+	// 更新时 LastInsertId 返回已存在行的自增主键
+	if info.autoIncr != nil {
+		k, err := quoteIdent(info.autoIncr.name)
+		if err != nil {
+			return -1, err
+		}
+		updates = append(updates, fmt.Sprintf("%s = LAST_INSERT_ID(%s)", k, k))
+	}
+	sqlPattern := prefix + placeholders(len(row.cols))
+	if len(updates) > 0 {
+		sqlPattern += " ON DUPLICATE KEY UPDATE " + strings.Join(updates, ",")
+	}
+	if err = m.Execute(ctx, sqlPattern, row.vals...); err != nil {
+		return -1, err
+	}
+	lastID = m.LastInsertID(ctx)
+	setAutoIncr(row.auto, lastID)
+	return lastID, nil
+}
+
+// UpdateStruct 按主键(pk、autoincr 字段)更新结构体指针 v 的其余列，零值的 omitempty 字段不更新
+func (m *MySQL) UpdateStruct(ctx context.Context, table string, v interface{}) (affect int64, err error) {
+	sv, err := structValue(v)
+	if err != nil {
+		return -1, err
+	}
+	var (
+		info  = getStructInfo(sv.Type())
+		sets  []string
+		conds []string
+		vals  []interface{}
+		args  []interface{}
+	)
+	for _, f := range info.fields {
+		fv, ok := lookupField(sv, f.index)
+		if !ok {
+			continue
+		}
+		quoted, err := quoteIdent(f.name)
+		if err != nil {
+			return -1, err
+		}
+		switch {
+		case f.primary:
+			conds = append(conds, quoted+" = ?")
+			args = append(args, fv.Interface())
+		case f.omitEmpty && fv.IsZero():
+		default:
+			sets = append(sets, quoted+"=?")
+			vals = append(vals, fv.Interface())
+		}
+	}
+	if len(conds) == 0 {
+		return -1, ErrNoPrimaryKey
+	}
+	if len(sets) == 0 {
+		return -1, ErrEmptyValues
+	}
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	sqlPattern := fmt.Sprintf("UPDATE %s SET %s WHERE %s", tabName, strings.Join(sets, ","), strings.Join(conds, " AND "))
+	if err = m.Execute(ctx, sqlPattern, append(vals, args...)...); err != nil {
+		return -1, err
+	}
+	return m.AffectRows(ctx), nil
+}
+
+// MultiInsertStructs 批量插入结构体，rows 为 []T 或 []*T，返回第一条语句的 LastInsertId
+// 写入列不同的行(omitempty、自增主键)分到不同的语句，单条语句超过 max_allowed_packet
+// 或参数超过 65535 个时自动拆分。多条语句不是原子的，需要时在事务中调用
+// 回填自增主键依赖同一语句的自增值连续(auto_increment_increment=1 且 innodb_autoinc_lock_mode 不为 2)
+func (m *MySQL) MultiInsertStructs(ctx context.Context, table string, rows interface{}) (lastID int64, err error) {
+	rv := reflect.ValueOf(rows)
+	if rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Slice {
+		return -1, fmt.Errorf("%w: %T, need slice of struct", ErrInvalidDest, rows)
+	}
+	if rv.Len() == 0 {
+		return -1, ErrEmptyValues
+	}
+	et := rv.Type().Elem()
+	if et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	if et.Kind() != reflect.Struct {
+		return -1, fmt.Errorf("%w: %T, need slice of struct", ErrInvalidDest, rows)
+	}
+	tabName, err := wrapTable(table)
+	if err != nil {
+		return -1, err
+	}
+	info := getStructInfo(et)
+
+	// 按写入的列分组，保持行的相对顺序
+	var (
+		groups [][]*structRow
+		byCols = make(map[string]int)
+	)
+	for i := 0; i < rv.Len(); i++ {
+		ev := rv.Index(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				return -1, fmt.Errorf("%w: nil element at %d", ErrInvalidDest, i)
+			}
+			ev = ev.Elem()
+		}
+		row := newStructRow(info, ev)
+		if len(row.cols) == 0 {
+			return -1, ErrEmptyValues
+		}
+		key := strings.Join(row.cols, ",")
+		g, ok := byCols[key]
+		if !ok {
+			g = len(groups)
+			byCols[key] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], row)
+	}
+
+	maxPacket := m.maxAllowedPacket(ctx)
+	lastID = -1
+	for _, group := range groups {
+		prefix, err := insertPrefix("INSERT INTO", tabName, group[0].cols)
+		if err != nil {
+			return -1, err
+		}
+		for _, batch := range splitRows(group, len(prefix), maxPacket) {
+			var (
+				sqlPattern = bytes.NewBufferString(prefix)
+				values     = make([]interface{}, 0, len(batch)*len(batch[0].cols))
+				ph         = placeholders(len(batch[0].cols))
+			)
+			for i, row := range batch {
+				if i > 0 {
+					sqlPattern.WriteString(",")
+				}
+				sqlPattern.WriteString(ph)
+				values = append(values, row.vals...)
+			}
+			if err = m.Execute(ctx, sqlPattern.String(), values...); err != nil {
+				return -1, err
+			}
+			id := m.LastInsertID(ctx)
+			if lastID == -1 {
+				lastID = id
+			}
+			// LastInsertId 为本条语句第一行的自增值
+			for _, row := range batch {
+				if row.auto.IsValid() {
+					setAutoIncr(row.auto, id)
+					id++
+				}
+			}
+		}
+	}
+	return lastID, nil
+}
+
+// splitRows 按 max_allowed_packet 和参数个数拆分同一组的行，单行超过限制时单独成一批
+func splitRows(rows []*structRow, prefixLen, maxPacket int) [][]*structRow {
+	var (
+		batches [][]*structRow
+		start   int
+		size    = prefixLen
+		params  int
+		budget  = maxPacket - packetReserved
+	)
+	for i, row := range rows {
+		rowSize := 2 + 2*len(row.cols) + valuesSize(row.vals)
+		if i > start && (size+rowSize > budget || params+len(row.vals) > maxPlaceholders) {
+			batches = append(batches, rows[start:i])
+			start, size, params = i, prefixLen, 0
+		}
+		size += rowSize
+		params += len(row.vals)
+	}
+	return append(batches, rows[start:])
+}
+
+// valuesSize 估算参数在协议中占用的字节数
+func valuesSize(vals []interface{}) (n int) {
+	for _, v := range vals {
+		if valuer, ok := v.(driver.Valuer); ok {
+			if dv, err := valuer.Value(); err == nil {
+				v = dv
+			}
+		}
+		switch x := v.(type) {
+		case nil:
+			n++
+		case string:
+			n += len(x) + 9
+		case []byte:
+			n += len(x) + 9
+		case time.Time:
+			n += 12
+		default:
+			rv := reflect.ValueOf(v)
+			for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+				rv = rv.Elem()
+			}
+			switch rv.Kind() {
+			case reflect.String:
+				n += rv.Len() + 9
+			case reflect.Slice:
+				n += rv.Len() + 9
+			default:
+				n += 8
+			}
+		}
+	}
+	return n
+}
+
+// maxAllowedPacket 返回 WithMaxAllowedPacket 的设置，未设置时查询主库并缓存在连接上
+// 查询不经过 m.rows 和事务，不影响调用方未读完的结果
+func (m *MySQL) maxAllowedPacket(ctx context.Context) int {
+	if m.opt.maxAllowedPacket > 0 {
+		return m.opt.maxAllowedPacket
+	}
+	if m.maxPacket > 0 {
+		return m.maxPacket
+	}
+	var size sql.NullInt64
+	if err := m.db.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&size); err != nil || size.Int64 <= 0 {
+		return defaultMaxAllowedPacket
+	}
+	m.maxPacket = int(size.Int64)
+	return m.maxPacket
+}
@@ -0,0 +1,151 @@
+package dmysql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type order struct {
+	ID     int64     `db:"id,autoincr"`
+	UID    int64     `db:"uid,pk"`
+	Title  string    `db:"title"`
+	Remark string    `db:"remark,omitempty"`
+	Ctime  time.Time `db:"ctime,omitempty"`
+	*Extra
+}
+
+func TestInsertStruct(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+
+	o := &order{UID: 7, Title: "a"}
+	if id, err := conn.InsertStruct(ctx, "order", o); err != nil || id != 1 || o.ID != 1 {
+		t.Fatal(id, err, o.ID)
+	}
+	o2 := &order{ID: 9, UID: 7, Title: "b", Remark: "r", Extra: &Extra{Remark: "x"}}
+	if _, err := conn.InsertStruct(ctx, "order", o2); err != nil || o2.ID != 9 {
+		t.Fatal(err, o2.ID)
+	}
+	if _, err := conn.UpsertStruct(ctx, "order", &order{UID: 8, Title: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.UpsertStruct(ctx, "order", &order{UID: 8, Title: "c"}, "title"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := conn.UpdateStruct(ctx, "order", &order{ID: 3, UID: 8, Title: "d"}); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	exp := []string{
+		"INSERT INTO `order`(`uid`,`title`) VALUES (?,?)",
+		"INSERT INTO `order`(`id`,`uid`,`title`,`remark`) VALUES (?,?,?,?)",
+		"INSERT INTO `order`(`uid`,`title`) VALUES (?,?) ON DUPLICATE KEY UPDATE `title` = VALUES(`title`),`id` = LAST_INSERT_ID(`id`)",
+		"INSERT INTO `order`(`uid`,`title`) VALUES (?,?) ON DUPLICATE KEY UPDATE `title` = VALUES(`title`),`id` = LAST_INSERT_ID(`id`)",
+		"UPDATE `order` SET `title`=? WHERE `id` = ? AND `uid` = ?",
+	}
+	if got := fdb.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(strings.Join(got, "\n"))
+	}
+	// 外层的 remark 覆盖 Extra.Remark
+	if args := fdb.args[1]; !reflect.DeepEqual(args, []driver.Value{int64(9), int64(7), "b", "r"}) {
+		t.Fatal(args)
+	}
+	if args := fdb.args[4]; !reflect.DeepEqual(args, []driver.Value{"d", int64(3), int64(8)}) {
+		t.Fatal(args)
+	}
+
+	if _, err := conn.UpdateStruct(ctx, "order", &Extra{Remark: "x"}); err != ErrNoPrimaryKey {
+		t.Fatal(err)
+	}
+	if _, err := conn.InsertStruct(ctx, "order", order{}); !errors.Is(err, ErrInvalidDest) {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiInsertStructs(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+	conn.opt.maxAllowedPacket = packetReserved + 120
+
+	orders := []order{
+		{UID: 1, Title: "aaaaaaaaaa"},
+		{UID: 2, Title: "bbbbbbbbbb", Remark: "r"},
+		{UID: 3, Title: "cccccccccc"},
+		{UID: 4, Title: "dddddddddd"},
+		{ID: 100, UID: 5, Title: "eeeeeeeeee"},
+	}
+	id, err := conn.MultiInsertStructs(ctx, "order", orders)
+	if err != nil || id != 1 {
+		t.Fatal(id, err)
+	}
+	exp := []string{
+		"INSERT INTO `order`(`uid`,`title`) VALUES (?,?),(?,?)",
+		"INSERT INTO `order`(`uid`,`title`) VALUES (?,?)",
+		"INSERT INTO `order`(`uid`,`title`,`remark`) VALUES (?,?,?)",
+		"INSERT INTO `order`(`id`,`uid`,`title`) VALUES (?,?,?)",
+	}
+	if got := fdb.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(strings.Join(got, "\n"))
+	}
+	var ids []int64
+	for _, o := range orders {
+		ids = append(ids, o.ID)
+	}
+	if !reflect.DeepEqual(ids, []int64{1, 4, 2, 3, 100}) {
+		t.Fatal(ids)
+	}
+
+	ptrs := []*order{{UID: 1}, nil}
+	if _, err := conn.MultiInsertStructs(ctx, "order", ptrs); !errors.Is(err, ErrInvalidDest) {
+		t.Fatal(err)
+	}
+}
+
+func TestMaxAllowedPacket(t *testing.T) {
+	conn, fdb := fetchConn(t)
+	ctx := context.Background()
+	fdb.setRows("SELECT @@max_allowed_packet", []string{"@@max_allowed_packet"}, []driver.Value{int64(4096)})
+	fdb.setRows("SELECT a FROM t", []string{"a"}, []driver.Value{"1"}, []driver.Value{"2"})
+
+	if err := conn.Query(ctx, "SELECT a FROM t"); err != nil {
+		t.Fatal(err)
+	}
+	if row, err := conn.FetchRow(ctx); err != nil || len(row) == 0 || row[0] != "1" {
+		t.Fatal(row, err)
+	}
+	if n := conn.maxAllowedPacket(ctx); n != 4096 {
+		t.Fatal(n)
+	}
+	// 查询 max_allowed_packet 不关闭未读完的结果
+	if row, err := conn.FetchRow(ctx); err != nil || len(row) == 0 || row[0] != "2" {
+		t.Fatal(row, err)
+	}
+	if n := conn.maxAllowedPacket(ctx); n != 4096 {
+		t.Fatal(n)
+	}
+	exp := []string{"SELECT a FROM t", "SELECT @@max_allowed_packet"}
+	if got := fdb.statements(); !reflect.DeepEqual(got, exp) {
+		t.Fatal(strings.Join(got, "\n"))
+	}
+}
+
+func TestSplitRows(t *testing.T) {
+	rows := make([]*structRow, 5)
+	for i := range rows {
+		rows[i] = &structRow{cols: make([]string, 30000), vals: make([]interface{}, 30000)}
+	}
+	var sizes []int
+	for _, b := range splitRows(rows, 10, 1<<30) {
+		sizes = append(sizes, len(b))
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Fatal(sizes)
+	}
+	if n := valuesSize([]interface{}{nil, "ab", []byte("c"), 1, time.Now(), &order{}}); n != 1+11+10+8+12+8 {
+		t.Fatal(n)
+	}
+}
@@ -0,0 +1,600 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	clusterSlotNum      = 16384
+	clusterMaxRedirects = 5
+)
+
+// cluster redis cluster 模式下的路由表，每个节点对应一个独立连接池的 Manager
+type cluster struct {
+	m     *Manager
+	seeds []string
+
+	mu    sync.RWMutex
+	slots [clusterSlotNum]string
+	nodes map[string]*Manager
+
+	refreshing int32
+}
+
+type slotRange struct {
+	start int
+	end   int
+	addr  string
+}
+
+type redirect struct {
+	ask  bool
+	slot int
+	addr string
+}
+
+func newClusterManager(addrs []string, auth string, opt *option) (*Manager, error) {
+	mgr := &Manager{
+		servers: addrs,
+		auth:    auth,
+		opt:     opt,
+	}
+	mgr.cluster = &cluster{
+		m:     mgr,
+		seeds: addrs,
+		nodes: make(map[string]*Manager),
+	}
+	err := mgr.cluster.refresh()
+
+	mgr.cluster.mu.RLock()
+	for _, node := range mgr.cluster.nodes {
+		mgr.Connected += node.Connected
+	}
+	mgr.cluster.mu.RUnlock()
+	if mgr.opt.keepSilent && mgr.Connected > 0 {
+		return mgr, nil
+	}
+	return mgr, err
+}
+
+// refresh 通过 CLUSTER SLOTS 重建 slot 路由表
+func (c *cluster) refresh() error {
+	var lastErr error
+	for _, addr := range c.candidates() {
+		conn, err := c.m.dial(addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := conn.Do(commandCluster, clusterSlots)
+		conn.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ranges, err := parseSlots(reply, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(ranges) == 0 {
+			lastErr = ErrClusterNoNode
+			continue
+		}
+		for _, r := range ranges {
+			if _, err := c.node(r.addr); err != nil {
+				lastErr = err
+			}
+		}
+		for _, node := range c.applySlots(ranges) {
+			node.retire()
+		}
+		return lastErr
+	}
+	return lastErr
+}
+
+// applySlots 按 ranges 重建整个路由表，返回不再持有 slot 的节点，由调用方 retire
+func (c *cluster) applySlots(ranges []slotRange) []*Manager {
+	slots := new([clusterSlotNum]string)
+	live := make(map[string]bool, len(ranges))
+	for _, r := range ranges {
+		live[r.addr] = true
+		for s := r.start; s <= r.end && s < clusterSlotNum; s++ {
+			slots[s] = r.addr
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.slots = *slots
+	var removed []*Manager
+	for addr, node := range c.nodes {
+		if !live[addr] {
+			delete(c.nodes, addr)
+			removed = append(removed, node)
+		}
+	}
+	return removed
+}
+
+// close 关闭所有节点的连接池
+func (c *cluster) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, node := range c.nodes {
+		node.Close()
+	}
+}
+
+// triggerRefresh 拓扑变化时异步刷新路由表，同一时间只会有一个刷新任务
+func (c *cluster) triggerRefresh() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.refresh()
+	}()
+}
+
+// candidates 已知节点优先，其次是初始地址
+func (c *cluster) candidates() []string {
+	c.mu.RLock()
+	addrs := make([]string, 0, len(c.nodes)+len(c.seeds))
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+	return append(addrs, c.seeds...)
+}
+
+// node 返回节点对应的 Manager，不存在时新建
+func (c *cluster) node(addr string) (*Manager, error) {
+	c.mu.RLock()
+	node, ok := c.nodes[addr]
+	c.mu.RUnlock()
+	if ok {
+		return node, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if node, ok = c.nodes[addr]; ok {
+		return node, nil
+	}
+	opt := *c.m.opt
+	opt.clusterEnable = false
+	node, err := newManager([]string{addr}, c.m.auth, &opt)
+	if err != nil && !(opt.keepSilent && node.Connected > 0) {
+		return nil, err
+	}
+	c.nodes[addr] = node
+	return node, nil
+}
+
+// masters 返回持有 slot 的所有节点
+func (c *cluster) masters() ([]*Manager, error) {
+	c.mu.RLock()
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, addr := range c.slots {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	c.mu.RUnlock()
+	if len(addrs) == 0 {
+		return nil, ErrClusterNoNode
+	}
+	nodes := make([]*Manager, 0, len(addrs))
+	for _, addr := range addrs {
+		node, err := c.node(addr)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// nodeBySlot slot 未分配时随机选一个节点，并触发路由表刷新
+func (c *cluster) nodeBySlot(slot int) (*Manager, error) {
+	c.mu.RLock()
+	addr := c.slots[slot]
+	c.mu.RUnlock()
+	if addr == "" {
+		c.triggerRefresh()
+		addrs := c.candidates()
+		if len(addrs) == 0 {
+			return nil, ErrClusterNoNode
+		}
+		addr = addrs[0]
+	}
+	return c.node(addr)
+}
+
+// do 按 key 路由到对应节点执行，处理 MOVED/ASK 重定向
+func (c *cluster) do(ctx context.Context, key string, action func(*Conn) (interface{}, error), cmd string, arg ...interface{}) (interface{}, error) {
+	slot := keySlot(key)
+	node, err := c.nodeBySlot(slot)
+	if err != nil {
+		return nil, err
+	}
+	var asking bool
+	for i := 0; i < clusterMaxRedirects; i++ {
+		var redir *redirect
+		act := func(conn *Conn) (interface{}, error) {
+			if asking {
+				if _, err := conn.Do(commandAsking); err != nil {
+					return nil, err
+				}
+			}
+			reply, err := action(conn)
+			if redir = parseRedirect(err); redir != nil {
+				return nil, nil
+			}
+			return reply, err
+		}
+		reply, err := node.do(ctx, act, cmd, arg...)
+		if redir == nil {
+			if _, ok := err.(redis.Error); err != nil && !ok {
+				c.triggerRefresh()
+			}
+			return reply, err
+		}
+		asking = redir.ask
+		if !redir.ask {
+			c.mu.Lock()
+			c.slots[redir.slot] = redir.addr
+			c.mu.Unlock()
+			c.triggerRefresh()
+		}
+		if node, err = c.node(redir.addr); err != nil {
+			return nil, err
+		}
+	}
+	return nil, ErrClusterTooManyRedirects
+}
+
+// routedCmd pipeline 中发往某个节点的命令，asking 为 true 时先发送 ASKING
+type routedCmd struct {
+	*queuedCmd
+	asking bool
+}
+
+// pipeline 按节点拆分 pipeline 中的命令，收到 MOVED/ASK 的命令重新发往目标节点
+func (c *cluster) pipeline(ctx context.Context, cmds []*queuedCmd) error {
+	var (
+		groups = make(map[*Manager][]routedCmd)
+		order  []*Manager
+	)
+	add := func(node *Manager, cmd routedCmd) {
+		if _, ok := groups[node]; !ok {
+			order = append(order, node)
+		}
+		groups[node] = append(groups[node], cmd)
+	}
+	for _, cmd := range cmds {
+		node, err := c.nodeBySlot(keySlot(commandKey(cmd.name, cmd.args)))
+		if err != nil {
+			return err
+		}
+		add(node, routedCmd{queuedCmd: cmd})
+	}
+
+	var lastErr error
+	for i := 0; len(order) > 0; i++ {
+		pending, nodes := groups, order
+		groups, order = make(map[*Manager][]routedCmd), nil
+		for _, node := range nodes {
+			group := pending[node]
+			if i == clusterMaxRedirects {
+				for _, cmd := range group {
+					cmd.reply.val, cmd.reply.err = nil, ErrClusterTooManyRedirects
+				}
+				continue
+			}
+			if err := c.pipelineNode(ctx, node, group); err != nil {
+				lastErr = err
+				continue
+			}
+			for _, cmd := range group {
+				redir := parseRedirect(cmd.reply.err)
+				if redir == nil {
+					continue
+				}
+				if !redir.ask {
+					c.mu.Lock()
+					c.slots[redir.slot] = redir.addr
+					c.mu.Unlock()
+					c.triggerRefresh()
+				}
+				target, err := c.node(redir.addr)
+				if err != nil {
+					cmd.reply.val, cmd.reply.err = nil, err
+					continue
+				}
+				add(target, routedCmd{queuedCmd: cmd.queuedCmd, asking: redir.ask})
+			}
+		}
+	}
+	return lastErr
+}
+
+// pipelineNode 在一个节点上执行 group，连接级别的错误写入 group 中每条命令的 Reply
+func (c *cluster) pipelineNode(ctx context.Context, node *Manager, group []routedCmd) error {
+	names := make([]interface{}, len(group))
+	for i, cmd := range group {
+		names[i] = cmd.name
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		sends := 0
+		for _, cmd := range group {
+			if cmd.asking {
+				if err := conn.Send(commandAsking); err != nil {
+					return nil, sendError(sends, err)
+				}
+				sends++
+			}
+			if err := conn.Send(cmd.name, cmd.args...); err != nil {
+				return nil, sendError(sends, err)
+			}
+			sends++
+		}
+		if err := conn.Flush(); err != nil {
+			return nil, sentError{err}
+		}
+		for _, cmd := range group {
+			if cmd.asking {
+				if _, err := conn.Receive(); err != nil {
+					if _, ok := err.(redis.Error); !ok {
+						return nil, sentError{err}
+					}
+				}
+			}
+			val, err := conn.Receive()
+			if _, ok := err.(redis.Error); err != nil && !ok {
+				return nil, sentError{err}
+			}
+			cmd.reply.val, cmd.reply.err = val, err
+		}
+		return nil, nil
+	}
+	_, err := node.do(ctx, action, commandPipeline, names...)
+	if err != nil {
+		for _, cmd := range group {
+			cmd.reply.val, cmd.reply.err = nil, err
+		}
+	}
+	return err
+}
+
+// commandKey 返回用于路由的 key，EVAL/EVALSHA 的 key 在 numkeys 之后，没有 key 时返回空串
+func commandKey(cmd string, args []interface{}) string {
+	switch strings.ToUpper(cmd) {
+	case commandEval, commandEvalSha:
+		if len(args) < 3 {
+			return ""
+		}
+		if n, err := strconv.Atoi(fmt.Sprint(args[1])); err != nil || n <= 0 {
+			return ""
+		}
+		return fmt.Sprint(args[2])
+	case commandXReadGroup, commandXRead:
+		for i, arg := range args {
+			if strings.EqualFold(fmt.Sprint(arg), xreadStreams) && i+1 < len(args) {
+				return fmt.Sprint(args[i+1])
+			}
+		}
+		return ""
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return fmt.Sprint(args[0])
+}
+
+// mget 按 slot 拆分 MGET
+func (c *cluster) mget(ctx context.Context, keys []string) (map[string]string, error) {
+	ret := make(map[string]string, len(keys))
+	for _, group := range groupBySlot(keys) {
+		args := make([]interface{}, len(group))
+		for i, k := range group {
+			args[i] = k
+		}
+		action := func(conn *Conn) (interface{}, error) {
+			return conn.Do(commandMGet, args...)
+		}
+		reply, err := c.do(ctx, group[0], action, commandMGet, args...)
+		sub, err := replyMap(reply, group, err)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range sub {
+			ret[k] = v
+		}
+	}
+	return ret, nil
+}
+
+// mset 按 slot 拆分 MSET，不保证跨 slot 的原子性
+func (c *cluster) mset(ctx context.Context, kv map[string]interface{}) (reply interface{}, err error) {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	for _, group := range groupBySlot(keys) {
+		args := make([]interface{}, 0, len(group)*2)
+		for _, k := range group {
+			args = append(args, k, kv[k])
+		}
+		action := func(conn *Conn) (interface{}, error) {
+			return conn.Do(commandMSet, args...)
+		}
+		if reply, err = c.do(ctx, group[0], action, commandMSet, args...); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// sunion 按 slot 拆分 SUNION，在客户端合并结果
+func (c *cluster) sunion(ctx context.Context, sets []string) ([]interface{}, error) {
+	var (
+		ret  []interface{}
+		seen = make(map[string]bool)
+	)
+	for _, group := range groupBySlot(sets) {
+		args := make([]interface{}, len(group))
+		for i, k := range group {
+			args[i] = k
+		}
+		action := func(conn *Conn) (interface{}, error) {
+			return conn.Do(commandSUnion, args...)
+		}
+		vals, err := redis.Values(c.do(ctx, group[0], action, commandSUnion, args...))
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vals {
+			member := fmt.Sprintf("%s", v)
+			if !seen[member] {
+				seen[member] = true
+				ret = append(ret, v)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// groupBySlot 保持 key 首次出现的顺序
+func groupBySlot(keys []string) [][]string {
+	index := make(map[int]int)
+	var groups [][]string
+	for _, k := range keys {
+		slot := keySlot(k)
+		i, ok := index[slot]
+		if !ok {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], k)
+	}
+	return groups
+}
+
+func parseSlots(reply interface{}, seed string) ([]slotRange, error) {
+	items, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]slotRange, 0, len(items))
+	for _, item := range items {
+		entry, err := redis.Values(item, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) < 3 {
+			return nil, fmt.Errorf("unexpected cluster slots entry: %v", entry)
+		}
+		start, err := redis.Int(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		end, err := redis.Int(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		master, err := redis.Values(entry[2], nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(master) < 2 {
+			return nil, fmt.Errorf("unexpected cluster slots node: %v", master)
+		}
+		host, err := redis.String(master[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		port, err := redis.Int(master[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		if host == "" {
+			host, _, _ = net.SplitHostPort(seed)
+		}
+		ranges = append(ranges, slotRange{
+			start: start,
+			end:   end,
+			addr:  net.JoinHostPort(host, strconv.Itoa(port)),
+		})
+	}
+	return ranges, nil
+}
+
+// parseRedirect 解析 "MOVED 3999 127.0.0.1:6381" 和 "ASK 3999 127.0.0.1:6381"
+func parseRedirect(err error) *redirect {
+	e, ok := err.(redis.Error)
+	if !ok {
+		return nil
+	}
+	fields := strings.Fields(string(e))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return nil
+	}
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 || slot >= clusterSlotNum {
+		return nil
+	}
+	return &redirect{
+		ask:  fields[0] == "ASK",
+		slot: slot,
+		addr: fields[2],
+	}
+}
+
+// keySlot 计算 key 所属的 slot，支持 {hash_tag}
+func keySlot(key string) int {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			key = key[s+1 : s+1+e]
+		}
+	}
+	return int(crc16(key)) % clusterSlotNum
+}
+
+// crc16 CRC16-CCITT(XMODEM)
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+var crc16Table = func() (table [256]uint16) {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return
+}()
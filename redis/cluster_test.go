@@ -0,0 +1,161 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/redis/redistest"
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestKeySlot(t *testing.T) {
+	assert(t, crc16("123456789") == 0x31c3)
+	assert(t, keySlot("foo") == 12182)
+	assert(t, keySlot("bar") == 5061)
+	assert(t, keySlot("{user1000}.following") == keySlot("{user1000}.followers"))
+	assert(t, keySlot("foo{}{bar}") == keySlot("foo{}{bar}"))
+	assert(t, keySlot("{}foo") == int(crc16("{}foo"))%clusterSlotNum)
+}
+
+func TestParseRedirect(t *testing.T) {
+	r := parseRedirect(redis.Error("MOVED 3999 127.0.0.1:6381"))
+	assert(t, r != nil && !r.ask && r.slot == 3999 && r.addr == "127.0.0.1:6381")
+	r = parseRedirect(redis.Error("ASK 3999 127.0.0.1:6381"))
+	assert(t, r != nil && r.ask)
+	assert(t, parseRedirect(redis.Error("ERR unknown command")) == nil)
+	assert(t, parseRedirect(nil) == nil)
+}
+
+func TestGroupBySlot(t *testing.T) {
+	groups := groupBySlot([]string{"{a}1", "foo", "{a}2", "bar"})
+	assert(t, len(groups) == 3)
+	assert(t, len(groups[0]) == 2 && groups[0][1] == "{a}2")
+	assert(t, groups[1][0] == "foo" && groups[2][0] == "bar")
+}
+
+func TestParseSlots(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{int64(0), int64(5460), []interface{}{[]byte("127.0.0.1"), int64(7000), []byte("id1")}},
+		[]interface{}{int64(5461), int64(16383), []interface{}{[]byte(""), int64(7001), []byte("id2")}},
+	}
+	ranges, err := parseSlots(reply, "10.0.0.1:7000")
+	assert(t, err == nil && len(ranges) == 2)
+	assert(t, ranges[0].addr == "127.0.0.1:7000" && ranges[0].end == 5460)
+	assert(t, ranges[1].addr == "10.0.0.1:7001" && ranges[1].start == 5461)
+}
+
+func TestCommandKey(t *testing.T) {
+	assert(t, commandKey(commandGet, []interface{}{"k"}) == "k")
+	assert(t, commandKey("evalsha", []interface{}{"sha", 1, "k", "arg"}) == "k")
+	assert(t, commandKey(commandEval, []interface{}{"src", 0, "arg"}) == "")
+	assert(t, commandKey(commandXReadGroup, []interface{}{"GROUP", "g", "c", "COUNT", 1, "streams", "s", ">"}) == "s")
+	assert(t, commandKey("PING", nil) == "")
+}
+
+// newFakeCluster 两个节点的 cluster，所有 slot 初始都在 a 上
+func newFakeCluster(t *testing.T) (a, b *redistest.Server, mgr *Manager) {
+	a, ma := newFakeManager(t)
+	b, mb := newFakeManager(t)
+	mgr = &Manager{servers: []string{a.Addr()}, opt: ma.opt}
+	mgr.cluster = &cluster{
+		m:     mgr,
+		nodes: map[string]*Manager{a.Addr(): ma, b.Addr(): mb},
+	}
+	for i := range mgr.cluster.slots {
+		mgr.cluster.slots[i] = a.Addr()
+	}
+	return a, b, mgr
+}
+
+func TestClusterPipelineRedirect(t *testing.T) {
+	a, b, mgr := newFakeCluster(t)
+	ctx := context.Background()
+	a.SetError(commandSet, fmt.Sprintf("MOVED %d %s", keySlot("k1"), b.Addr()))
+	a.SetError(commandIncr, fmt.Sprintf("ASK %d %s", keySlot("n"), b.Addr()))
+
+	p := mgr.Pipeline(ctx)
+	set := p.Set("k1", "v1")
+	incr := p.Incr("n")
+	get := p.Get("k2")
+	assert(t, p.Exec() == nil)
+
+	ok, err := redis.String(set.Result())
+	assert(t, err == nil && ok == "OK")
+	n, err := redis.Int(incr.Result())
+	assert(t, err == nil && n == 1)
+	val, err := get.Result()
+	assert(t, err == nil && val == nil)
+	assert(t, b.Calls(commandAsking) == 1)
+
+	// MOVED 更新路由表，ASK 不更新
+	mgr.cluster.mu.RLock()
+	assert(t, mgr.cluster.slots[keySlot("k1")] == b.Addr())
+	assert(t, mgr.cluster.slots[keySlot("n")] == a.Addr())
+	mgr.cluster.mu.RUnlock()
+
+	v, err := mgr.cluster.nodes[b.Addr()].GetString(ctx, "k1")
+	assert(t, err == nil && v == "v1")
+}
+
+func TestClusterPipelineTooManyRedirects(t *testing.T) {
+	a, b, mgr := newFakeCluster(t)
+	ctx := context.Background()
+	a.SetError(commandGet, fmt.Sprintf("ASK %d %s", keySlot("k"), b.Addr()))
+	b.SetError(commandGet, fmt.Sprintf("ASK %d %s", keySlot("k"), a.Addr()))
+
+	p := mgr.Pipeline(ctx)
+	get := p.Get("k")
+	assert(t, p.Exec() == nil)
+	_, err := get.Result()
+	assert(t, err == ErrClusterTooManyRedirects)
+	assert(t, a.Calls(commandGet)+b.Calls(commandGet) == clusterMaxRedirects)
+}
+
+func TestClusterApplySlots(t *testing.T) {
+	a, b, mgr := newFakeCluster(t)
+	removed := mgr.cluster.applySlots([]slotRange{{start: 0, end: 100, addr: a.Addr()}})
+	assert(t, len(removed) == 1 && removed[0].servers[0] == b.Addr())
+	for _, node := range removed {
+		node.Close()
+	}
+
+	c := mgr.cluster
+	assert(t, len(c.nodes) == 1 && c.nodes[a.Addr()] != nil)
+	assert(t, c.slots[0] == a.Addr() && c.slots[100] == a.Addr())
+	assert(t, c.slots[101] == "" && c.slots[clusterSlotNum-1] == "")
+}
+
+func TestClusterRetireNode(t *testing.T) {
+	_, b, mgr := newFakeCluster(t)
+	ctx := context.Background()
+	node := mgr.cluster.nodes[b.Addr()]
+
+	// 请求执行中节点下线，连接池在请求结束后才关闭
+	conn, err := node.getConn()
+	assert(t, err == nil)
+	node.enter()
+	for _, n := range mgr.cluster.applySlots([]slotRange{{start: 0, end: clusterSlotNum - 1, addr: mgr.servers[0]}}) {
+		n.retire()
+	}
+	assert(t, !node.pool.closed())
+	_, err = node.Set(ctx, "k", "v")
+	assert(t, err == nil)
+	node.putConn(conn)
+	node.leave()
+	assert(t, node.pool.closed())
+
+	// 关闭之后仍然可以执行，归还的连接直接关闭
+	v, err := node.GetString(ctx, "k")
+	assert(t, err == nil && v == "v")
+	st := node.Stats()
+	assert(t, st.ActiveConns == 0 && st.IdleConns == 0)
+}
+
+func TestClusterMockBlock(t *testing.T) {
+	_, _, mgr := newFakeCluster(t)
+	_, err := mgr.getConn()
+	assert(t, err == ErrClusterNoPool)
+	mgr.MockBlock(time.Millisecond)
+}
@@ -44,6 +44,18 @@ const (
 	commandZAdd             = "ZADD"
 	commandZRangeByScore    = "ZRANGEBYSCORE"
 	commandZRemRangeByScore = "ZREMRANGEBYSCORE"
+	commandZIncrBy          = "ZINCRBY"
+	commandZScore           = "ZSCORE"
+	commandZRank            = "ZRANK"
+	commandZRevRank         = "ZREVRANK"
+	commandZRange           = "ZRANGE"
+	commandZRevRange        = "ZREVRANGE"
+	commandZRevRangeByScore = "ZREVRANGEBYSCORE"
+	commandZCard            = "ZCARD"
+	commandZCount           = "ZCOUNT"
+	commandZRem             = "ZREM"
+	commandZUnionStore      = "ZUNIONSTORE"
+	commandZInterStore      = "ZINTERSTORE"
 
 	commandSAdd      = "SADD"
 	commandSCard     = "SCARD"
@@ -51,4 +63,74 @@ const (
 	commandSMembers  = "SMEMBERS"
 	commandSRem      = "SREM"
 	commandSUnion    = "SUNION"
+
+	commandWatch   = "WATCH"
+	commandUnwatch = "UNWATCH"
+	commandMulti   = "MULTI"
+	commandExec    = "EXEC"
+
+	commandEval    = "EVAL"
+	commandEvalSha = "EVALSHA"
+	commandScript  = "SCRIPT"
+	scriptLoad     = "LOAD"
+
+	commandCluster = "CLUSTER"
+	commandAsking  = "ASKING"
+	clusterSlots   = "SLOTS"
+
+	commandPublish = "PUBLISH"
+
+	commandXAdd       = "XADD"
+	commandXGroup     = "XGROUP"
+	commandXRead      = "XREAD"
+	commandXReadGroup = "XREADGROUP"
+	commandXAck       = "XACK"
+	commandXPending   = "XPENDING"
+	commandXClaim     = "XCLAIM"
+	xgroupCreate      = "CREATE"
+	xreadStreams      = "STREAMS"
+
+	commandScan  = "SCAN"
+	commandHScan = "HSCAN"
+	commandSScan = "SSCAN"
+	commandZScan = "ZSCAN"
+
+	commandSentinel     = "SENTINEL"
+	sentinelGetMaster   = "get-master-addr-by-name"
+	sentinelSlaves      = "slaves"
+	channelSwitchMaster = "+switch-master"
+	channelSlave        = "+slave"
+	channelSdown        = "+sdown"
+	channelSdownCleared = "-sdown"
+
+	// 非 redis 命令，仅用于统计
+	commandPipeline = "PIPELINE"
 )
+
+// readOnlyCommands sentinel 模式下可以发往从库的命令
+var readOnlyCommands = map[string]bool{
+	commandGet:              true,
+	commandMGet:             true,
+	commandExists:           true,
+	commandHGet:             true,
+	commandHGetAll:          true,
+	commandHKeys:            true,
+	commandHExists:          true,
+	commandHMGet:            true,
+	commandHLen:             true,
+	commandLLen:             true,
+	commandLRange:           true,
+	commandSCard:            true,
+	commandSIsMember:        true,
+	commandSMembers:         true,
+	commandSUnion:           true,
+	commandZRangeByScore:    true,
+	commandZScore:           true,
+	commandZRank:            true,
+	commandZRevRank:         true,
+	commandZRange:           true,
+	commandZRevRange:        true,
+	commandZRevRangeByScore: true,
+	commandZCard:            true,
+	commandZCount:           true,
+}
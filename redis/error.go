@@ -18,6 +18,32 @@ var (
 	ErrNoManagerAvailable = errors.New("no available manager in manager map, check your cluster name?")
 	// ErrSLATimeout 已经超时直接熔断redis操作
 	ErrSLATimeout = errors.New("sla timeout, interrupted redis action")
+	// ErrReplyNotReady pipeline 尚未执行，Reply 还没有返回值
+	ErrReplyNotReady = errors.New("reply is not ready, call Exec first")
+	// ErrTxAborted watch 的 key 被修改，事务重试次数用尽
+	ErrTxAborted = errors.New("transaction aborted, watched keys changed")
+	// ErrClusterNoNode cluster 模式下没有可用节点
+	ErrClusterNoNode = errors.New("no available node in redis cluster")
+	// ErrClusterTooManyRedirects MOVED/ASK 重定向次数过多
+	ErrClusterTooManyRedirects = errors.New("too many cluster redirects")
+	// ErrClusterNoPool cluster 模式的 Manager 没有自己的连接池，只能通过命令路由到节点
+	ErrClusterNoPool = errors.New("cluster manager has no connection pool")
+	// ErrClusterNoKey cluster 模式下无法确定命令路由的节点
+	ErrClusterNoKey = errors.New("no key to route in redis cluster")
+	// ErrSentinelNoMaster sentinel 没有返回 master 地址
+	ErrSentinelNoMaster = errors.New("sentinel returned no master address")
+	// ErrSentinelNoReplica sentinel 返回的从库都无法建立连接
+	ErrSentinelNoReplica = errors.New("no replica connected from sentinel")
+	// ErrSubscriptionClosed 订阅已关闭
+	ErrSubscriptionClosed = errors.New("subscription is closed")
+	// ErrNilStreamHandler StreamConsumer 没有设置 handler
+	ErrNilStreamHandler = errors.New("stream consumer handler is nil")
+	// ErrLockNotAcquired 锁已被其他持有者占用
+	ErrLockNotAcquired = errors.New("lock is held by another owner")
+	// ErrLockNotHeld 锁未持有或已过期
+	ErrLockNotHeld = errors.New("lock is not held")
+	// ErrLockHeld 同一个 Lock 重复加锁
+	ErrLockHeld = errors.New("lock is already held, release it first")
 )
 
 // Error 内部封装，为了区分出 Get 操作时 redis 返回值是否为 nil
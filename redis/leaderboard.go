@@ -0,0 +1,79 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+)
+
+// Leaderboard 基于有序集合的排行榜，score 越高排名越靠前，排名从 0 开始
+type Leaderboard struct {
+	m   *Manager
+	key string
+}
+
+// NewLeaderboard 返回保存在 key 上的排行榜
+func NewLeaderboard(m *Manager, key string) *Leaderboard {
+	return &Leaderboard{m: m, key: key}
+}
+
+// Incr 为 member 增加 delta 分，返回新的分数
+func (lb *Leaderboard) Incr(ctx context.Context, member string, delta float64) (float64, error) {
+	return lb.m.ZIncrBy(ctx, lb.key, delta, member)
+}
+
+// SetScore 设置 member 的分数
+func (lb *Leaderboard) SetScore(ctx context.Context, member string, score float64) error {
+	_, err := lb.m.ZAdd(ctx, lb.key, score, member)
+	return err
+}
+
+// Score 返回 member 的分数，不在榜上时返回 missedKeyErr
+func (lb *Leaderboard) Score(ctx context.Context, member string) (float64, error) {
+	return lb.m.ZScore(ctx, lb.key, member)
+}
+
+// Rank 返回 member 的排名，不在榜上时返回 missedKeyErr
+func (lb *Leaderboard) Rank(ctx context.Context, member string) (int64, error) {
+	return lb.m.ZRevRank(ctx, lb.key, member)
+}
+
+// Top 返回前 n 名
+func (lb *Leaderboard) Top(ctx context.Context, n int64) ([]ZMember, error) {
+	return lb.Page(ctx, 0, n)
+}
+
+// Page 返回排名在 [offset, offset+count) 的成员
+func (lb *Leaderboard) Page(ctx context.Context, offset, count int64) ([]ZMember, error) {
+	if count <= 0 {
+		return nil, nil
+	}
+	return lb.m.ZRevRange(ctx, lb.key, offset, offset+count-1)
+}
+
+// Around 返回 member 及其前后各 n 名，第二个返回值为结果中第一个成员的排名
+func (lb *Leaderboard) Around(ctx context.Context, member string, n int64) ([]ZMember, int64, error) {
+	rank, err := lb.Rank(ctx, member)
+	if err != nil {
+		return nil, 0, err
+	}
+	start := rank - n
+	if start < 0 {
+		start = 0
+	}
+	ret, err := lb.m.ZRevRange(ctx, lb.key, start, rank+n)
+	return ret, start, err
+}
+
+// Remove 将成员移出排行榜
+func (lb *Leaderboard) Remove(ctx context.Context, members ...string) (int64, error) {
+	args := make([]interface{}, len(members))
+	for i, v := range members {
+		args[i] = v
+	}
+	return lb.m.ZRem(ctx, lb.key, args...)
+}
+
+// Size 返回榜上的成员个数
+func (lb *Leaderboard) Size(ctx context.Context) (int64, error) {
+	return lb.m.ZCard(ctx, lb.key)
+}
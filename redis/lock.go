@@ -0,0 +1,199 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// KEYS[1] 锁 KEYS[2] fencing token 计数器
+	// 脚本执行后连接出错时 redialDo 会重试，锁已经是本次调用持有时返回当前的 token
+	lockAcquireScript = NewScript("lock_acquire", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return tonumber(redis.call('GET', KEYS[2]))
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2], 'NX') then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+	lockReleaseScript = NewScript("lock_release", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+	lockRefreshScript = NewScript("lock_refresh", `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Lock 分布式锁，释放和续期都会校验持有者
+// 每次加锁成功会得到一个单调递增的 fencing token，可以随写操作一起落库，拒绝过期持有者的写入
+type Lock struct {
+	m        *Manager
+	watchdog bool
+
+	mu    sync.Mutex
+	key   string
+	owner string
+	ttl   time.Duration
+	token int64
+	stop  chan struct{}
+}
+
+// LockOption Lock 的可选参数
+type LockOption func(l *Lock)
+
+// LockWatchdog 加锁成功后启动 watchdog，每 ttl/3 续期一次直到 Release
+func LockWatchdog() LockOption {
+	return func(l *Lock) {
+		l.watchdog = true
+	}
+}
+
+// NewLock 创建锁，同一个 Lock 同一时间只能持有一个 key
+func NewLock(m *Manager, opts ...LockOption) *Lock {
+	l := &Lock{m: m}
+	for _, o := range opts {
+		o(l)
+	}
+	return l
+}
+
+// Acquire 尝试加锁，锁被其他持有者占用时返回 ErrLockNotAcquired
+func (l *Lock) Acquire(ctx context.Context, key string, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner != "" {
+		return ErrLockHeld
+	}
+	owner, err := newLockOwner()
+	if err != nil {
+		return err
+	}
+	key = l.m.key(key)
+	token, err := Int64(l.m.runScript(ctx, lockAcquireScript, []string{key, lockFenceKey(key)},
+		owner, int64(ttl/time.Millisecond)))
+	if err != nil {
+		return err
+	}
+	if token == 0 {
+		return ErrLockNotAcquired
+	}
+	l.key, l.owner, l.ttl, l.token = key, owner, ttl, token
+	if l.watchdog {
+		l.stop = make(chan struct{})
+		go l.watch(l.stop, ttl)
+	}
+	return nil
+}
+
+// Release 释放锁，锁已过期或被他人持有时返回 ErrLockNotHeld
+func (l *Lock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner == "" {
+		return ErrLockNotHeld
+	}
+	if l.stop != nil {
+		close(l.stop)
+		l.stop = nil
+	}
+	key, owner := l.key, l.owner
+	l.key, l.owner = "", ""
+	n, err := Int64(l.m.runScript(ctx, lockReleaseScript, []string{key}, owner))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Refresh 将锁的过期时间重置为 ttl
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.refresh(ctx, ttl)
+}
+
+func (l *Lock) refresh(ctx context.Context, ttl time.Duration) error {
+	if l.owner == "" {
+		return ErrLockNotHeld
+	}
+	n, err := Int64(l.m.runScript(ctx, lockRefreshScript, []string{l.key}, l.owner, int64(ttl/time.Millisecond)))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+	l.ttl = ttl
+	return nil
+}
+
+// Token 当前持有锁的 fencing token，未持有锁时为 0
+func (l *Lock) Token() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner == "" {
+		return 0
+	}
+	return l.token
+}
+
+// watch 定时续期，锁已丢失时退出
+func (l *Lock) watch(stop chan struct{}, ttl time.Duration) {
+	interval := ttl / 3
+	if interval <= 0 {
+		return
+	}
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tk.C:
+		}
+		l.mu.Lock()
+		select {
+		case <-stop:
+			l.mu.Unlock()
+			return
+		default:
+		}
+		err := l.refresh(context.Background(), ttl)
+		l.mu.Unlock()
+		if err == ErrLockNotHeld {
+			return
+		}
+	}
+}
+
+func newLockOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// lockFenceKey 与锁在同一个 slot，cluster 模式下脚本才能同时操作两个 key
+// 没有 hash tag 但包含 '}' 的 key 无法保证同 slot，cluster 模式下应使用 {tag} 形式的 key
+func lockFenceKey(key string) string {
+	if s := strings.IndexByte(key, '{'); s >= 0 {
+		if e := strings.IndexByte(key[s+1:], '}'); e > 0 {
+			return key + ":fence"
+		}
+	}
+	return "{" + key + "}:fence"
+}
@@ -0,0 +1,62 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockFenceKey(t *testing.T) {
+	for _, key := range []string{"order:1", "{user:1}:lock", "a{b", "{"} {
+		assert(t, keySlot(lockFenceKey(key)) == keySlot(key))
+	}
+	assert(t, lockFenceKey("order:1") == "{order:1}:fence")
+	assert(t, lockFenceKey("{user:1}:lock") == "{user:1}:lock:fence")
+}
+
+func TestLock(t *testing.T) {
+	_, c := newFakeManager(t, Prefix("t:"))
+	key := "test_lock"
+
+	l1 := NewLock(c, LockWatchdog())
+	assert(t, l1.Acquire(ctx, key, time.Millisecond*300) == nil)
+	assert(t, l1.Acquire(ctx, key, time.Millisecond*300) == ErrLockHeld)
+	token := l1.Token()
+	assert(t, token > 0)
+
+	l2 := NewLock(c)
+	assert(t, l2.Acquire(ctx, key, time.Second) == ErrLockNotAcquired)
+	// watchdog 续期，超过 ttl 后仍然持有
+	time.Sleep(time.Millisecond * 700)
+	assert(t, l2.Acquire(ctx, key, time.Second) == ErrLockNotAcquired)
+
+	assert(t, l1.Release(ctx) == nil)
+	assert(t, l1.Release(ctx) == ErrLockNotHeld)
+	assert(t, l2.Acquire(ctx, key, time.Second) == nil)
+	assert(t, l2.Token() > token)
+	// fence key 由加上前缀之后的 key 计算
+	n, err := Int64(c.WithPrefix("").Get(ctx, lockFenceKey("t:"+key)))
+	assert(t, err == nil && n == l2.Token())
+	assert(t, l2.Release(ctx) == nil)
+
+	// 没有 watchdog 时到期自动释放
+	l3 := NewLock(c)
+	assert(t, l3.Acquire(ctx, key, time.Millisecond*100) == nil)
+	time.Sleep(time.Millisecond * 200)
+	assert(t, l2.Acquire(ctx, key, time.Second) == nil)
+	assert(t, l3.Refresh(ctx, time.Second) == ErrLockNotHeld)
+	assert(t, l3.Release(ctx) == ErrLockNotHeld)
+	assert(t, l2.Release(ctx) == nil)
+}
+
+func TestLockAcquireRetry(t *testing.T) {
+	_, c := newFakeManager(t)
+	keys := []string{"retry_lock", lockFenceKey("retry_lock")}
+
+	// 模拟脚本执行后连接出错，redialDo 用同一个 owner 重试
+	token, err := Int64(c.runScript(ctx, lockAcquireScript, keys, "owner", 1000))
+	assert(t, err == nil && token == 1)
+	token, err = Int64(c.runScript(ctx, lockAcquireScript, keys, "owner", 1000))
+	assert(t, err == nil && token == 1)
+	token, err = Int64(c.runScript(ctx, lockAcquireScript, keys, "other", 1000))
+	assert(t, err == nil && token == 0)
+}
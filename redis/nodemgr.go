@@ -0,0 +1,153 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dup2X/gopkg/discovery"
+)
+
+const (
+	defaultWorkerCycle      = 1
+	defaultHealthyThreshold = 3
+	defaultMaxCooldownTime  = 30
+	defaultMinHealthyRatio  = 0.5
+)
+
+// nodemgr 统计每个地址连续失败的次数，超过阈值后从负载均衡中摘除
+// 摘除超过 maxCooldownTime 后由后台 PING 探测，成功则恢复
+type nodemgr struct {
+	m *Manager
+
+	mu      sync.Mutex
+	fails   map[string]int64
+	ejected map[string]time.Time
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newNodemgr(m *Manager) *nodemgr {
+	nm := &nodemgr{
+		m:       m,
+		fails:   make(map[string]int64),
+		ejected: make(map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+	go nm.run()
+	return nm
+}
+
+// total 去重后的地址数
+func (nm *nodemgr) total() int {
+	seen := make(map[string]bool, len(nm.m.servers))
+	for _, addr := range nm.m.servers {
+		seen[addr] = true
+	}
+	return len(seen)
+}
+
+func (nm *nodemgr) isEjected(addr string) bool {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	_, ok := nm.ejected[addr]
+	return ok
+}
+
+func (nm *nodemgr) voteHealthy(addr string) {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if _, ok := nm.ejected[addr]; !ok {
+		nm.fails[addr] = 0
+	}
+}
+
+func (nm *nodemgr) voteUnhealthy(addr string) {
+	if nm.eject(addr) {
+		nm.m.balancer().Vote(addr, discovery.VoteUnhealthy)
+	}
+}
+
+// eject 记录一次失败，达到阈值且满足最小可用度时摘除，返回是否摘除
+func (nm *nodemgr) eject(addr string) bool {
+	nm.mu.Lock()
+	defer nm.mu.Unlock()
+	if _, ok := nm.ejected[addr]; ok {
+		return false
+	}
+	nm.fails[addr]++
+	if nm.fails[addr] < nm.m.opt.healthyThreshold {
+		return false
+	}
+	// 最小可用度保护，摘除后健康节点占比不能低于 minHealthyRatio
+	total := nm.total()
+	if total == 0 || float64(total-len(nm.ejected)-1)/float64(total) < nm.m.opt.minHealthyRatio {
+		return false
+	}
+	nm.ejected[addr] = time.Now()
+	return true
+}
+
+// restore 节点恢复，重新参与负载均衡
+func (nm *nodemgr) restore(addr string) {
+	nm.mu.Lock()
+	delete(nm.ejected, addr)
+	nm.fails[addr] = 0
+	nm.mu.Unlock()
+	nm.m.balancer().Vote(addr, discovery.VoteHealthy)
+}
+
+func (nm *nodemgr) run() {
+	tk := time.NewTicker(time.Duration(nm.m.opt.workerCycle) * time.Second)
+	defer tk.Stop()
+	for {
+		select {
+		case <-nm.done:
+			return
+		case <-tk.C:
+			nm.probe()
+		}
+	}
+}
+
+// probe 对冷却结束的节点发送 PING，失败则重新进入冷却
+func (nm *nodemgr) probe() {
+	cooldown := time.Duration(nm.m.opt.maxCooldownTime) * time.Second
+	var addrs []string
+	nm.mu.Lock()
+	for addr, at := range nm.ejected {
+		if time.Since(at) >= cooldown {
+			addrs = append(addrs, addr)
+		}
+	}
+	nm.mu.Unlock()
+
+	for _, addr := range addrs {
+		if nm.ping(addr) == nil {
+			nm.restore(addr)
+			continue
+		}
+		nm.mu.Lock()
+		if _, ok := nm.ejected[addr]; ok {
+			nm.ejected[addr] = time.Now()
+		}
+		nm.mu.Unlock()
+	}
+}
+
+func (nm *nodemgr) ping(addr string) error {
+	conn, err := nm.m.dial(addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Do(commandPing)
+	return err
+}
+
+func (nm *nodemgr) close() {
+	nm.once.Do(func() {
+		close(nm.done)
+	})
+}
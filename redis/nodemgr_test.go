@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/discovery"
+	"github.com/dup2X/gopkg/redis/redistest"
+)
+
+func TestNodemgrEject(t *testing.T) {
+	addrs := []string{"10.0.0.1:6379", "10.0.0.2:6379", "10.0.0.3:6379"}
+	m := &Manager{
+		servers: addrs,
+		pool:    newConnPool(1),
+		opt:     &option{healthyThreshold: 2, maxCooldownTime: 0, minHealthyRatio: 0.5},
+	}
+	m.pool.balancer, _ = discovery.NewBalancer(discovery.LOCALTYPE, "", addrs)
+	nm := &nodemgr{m: m, fails: make(map[string]int64), ejected: make(map[string]time.Time)}
+
+	nm.voteUnhealthy(addrs[0])
+	nm.voteHealthy(addrs[0])
+	nm.voteUnhealthy(addrs[0])
+	assert(t, !nm.isEjected(addrs[0]))
+	nm.voteUnhealthy(addrs[0])
+	assert(t, nm.isEjected(addrs[0]))
+	for i := 0; i < 6; i++ {
+		addr, err := m.balancer().Get()
+		assert(t, err == nil && addr != addrs[0])
+	}
+
+	// 再摘除一个节点后健康占比为 1/3，低于 0.5，不再摘除
+	nm.voteUnhealthy(addrs[1])
+	nm.voteUnhealthy(addrs[1])
+	assert(t, !nm.isEjected(addrs[1]))
+
+	nm.restore(addrs[0])
+	assert(t, !nm.isEjected(addrs[0]))
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		addr, _ := m.balancer().Get()
+		seen[addr] = true
+	}
+	assert(t, seen[addrs[0]])
+}
+
+func TestNodemgrDeadAddr(t *testing.T) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+
+	done := make(chan *Manager)
+	go func() {
+		mgr, _ := NewManager([]string{srv.Addr(), dead}, "", SetPoolSize(4), SetKeepSilent(true),
+			EnableNodemgr(), SetHealthyThreshold(1))
+		done <- mgr
+	}()
+	var mgr *Manager
+	select {
+	case mgr = <-done:
+	case <-time.After(time.Second * 3):
+		t.Fatal("NewManager hangs with a dead address")
+	}
+	defer mgr.Close()
+	assert(t, mgr.nodemgr.isEjected(dead))
+	for i := 0; i < 4; i++ {
+		_, err := mgr.Set(context.Background(), "k", "v")
+		assert(t, err == nil)
+	}
+}
@@ -14,11 +14,11 @@ type option struct {
 	// disf 的 serviceName
 	serviceName string
 
-	// nodemgr 节点状态更新周期
+	// nodemgr 节点状态更新周期，单位秒
 	workerCycle int
-	// nodemgr 健康节点投票阈值
+	// nodemgr 健康节点投票阈值，连续失败次数
 	healthyThreshold int64
-	// nodemgr 故障恢复时间
+	// nodemgr 故障恢复时间，单位秒
 	maxCooldownTime int64
 	// nodemgr 最小可用度保护
 	minHealthyRatio float64
@@ -31,6 +31,8 @@ type option struct {
 	maxConn int64
 	// ignore errs of initPool
 	keepSilent bool
+	// retry times when watched keys changed in Tx
+	txMaxRetry int64
 
 	// Acquire connection mode
 	// i) block ii) unbloc iii) block with timeout
@@ -39,9 +41,19 @@ type option struct {
 	writeTimeout time.Duration
 	connTimeout  time.Duration
 	// wait duration when pool has no available conn
-	waitTimeout   time.Duration
+	waitTimeout time.Duration
+	// 连接的最大存活时间和最大空闲时间，0 表示不限制
+	maxConnLifetime time.Duration
+	maxIdleTime     time.Duration
+	// 空闲超过该时间的连接取出时先 PING，0 表示不检查
+	testOnBorrow  time.Duration
 	disfEnable    bool
 	nodemgrEnable bool
+	clusterEnable bool
+	// sentinel 监控的 master 名，非空时 addrs 为 sentinel 地址
+	sentinelMaster string
+	// sentinel 模式下只读命令发往从库
+	readFromReplica bool
 
 	// Callback : cmd cost err
 	statFunc func(ctx context.Context, cmd string, cost time.Duration, err error) error
@@ -60,7 +72,7 @@ func SetStatFunc(sFunc func(ctx context.Context, cmd string, cost time.Duration,
 	}
 }
 
-// Prefix 是 redis key 默认的 Prefix
+// Prefix 是 redis key 默认的 Prefix，所有带 key 的命令都会加上该前缀，返回的 key 会去掉前缀
 func Prefix(prefix string) Option {
 	return func(o *option) {
 		o.prefix = prefix
@@ -109,6 +121,28 @@ func SetPoolSize(poolSize int64) Option {
 	}
 }
 
+// SetMaxConnLifetime 设置连接的最大存活时间，超过后关闭重建
+func SetMaxConnLifetime(d time.Duration) Option {
+	return func(o *option) {
+		o.maxConnLifetime = d
+	}
+}
+
+// SetMaxIdleTime 设置连接的最大空闲时间，应小于服务端或 LB 的空闲超时
+// 只统计连接在连接池中的时间，取出连接和后台回收时检查，借出期间的阻塞命令不受影响
+func SetMaxIdleTime(d time.Duration) Option {
+	return func(o *option) {
+		o.maxIdleTime = d
+	}
+}
+
+// SetTestOnBorrow 空闲超过 idle 的连接取出时先 PING，失败则重建
+func SetTestOnBorrow(idle time.Duration) Option {
+	return func(o *option) {
+		o.testOnBorrow = idle
+	}
+}
+
 // SetMaxConn 设置连接池内的连接上限
 func SetMaxConn(max int64) Option {
 	return func(o *option) {
@@ -144,7 +178,7 @@ func EnableDisf() Option {
 	}
 }
 
-// EnableNodemgr 启用nodemgr
+// EnableNodemgr 启用nodemgr，连续失败的节点被摘除，冷却后由后台 PING 探测恢复
 func EnableNodemgr() Option {
 	return func(o *option) {
 		o.nodemgrEnable = true
@@ -192,3 +226,31 @@ func SetSLAFuse(enable bool) Option {
 		o.slaFuse = enable
 	}
 }
+
+// SetTxMaxRetry 设置事务因 watch 的 key 被修改而重试的次数，0 表示不重试，小于 0 使用默认值 3
+func SetTxMaxRetry(n int64) Option {
+	return func(o *option) {
+		o.txMaxRetry = n
+	}
+}
+
+// EnableCluster 启用 redis cluster 模式，addrs 作为获取 CLUSTER SLOTS 的初始节点
+func EnableCluster() Option {
+	return func(o *option) {
+		o.clusterEnable = true
+	}
+}
+
+// EnableSentinel 启用 sentinel 模式，addrs 为 sentinel 地址，masterName 为 sentinel 监控的 master 名
+func EnableSentinel(masterName string) Option {
+	return func(o *option) {
+		o.sentinelMaster = masterName
+	}
+}
+
+// SetReadFromReplica sentinel 模式下将只读命令发往从库
+func SetReadFromReplica(enable bool) Option {
+	return func(o *option) {
+		o.readFromReplica = enable
+	}
+}
@@ -0,0 +1,211 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Reply 批量执行(pipeline)中单条命令的返回值，Exec 之后才可读取
+// 可以直接配合 String、Int64、Values 等封装使用: String(reply.Result())
+type Reply struct {
+	val interface{}
+	err error
+}
+
+// Result 返回命令的原始返回值和错误
+func (r *Reply) Result() (interface{}, error) {
+	return r.val, r.err
+}
+
+type queuedCmd struct {
+	name  string
+	args  []interface{}
+	reply *Reply
+}
+
+// cmdQueue 缓存待发送的命令，Set/HSet 等命令会为 key 加上 Manager 的前缀
+type cmdQueue struct {
+	prefix string
+	cmds   []*queuedCmd
+}
+
+// Send 将任意命令加入队列
+func (q *cmdQueue) Send(cmd string, args ...interface{}) *Reply {
+	r := &Reply{err: ErrReplyNotReady}
+	q.cmds = append(q.cmds, &queuedCmd{name: cmd, args: args, reply: r})
+	return r
+}
+
+// Key 返回加上前缀的 key，通过 Send 发送原始命令时使用
+func (q *cmdQueue) Key(key string) string {
+	return q.prefix + key
+}
+
+// Len 返回队列中的命令数
+func (q *cmdQueue) Len() int {
+	return len(q.cmds)
+}
+
+// Set command
+func (q *cmdQueue) Set(key string, val interface{}) *Reply {
+	return q.Send(commandSet, q.Key(key), val)
+}
+
+// SetEx command
+func (q *cmdQueue) SetEx(key string, expireTime int, val interface{}) *Reply {
+	return q.Send(commandSetEx, q.Key(key), expireTime, val)
+}
+
+// Get command
+func (q *cmdQueue) Get(key string) *Reply {
+	return q.Send(commandGet, q.Key(key))
+}
+
+// Del command
+func (q *cmdQueue) Del(key string) *Reply {
+	return q.Send(commandDel, q.Key(key))
+}
+
+// Expire command
+func (q *cmdQueue) Expire(key string, ttl int64) *Reply {
+	return q.Send(commandExpire, q.Key(key), ttl)
+}
+
+// Incr command
+func (q *cmdQueue) Incr(key string) *Reply {
+	return q.Send(commandIncr, q.Key(key))
+}
+
+// IncrBy command
+func (q *cmdQueue) IncrBy(key string, delt int) *Reply {
+	return q.Send(commandIncrBy, q.Key(key), delt)
+}
+
+// HGet command
+func (q *cmdQueue) HGet(key, sub string) *Reply {
+	return q.Send(commandHGet, q.Key(key), sub)
+}
+
+// HSet command
+func (q *cmdQueue) HSet(key, sub string, val interface{}) *Reply {
+	return q.Send(commandHSet, q.Key(key), sub, val)
+}
+
+// HIncrBy command
+func (q *cmdQueue) HIncrBy(key, sub string, delt int) *Reply {
+	return q.Send(commandHIncrBy, q.Key(key), sub, delt)
+}
+
+// HDel command
+func (q *cmdQueue) HDel(key, sub string) *Reply {
+	return q.Send(commandHDel, q.Key(key), sub)
+}
+
+// LPush command
+func (q *cmdQueue) LPush(key string, val interface{}) *Reply {
+	return q.Send(commandLPush, q.Key(key), val)
+}
+
+// RPush command
+func (q *cmdQueue) RPush(key string, val interface{}) *Reply {
+	return q.Send(commandRPush, q.Key(key), val)
+}
+
+// SAdd command
+func (q *cmdQueue) SAdd(key string, member interface{}) *Reply {
+	return q.Send(commandSAdd, q.Key(key), member)
+}
+
+// SRem command
+func (q *cmdQueue) SRem(key string, member interface{}) *Reply {
+	return q.Send(commandSRem, q.Key(key), member)
+}
+
+// ZAdd command
+func (q *cmdQueue) ZAdd(key string, score float64, member interface{}) *Reply {
+	return q.Send(commandZAdd, q.Key(key), score, member)
+}
+
+// ZIncrBy command
+func (q *cmdQueue) ZIncrBy(key string, incr float64, member interface{}) *Reply {
+	return q.Send(commandZIncrBy, q.Key(key), incr, member)
+}
+
+// ZRem command
+func (q *cmdQueue) ZRem(key string, member interface{}) *Reply {
+	return q.Send(commandZRem, q.Key(key), member)
+}
+
+// Pipeline 在同一个连接上批量发送命令，只产生一次网络往返
+type Pipeline struct {
+	cmdQueue
+	m   *Manager
+	ctx context.Context
+}
+
+// Pipeline 返回一个 pipeline 构造器，命令在 Exec 时才会发送
+// cluster 模式下按 key 所在节点拆分为多个 pipeline，收到 MOVED/ASK 的命令会重新发往目标节点
+func (m *Manager) Pipeline(ctx context.Context) *Pipeline {
+	return &Pipeline{cmdQueue: cmdQueue{prefix: m.opt.prefix}, m: m, ctx: ctx}
+}
+
+// Exec 发送队列中的全部命令并清空队列
+// 返回的 error 只表示连接级别的错误，单条命令的错误通过对应的 Reply 获取
+// 命令发出之后连接出错不会重试，部分命令可能已经执行
+func (p *Pipeline) Exec() error {
+	if len(p.cmds) == 0 {
+		return nil
+	}
+	cmds := p.cmds
+	p.cmds = nil
+	if p.m.cluster != nil {
+		return p.m.cluster.pipeline(p.ctx, cmds)
+	}
+
+	names := make([]interface{}, len(cmds))
+	for i, c := range cmds {
+		names[i] = c.name
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return nil, pipelineDo(conn, cmds)
+	}
+	_, err := p.m.do(p.ctx, action, commandPipeline, names...)
+	if err != nil {
+		for _, c := range cmds {
+			c.reply.val, c.reply.err = nil, err
+		}
+	}
+	return err
+}
+
+// pipelineDo 发送 cmds 并按顺序读取回复
+// bufio 写满时会把已缓存的命令写到 socket，Flush 失败时也可能已经写出部分数据
+// 所以第一条命令之后的 Send 错误和 Flush 错误都按已发送处理，不再重试
+func pipelineDo(conn redis.Conn, cmds []*queuedCmd) error {
+	for i, c := range cmds {
+		if err := conn.Send(c.name, c.args...); err != nil {
+			return sendError(i, err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return sentError{err}
+	}
+	for _, c := range cmds {
+		val, err := conn.Receive()
+		if _, ok := err.(redis.Error); err != nil && !ok {
+			return sentError{err}
+		}
+		c.reply.val, c.reply.err = val, err
+	}
+	return nil
+}
+
+// sendError 包装第 n 次 Send 的错误，之前已经缓存过命令时可能已经写到 socket
+func sendError(n int, err error) error {
+	if n > 0 {
+		return sentError{err}
+	}
+	return err
+}
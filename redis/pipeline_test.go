@@ -0,0 +1,88 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestPipelineExec(t *testing.T) {
+	srv, mgr := newFakeManager(t, Prefix("t:"))
+	ctx := context.Background()
+
+	p := mgr.Pipeline(ctx)
+	set := p.Set("k", "v")
+	incr := p.Incr("k")
+	hset := p.HSet("h", "f", 1)
+	raw := p.Send(commandGet, p.Key("k"))
+	get := p.Get("missing")
+	_, err := raw.Result()
+	assert(t, err == ErrReplyNotReady)
+	assert(t, p.Len() == 5)
+
+	assert(t, p.Exec() == nil)
+	assert(t, p.Len() == 0)
+	// 按入队顺序得到各自的结果，单条命令的错误不影响其他命令
+	ok, err := redis.String(set.Result())
+	assert(t, err == nil && ok == "OK")
+	_, err = incr.Result()
+	_, isRedisErr := err.(redis.Error)
+	assert(t, isRedisErr)
+	n, err := redis.Int(hset.Result())
+	assert(t, err == nil && n == 1)
+	v, err := redis.String(raw.Result())
+	assert(t, err == nil && v == "v")
+	_, err = redis.String(get.Result())
+	assert(t, err == redis.ErrNil)
+
+	// 前缀
+	v, err = mgr.GetString(ctx, "k")
+	assert(t, err == nil && v == "v")
+	raw2 := mgr.Pipeline(ctx)
+	exists := raw2.Send(commandExists, "t:h", "h")
+	assert(t, raw2.Exec() == nil)
+	n, err = redis.Int(exists.Result())
+	assert(t, err == nil && n == 1)
+	assert(t, srv.Calls(commandSet) == 1)
+}
+
+func TestPipelineNoRetryAfterFlush(t *testing.T) {
+	srv, mgr := newFakeManager(t)
+	ctx := context.Background()
+
+	srv.DropNext(commandGet, 1)
+	p := mgr.Pipeline(ctx)
+	incr := p.Incr("n")
+	get := p.Get("n")
+	assert(t, p.Exec() != nil)
+	_, err := incr.Result()
+	assert(t, err != nil)
+	_, err = get.Result()
+	assert(t, err != nil)
+	// INCR 已经执行，不会因为重试执行两次
+	assert(t, srv.Calls(commandIncr) == 1 && srv.Calls(commandGet) == 1)
+	n, err := redis.Int(mgr.Get(ctx, "n"))
+	assert(t, err == nil && n == 1)
+}
+
+func TestPipelineNoRetryAfterPartialWrite(t *testing.T) {
+	srv, mgr := newFakeManager(t)
+	ctx := context.Background()
+
+	// 服务端在第一条 SET 时断开，后面的命令超过 bufio 和 socket 缓冲区，Send 或 Flush 时出错
+	srv.DropNext(commandSet, 1)
+	val := strings.Repeat("x", 64<<10)
+	p := mgr.Pipeline(ctx)
+	incr := p.Incr("n")
+	for i := 0; i < 64; i++ {
+		p.Set("big", val)
+	}
+	assert(t, p.Exec() != nil)
+	_, err := incr.Result()
+	assert(t, err != nil)
+	assert(t, srv.Calls(commandIncr) == 1)
+	n, err := redis.Int(mgr.Get(ctx, "n"))
+	assert(t, err == nil && n == 1)
+}
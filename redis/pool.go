@@ -0,0 +1,216 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dup2X/gopkg/discovery"
+)
+
+const minReapInterval = time.Second
+
+// connPool 连接池，WithPrefix 等派生出的 Manager 共享同一个连接池
+type connPool struct {
+	conns chan *Conn
+
+	mu       sync.Mutex
+	active   int64
+	balancer discovery.Balancer
+
+	// 连接池为空需要等待的次数，等待超时的次数
+	waitCount    int64
+	timeoutCount int64
+
+	// users 正在执行的请求数，retired 之后最后一个请求结束时关闭连接池
+	users   int64
+	retired bool
+
+	done chan struct{}
+	once sync.Once
+}
+
+// PoolStats 连接池状态
+type PoolStats struct {
+	// ActiveConns 使用中的连接数，不包括空闲连接，已建立的连接总数为 ActiveConns + IdleConns
+	ActiveConns int64
+	// IdleConns 连接池中的空闲连接数
+	IdleConns int64
+	// WaitCount 连接池为空需要等待的次数
+	WaitCount int64
+	// TimeoutCount 等待连接超时的次数
+	TimeoutCount int64
+}
+
+func newConnPool(size int64) *connPool {
+	return &connPool{
+		conns: make(chan *Conn, size),
+		done:  make(chan struct{}),
+	}
+}
+
+func (p *connPool) close() {
+	p.once.Do(func() {
+		close(p.done)
+	})
+}
+
+// closed 连接池已关闭，归还的连接直接关闭，获取连接时新建
+func (p *connPool) closed() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *connPool) stats() PoolStats {
+	p.mu.Lock()
+	total := p.active
+	p.mu.Unlock()
+	idle := int64(len(p.conns))
+	// active 和空闲连接数分别读取，并发归还时可能短暂不一致
+	inUse := total - idle
+	if inUse < 0 {
+		inUse = 0
+	}
+	return PoolStats{
+		ActiveConns:  inUse,
+		IdleConns:    idle,
+		WaitCount:    atomic.LoadInt64(&p.waitCount),
+		TimeoutCount: atomic.LoadInt64(&p.timeoutCount),
+	}
+}
+
+// Stats 返回连接池状态，cluster 模式下为所有节点之和
+func (m *Manager) Stats() PoolStats {
+	if m.cluster != nil {
+		var st PoolStats
+		m.cluster.mu.RLock()
+		defer m.cluster.mu.RUnlock()
+		for _, node := range m.cluster.nodes {
+			ns := node.Stats()
+			st.ActiveConns += ns.ActiveConns
+			st.IdleConns += ns.IdleConns
+			st.WaitCount += ns.WaitCount
+			st.TimeoutCount += ns.TimeoutCount
+		}
+		return st
+	}
+	return m.pool.stats()
+}
+
+// enter 和 leave 统计正在使用连接池的请求，retire 据此延迟关闭
+func (m *Manager) enter() {
+	m.pool.mu.Lock()
+	m.pool.users++
+	m.pool.mu.Unlock()
+}
+
+func (m *Manager) leave() {
+	m.pool.mu.Lock()
+	m.pool.users--
+	idle := m.pool.retired && m.pool.users == 0
+	m.pool.mu.Unlock()
+	if idle {
+		m.Close()
+	}
+}
+
+// retire 关闭已下线或被替换的 Manager，等正在执行的请求结束之后再关闭连接池
+// 从旧路由表取到该 Manager 但还没开始执行的请求会在关闭后新建连接，归还时关闭
+func (m *Manager) retire() {
+	m.pool.mu.Lock()
+	m.pool.retired = true
+	idle := m.pool.users == 0
+	m.pool.mu.Unlock()
+	if idle {
+		m.Close()
+	}
+}
+
+// expired 连接超过最大存活时间或最大空闲时间，只用于连接池中的空闲连接
+func (m *Manager) expired(conn *Conn, now time.Time) bool {
+	if m.tooOld(conn, now) {
+		return true
+	}
+	if m.opt.maxIdleTime > 0 && now.Sub(conn.usedAt) >= m.opt.maxIdleTime {
+		return true
+	}
+	return false
+}
+
+// tooOld 连接超过最大存活时间
+// 归还连接时只检查存活时间，usedAt 是上次放回连接池的时间，借出期间一直在使用不算空闲
+func (m *Manager) tooOld(conn *Conn, now time.Time) bool {
+	return m.opt.maxConnLifetime > 0 && now.Sub(conn.createdAt) >= m.opt.maxConnLifetime
+}
+
+// checkConn 检查从连接池取出的连接是否可用，空闲超过 testOnBorrow 时先 PING
+func (m *Manager) checkConn(conn *Conn) bool {
+	now := time.Now()
+	if m.expired(conn, now) {
+		return false
+	}
+	if m.opt.testOnBorrow > 0 && now.Sub(conn.usedAt) >= m.opt.testOnBorrow {
+		if _, err := conn.Do(commandPing); err != nil {
+			m.voteUnhealthy(conn.addr)
+			return false
+		}
+	}
+	return true
+}
+
+// reapInterval 后台回收的周期，没有设置存活时间和空闲时间时不回收
+func reapInterval(opt *option) time.Duration {
+	var d time.Duration
+	for _, v := range []time.Duration{opt.maxConnLifetime, opt.maxIdleTime} {
+		if v > 0 && (d == 0 || v < d) {
+			d = v
+		}
+	}
+	if d == 0 {
+		return 0
+	}
+	if d /= 2; d < minReapInterval {
+		d = minReapInterval
+	}
+	return d
+}
+
+// reap 定期关闭连接池中过期的空闲连接
+func (m *Manager) reap(interval time.Duration) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-m.pool.done:
+			return
+		case <-tk.C:
+			m.reapOnce(time.Now())
+		}
+	}
+}
+
+// reapOnce 遍历一轮空闲连接，未过期的放回连接池
+func (m *Manager) reapOnce(now time.Time) {
+	for n := len(m.pool.conns); n > 0; n-- {
+		var conn *Conn
+		select {
+		case conn = <-m.pool.conns:
+		default:
+			return
+		}
+		if m.expired(conn, now) {
+			m.discardConn(conn)
+			continue
+		}
+		select {
+		case m.pool.conns <- conn:
+		default:
+			m.discardConn(conn)
+		}
+	}
+}
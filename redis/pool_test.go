@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"testing"
+	"time"
+)
+
+type stubConn struct {
+	closed bool
+}
+
+func (c *stubConn) Close() error                                   { c.closed = true; return nil }
+func (c *stubConn) Err() error                                     { return nil }
+func (c *stubConn) Do(string, ...interface{}) (interface{}, error) { return "PONG", nil }
+func (c *stubConn) Send(string, ...interface{}) error              { return nil }
+func (c *stubConn) Flush() error                                   { return nil }
+func (c *stubConn) Receive() (interface{}, error)                  { return nil, nil }
+
+func TestReapInterval(t *testing.T) {
+	assert(t, reapInterval(&option{}) == 0)
+	assert(t, reapInterval(&option{maxConnLifetime: time.Minute, maxIdleTime: time.Second * 10}) == time.Second*5)
+	assert(t, reapInterval(&option{maxIdleTime: time.Millisecond}) == minReapInterval)
+}
+
+func TestPoolReap(t *testing.T) {
+	m := &Manager{
+		opt:  &option{maxConnLifetime: time.Minute, maxIdleTime: time.Second * 10},
+		pool: newConnPool(4),
+	}
+	now := time.Now()
+	fresh := &stubConn{}
+	idle := &stubConn{}
+	old := &stubConn{}
+	m.pool.conns <- &Conn{Conn: fresh, createdAt: now, usedAt: now}
+	m.pool.conns <- &Conn{Conn: idle, createdAt: now, usedAt: now.Add(-time.Second * 11)}
+	m.pool.conns <- &Conn{Conn: old, createdAt: now.Add(-time.Minute), usedAt: now}
+	m.pool.active = 3
+
+	m.reapOnce(now)
+	st := m.Stats()
+	assert(t, st.ActiveConns == 0 && st.IdleConns == 1)
+	assert(t, !fresh.closed && idle.closed && old.closed)
+
+	m.opt.mode = AcquireConnModeTimeout
+	m.opt.waitTimeout = time.Millisecond
+	conn, err := m.getConn()
+	assert(t, err == nil && conn.Conn == fresh)
+	_, err = m.getConn()
+	assert(t, err == ErrAcquiredConnTimeout)
+	st = m.Stats()
+	assert(t, st.ActiveConns == 1 && st.IdleConns == 0)
+	assert(t, st.WaitCount == 1 && st.TimeoutCount == 1)
+}
+
+func TestPutConnAfterLongUse(t *testing.T) {
+	m := &Manager{
+		opt:  &option{maxConnLifetime: time.Minute, maxIdleTime: time.Second * 10},
+		pool: newConnPool(2),
+	}
+	now := time.Now()
+	// 借出之后使用超过 maxIdleTime，例如 BLPOP 或订阅，归还时仍然复用
+	busy := &stubConn{}
+	m.putConn(&Conn{Conn: busy, createdAt: now.Add(-time.Second * 30), usedAt: now.Add(-time.Second * 30)})
+	assert(t, !busy.closed && len(m.pool.conns) == 1)
+	conn := <-m.pool.conns
+	assert(t, time.Since(conn.usedAt) < time.Second)
+
+	// 超过最大存活时间的连接归还时关闭
+	old := &stubConn{}
+	m.pool.active = 1
+	m.putConn(&Conn{Conn: old, createdAt: now.Add(-time.Minute), usedAt: now})
+	assert(t, old.closed && len(m.pool.conns) == 0)
+}
@@ -0,0 +1,56 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// WithPrefix 返回使用前缀 p 的 Manager，与 m 共享连接池，用于同一个集群上的多个业务空间
+// 只有原 Manager 可以关闭连接池，视图的 Close 不做任何操作
+func (m *Manager) WithPrefix(p string) *Manager {
+	opt := *m.opt
+	opt.prefix = p
+	view := *m
+	view.opt = &opt
+	view.view = true
+	return &view
+}
+
+// key 为 key 加上前缀
+func (m *Manager) key(k string) string {
+	return m.opt.prefix + k
+}
+
+func (m *Manager) keys(ks []string) []string {
+	if m.opt.prefix == "" {
+		return ks
+	}
+	ret := make([]string, len(ks))
+	for i, k := range ks {
+		ret[i] = m.key(k)
+	}
+	return ret
+}
+
+// stripKey 去掉返回结果中 key 的前缀
+func (m *Manager) stripKey(k string) string {
+	return strings.TrimPrefix(k, m.opt.prefix)
+}
+
+// stripPopKey BLPOP/BRPOP 返回 [key, value]，去掉 key 的前缀
+func (m *Manager) stripPopKey(reply interface{}, err error) (interface{}, error) {
+	if err != nil || m.opt.prefix == "" {
+		return reply, err
+	}
+	vals, ok := reply.([]interface{})
+	if !ok || len(vals) != 2 {
+		return reply, err
+	}
+	key, e := redis.String(vals[0], nil)
+	if e != nil {
+		return reply, err
+	}
+	return []interface{}{[]byte(m.stripKey(key)), vals[1]}, nil
+}
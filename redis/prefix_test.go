@@ -0,0 +1,58 @@
+package redis
+
+import (
+	"context"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestWithPrefix(t *testing.T) {
+	m := &Manager{opt: &option{prefix: "a:"}, pool: newConnPool(1)}
+	v := m.WithPrefix("b:")
+	assert(t, v.pool == m.pool)
+	assert(t, m.key("k") == "a:k" && v.key("k") == "b:k")
+	ks := v.keys([]string{"x", "y"})
+	assert(t, ks[0] == "b:x" && ks[1] == "b:y")
+	assert(t, v.stripKey("b:x") == "x")
+
+	reply, err := v.stripPopKey([]interface{}{[]byte("b:list"), []byte("v")}, nil)
+	vals := reply.([]interface{})
+	assert(t, err == nil && string(vals[0].([]byte)) == "list" && string(vals[1].([]byte)) == "v")
+
+	p := v.Pipeline(ctx)
+	p.Set("k", 1)
+	p.Send(commandGet, p.Key("k"))
+	assert(t, p.cmds[0].args[0] == "b:k" && p.cmds[1].args[0] == "b:k")
+
+	it := v.Scan(ctx, "user:*", 10)
+	assert(t, it.match == "b:user:*")
+	it.page, it.started, it.cursor = []string{"b:user:1"}, true, "0"
+	assert(t, it.Next() && it.Val() == "user:1")
+	assert(t, v.WithPrefix("c*").Scan(ctx, "", 10).match == `c\**`)
+}
+
+func TestWithPrefixClose(t *testing.T) {
+	_, mgr := newFakeManager(t, Prefix("a:"))
+	v := mgr.WithPrefix("b:")
+	assert(t, v.WithPrefix("c:").Close() == nil)
+	assert(t, v.Close() == nil)
+
+	// 视图关闭后原 Manager 和视图仍然可用
+	_, err := v.Set(context.Background(), "k", 1)
+	assert(t, err == nil)
+	n, err := redis.Int(mgr.WithPrefix("b:").Get(context.Background(), "k"))
+	assert(t, err == nil && n == 1)
+	select {
+	case <-mgr.pool.done:
+		t.Fatal("view closed the shared pool")
+	default:
+	}
+
+	assert(t, mgr.Close() == nil)
+	select {
+	case <-v.pool.done:
+	default:
+		t.Fatal("root did not close the pool")
+	}
+}
@@ -0,0 +1,211 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	pubsubPingInterval = time.Second * 30
+	pubsubMinBackoff   = time.Millisecond * 100
+	pubsubMaxBackoff   = time.Second * 5
+	pubsubBufferSize   = 128
+)
+
+// Message 订阅收到的消息，Pattern 只在 PSubscribe 时有值
+type Message struct {
+	Channel string
+	Pattern string
+	Data    []byte
+}
+
+// Subscription 使用连接池之外的独立连接订阅频道
+// 连接断开后按退避时间重连并重新订阅，断线期间的消息会丢失
+type Subscription struct {
+	m        *Manager
+	channels []interface{}
+	pattern  bool
+	msgs     chan *Message
+
+	done chan struct{}
+	once sync.Once
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+// Publish command
+func (m *Manager) Publish(ctx context.Context, channel string, msg interface{}) (int, error) {
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandPublish, channel, msg)
+	}
+	return redis.Int(m.do(ctx, action, commandPublish, channel, msg))
+}
+
+// Subscribe 订阅频道，ctx 取消或调用 Close 后关闭订阅和消息 channel
+func (m *Manager) Subscribe(ctx context.Context, channels ...string) (*Subscription, error) {
+	return m.subscribe(ctx, false, channels)
+}
+
+// PSubscribe 按模式订阅频道
+func (m *Manager) PSubscribe(ctx context.Context, patterns ...string) (*Subscription, error) {
+	return m.subscribe(ctx, true, patterns)
+}
+
+func (m *Manager) subscribe(ctx context.Context, pattern bool, channels []string) (*Subscription, error) {
+	s := &Subscription{
+		m:        m,
+		channels: make([]interface{}, len(channels)),
+		pattern:  pattern,
+		msgs:     make(chan *Message, pubsubBufferSize),
+		done:     make(chan struct{}),
+	}
+	for i, c := range channels {
+		s.channels[i] = c
+	}
+	psc, err := s.connect()
+	if err != nil {
+		return nil, err
+	}
+	go s.run(psc)
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Close()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// Channel 返回消息 channel，订阅关闭后该 channel 被关闭
+func (s *Subscription) Channel() <-chan *Message {
+	return s.msgs
+}
+
+// Close 关闭订阅
+func (s *Subscription) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
+
+// pubsubAddr 订阅连接使用的地址
+func (m *Manager) pubsubAddr() (string, error) {
+	if m.cluster != nil {
+		addrs := m.cluster.candidates()
+		if len(addrs) == 0 {
+			return "", ErrClusterNoNode
+		}
+		return addrs[0], nil
+	}
+	return m.balancer().Get()
+}
+
+func (s *Subscription) connect() (redis.PubSubConn, error) {
+	addr, err := s.m.pubsubAddr()
+	if err != nil {
+		return redis.PubSubConn{}, err
+	}
+	conn, err := s.m.dial(addr)
+	if err != nil {
+		return redis.PubSubConn{}, err
+	}
+	psc := redis.PubSubConn{Conn: conn.Conn}
+	if s.pattern {
+		err = psc.PSubscribe(s.channels...)
+	} else {
+		err = psc.Subscribe(s.channels...)
+	}
+	if err != nil {
+		conn.Close()
+		return redis.PubSubConn{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		conn.Close()
+		return redis.PubSubConn{}, ErrSubscriptionClosed
+	default:
+	}
+	s.conn = conn
+	return psc, nil
+}
+
+func (s *Subscription) run(psc redis.PubSubConn) {
+	defer close(s.msgs)
+	for {
+		s.receive(psc)
+		backoff := pubsubMinBackoff
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-time.After(backoff):
+			}
+			var err error
+			if psc, err = s.connect(); err == nil {
+				break
+			}
+			if backoff *= 2; backoff > pubsubMaxBackoff {
+				backoff = pubsubMaxBackoff
+			}
+		}
+	}
+}
+
+// receive 阻塞读取消息直到连接出错，期间定时 PING 保活
+func (s *Subscription) receive(psc redis.PubSubConn) {
+	stop := make(chan struct{})
+	defer func() {
+		close(stop)
+		psc.Close()
+	}()
+	go func() {
+		tk := time.NewTicker(pubsubPingInterval)
+		defer tk.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-tk.C:
+				if err := psc.Ping(""); err != nil {
+					psc.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var msg *Message
+		switch v := psc.ReceiveWithTimeout(pubsubPingInterval * 2).(type) {
+		case redis.Message:
+			msg = &Message{Channel: v.Channel, Data: v.Data}
+		case redis.PMessage:
+			msg = &Message{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data}
+		case error:
+			return
+		default:
+			continue
+		}
+		select {
+		case s.msgs <- msg:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/redis/redistest"
+	"github.com/garyburd/redigo/redis"
+)
+
+// publishWait 订阅在服务端生效之前发布的消息会丢失，重复发布直到有订阅者收到
+func publishWait(t *testing.T, mgr *Manager, channel, msg string) {
+	ctx := context.Background()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		n, err := mgr.Publish(ctx, channel, msg)
+		if err == nil && n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no subscriber on %s: %v", channel, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func recvMessage(t *testing.T, sub *Subscription) *Message {
+	select {
+	case msg, ok := <-sub.Channel():
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatal("timeout waiting for message")
+	}
+	return nil
+}
+
+func TestSubscribeDelivery(t *testing.T) {
+	_, mgr := newFakeManager(t)
+	ctx := context.Background()
+
+	sub, err := mgr.Subscribe(ctx, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	publishWait(t, mgr, "a", "1")
+	publishWait(t, mgr, "b", "2")
+	msg := recvMessage(t, sub)
+	assert(t, msg.Channel == "a" && string(msg.Data) == "1" && msg.Pattern == "")
+	msg = recvMessage(t, sub)
+	assert(t, msg.Channel == "b" && string(msg.Data) == "2")
+
+	psub, err := mgr.PSubscribe(ctx, "user:*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer psub.Close()
+	publishWait(t, mgr, "user:1", "x")
+	msg = recvMessage(t, psub)
+	assert(t, msg.Channel == "user:1" && msg.Pattern == "user:*" && string(msg.Data) == "x")
+}
+
+func TestSubscribeReconnect(t *testing.T) {
+	srv, mgr := newFakeManager(t)
+	sub, err := mgr.Subscribe(context.Background(), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	publishWait(t, mgr, "a", "1")
+	recvMessage(t, sub)
+
+	// 服务端在收到 PING 时断开订阅连接，第一次重新订阅也被断开
+	srv.DropNext("PING", 1)
+	srv.DropNext("SUBSCRIBE", 1)
+	sub.mu.Lock()
+	psc := redis.PubSubConn{Conn: sub.conn.Conn}
+	sub.mu.Unlock()
+	assert(t, psc.Ping("") == nil)
+
+	waitCalls(t, srv, "SUBSCRIBE", 3)
+	publishWait(t, mgr, "a", "2")
+	msg := recvMessage(t, sub)
+	assert(t, string(msg.Data) == "2")
+}
+
+func waitCalls(t *testing.T, srv *redistest.Server, cmd string, n int) {
+	deadline := time.Now().Add(3 * time.Second)
+	for srv.Calls(cmd) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s called %d times, want %d", cmd, srv.Calls(cmd), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribeCtxCancel(t *testing.T) {
+	_, mgr := newFakeManager(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := mgr.Subscribe(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publishWait(t, mgr, "a", "1")
+	recvMessage(t, sub)
+
+	cancel()
+	deadline := time.After(3 * time.Second)
+	for {
+		select {
+		case _, ok := <-sub.Channel():
+			if ok {
+				continue
+			}
+		case <-deadline:
+			t.Fatal("channel not closed after ctx cancel")
+		}
+		break
+	}
+	sub.mu.Lock()
+	assert(t, sub.conn == nil)
+	sub.mu.Unlock()
+	assert(t, sub.Close() == nil)
+
+	// 订阅关闭后服务端不再有订阅者
+	n, err := mgr.Publish(context.Background(), "a", "2")
+	for i := 0; err == nil && n > 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		n, err = mgr.Publish(context.Background(), "a", "2")
+	}
+	assert(t, err == nil && n == 0)
+}
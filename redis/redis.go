@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dup2X/gopkg/config"
@@ -38,20 +39,27 @@ const (
 type Conn struct {
 	redis.Conn
 	addr string
+	// 建连时间和最近一次归还连接池的时间
+	createdAt time.Time
+	usedAt    time.Time
 }
 
 // Manager redis client
 type Manager struct {
 	servers []string
 	auth    string
-	// connection pool
-	conns         chan *Conn
-	opt           *option
-	localBalancer discovery.Balancer
-	Connected     int // 初始化新建的可用连接数
-
-	mu         *sync.Mutex
-	activeConn int64
+	// connection pool，WithPrefix 派生的 Manager 共享
+	pool      *connPool
+	opt       *option
+	Connected int // 初始化新建的可用连接数
+	// cluster 模式下的 slot 路由
+	cluster *cluster
+	// sentinel 模式下的主从发现
+	sentinel *sentinel
+	// 节点健康状态统计
+	nodemgr *nodemgr
+	// WithPrefix 派生的视图，Close 不关闭共享的连接池
+	view bool
 }
 
 // NewManagerFromConfig ...
@@ -71,6 +79,18 @@ func NewManagerFromConfig(cfg config.Configer, sec string) (*Manager, error) {
 	if err != nil {
 		return nil, err
 	}
+	sentinelMaster, _ := cfg.GetSetting(sec, "sentinel_master")
+	if sentinelMaster != "" {
+		opts = append(opts, EnableSentinel(sentinelMaster))
+	}
+	readFromReplica, _ := cfg.GetBoolSetting(sec, "read_from_replica")
+	if readFromReplica {
+		opts = append(opts, SetReadFromReplica(true))
+	}
+	clusterEnable, _ := cfg.GetBoolSetting(sec, "cluster_enable")
+	if clusterEnable {
+		opts = append(opts, EnableCluster())
+	}
 	disfEnable, _ := cfg.GetBoolSetting(sec, "disf_enable")
 	if disfEnable {
 		sn, err := cfg.GetSetting(sec, "service_name")
@@ -86,8 +106,7 @@ func NewManagerFromConfig(cfg config.Configer, sec string) (*Manager, error) {
 
 // NewManager ...
 func NewManager(addrs []string, auth string, opts ...Option) (*Manager, error) {
-	var err error
-	opt := &option{}
+	opt := &option{txMaxRetry: -1}
 	for _, o := range opts {
 		o(opt)
 	}
@@ -97,27 +116,54 @@ func NewManager(addrs []string, auth string, opts ...Option) (*Manager, error) {
 	if opt.maxTryTimes == 0 {
 		opt.maxTryTimes = defaultRetryTimes
 	}
+	if opt.txMaxRetry < 0 {
+		opt.txMaxRetry = defaultTxRetryTimes
+	}
 	if opt.maxConn < opt.poolSize {
 		opt.maxConn = opt.poolSize
 	}
+	if opt.workerCycle <= 0 {
+		opt.workerCycle = defaultWorkerCycle
+	}
+	if opt.healthyThreshold <= 0 {
+		opt.healthyThreshold = defaultHealthyThreshold
+	}
+	if opt.maxCooldownTime <= 0 {
+		opt.maxCooldownTime = defaultMaxCooldownTime
+	}
+	if opt.minHealthyRatio <= 0 {
+		opt.minHealthyRatio = defaultMinHealthyRatio
+	}
 	if opt.mode == AcquireConnModeUnblock {
 		opt.waitTimeout = 0
 	} else if opt.mode == AcquireConnModeTimeout && opt.waitTimeout == 0 {
 		opt.waitTimeout = defaultWaitDuration
 	}
+	if opt.clusterEnable {
+		return newClusterManager(addrs, auth, opt)
+	}
+	if opt.sentinelMaster != "" {
+		return newSentinelManager(addrs, auth, opt)
+	}
+	return newManager(addrs, auth, opt)
+}
 
+func newManager(addrs []string, auth string, opt *option) (*Manager, error) {
 	mgr := &Manager{
 		servers: addrs,
 		auth:    auth,
 		opt:     opt,
-		mu:      new(sync.Mutex),
+		pool:    newConnPool(opt.poolSize),
 	}
 
-	mgr.localBalancer, _ = discovery.NewBalancer(
+	mgr.pool.balancer, _ = discovery.NewBalancer(
 		discovery.LOCALTYPE,
 		"",
 		addrs,
 	)
+	if opt.nodemgrEnable {
+		mgr.nodemgr = newNodemgr(mgr)
+	}
 
 	cnt, err := mgr.initPool()
 	mgr.Connected = cnt
@@ -129,7 +175,15 @@ func NewManager(addrs []string, auth string, opts ...Option) (*Manager, error) {
 
 // init connection pool
 func (m *Manager) initPool() (usable int, err error) {
-	m.conns = make(chan *Conn, m.opt.poolSize)
+	if interval := reapInterval(m.opt); interval > 0 {
+		go m.reap(interval)
+	}
+	return m.fillPool()
+}
+
+// fillPool 新建 poolSize 个连接放入连接池
+func (m *Manager) fillPool() (usable int, err error) {
+	loaded := make(map[string]bool)
 	for i := int64(0); i < m.opt.poolSize; i++ {
 		conn, err := m.newConn()
 		if err != nil {
@@ -147,6 +201,10 @@ func (m *Manager) initPool() (usable int, err error) {
 			return usable, err
 		}
 		m.voteHealthy(conn.addr)
+		if !loaded[conn.addr] {
+			loadScripts(conn)
+			loaded[conn.addr] = true
+		}
 		m.putConn(conn)
 		usable++
 	}
@@ -154,6 +212,9 @@ func (m *Manager) initPool() (usable int, err error) {
 }
 
 func (m *Manager) newConn() (*Conn, error) {
+	if m.pool == nil {
+		return nil, ErrClusterNoPool
+	}
 	var (
 		err  error
 		addr string
@@ -161,7 +222,7 @@ func (m *Manager) newConn() (*Conn, error) {
 
 	if addr == "" || err != nil {
 		if addr == "" || err != nil {
-			addr, err = m.localBalancer.Get()
+			addr, err = m.balancer().Get()
 		}
 
 		if err != nil {
@@ -169,6 +230,46 @@ func (m *Manager) newConn() (*Conn, error) {
 		}
 	}
 
+	// 先占用名额再释放锁建连，建连和投票时不能持有 pool.mu，nodemgr 摘除节点时需要获取它
+	m.pool.mu.Lock()
+	if m.pool.active >= m.opt.maxConn {
+		m.pool.mu.Unlock()
+		return nil, fmt.Errorf("too much conns")
+	}
+	m.pool.active++
+	m.pool.mu.Unlock()
+
+	conn, err := m.dial(addr)
+	if err == nil && m.auth != "" {
+		if _, err = conn.Do(commandAuth, m.auth); err != nil {
+			conn.Close()
+		}
+	}
+	if err != nil {
+		m.pool.mu.Lock()
+		m.pool.active--
+		m.pool.mu.Unlock()
+		m.voteUnhealthy(addr)
+		return nil, err
+	}
+	m.voteHealthy(addr)
+	return conn, nil
+}
+
+func (m *Manager) balancer() discovery.Balancer {
+	m.pool.mu.Lock()
+	defer m.pool.mu.Unlock()
+	return m.pool.balancer
+}
+
+func (m *Manager) setBalancer(b discovery.Balancer) {
+	m.pool.mu.Lock()
+	m.pool.balancer = b
+	m.pool.mu.Unlock()
+}
+
+// dial 按照 Manager 的配置新建一个不受连接池管理的连接
+func (m *Manager) dial(addr string) (*Conn, error) {
 	var opts []redis.DialOption
 	if m.opt.db > 0 {
 		opts = append(opts, redis.DialDatabase(m.opt.db))
@@ -185,64 +286,96 @@ func (m *Manager) newConn() (*Conn, error) {
 	if m.auth != "" {
 		opts = append(opts, redis.DialPassword(m.auth))
 	}
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	if m.activeConn >= m.opt.maxConn {
-		return nil, fmt.Errorf("too much conns")
-	}
 	c, err := redis.Dial("tcp4", addr, opts...)
 	if err != nil {
-		m.voteUnhealthy(addr)
 		return nil, err
 	}
-	conn := &Conn{c, addr}
-	if m.auth != "" {
-		_, err = conn.Do(commandAuth, m.auth)
-		if err != nil {
-			m.voteUnhealthy(addr)
-			conn.Close()
-			return nil, err
-		}
-	}
-	m.voteHealthy(addr)
-	m.activeConn++
-	return conn, err
+	now := time.Now()
+	return &Conn{Conn: c, addr: addr, createdAt: now, usedAt: now}, nil
 }
 
 func (m *Manager) voteHealthy(addr string) error {
+	if m.nodemgr != nil {
+		m.nodemgr.voteHealthy(addr)
+	}
 	return nil
 }
 
 func (m *Manager) voteUnhealthy(addr string) error {
+	if m.nodemgr != nil {
+		m.nodemgr.voteUnhealthy(addr)
+	}
 	return nil
 }
 
 func (m *Manager) getConn() (*Conn, error) {
+	if m.pool == nil {
+		return nil, ErrClusterNoPool
+	}
+	if m.pool.closed() {
+		return m.newConn()
+	}
+	var (
+		conn *Conn
+		err  error
+	)
 	switch m.opt.mode {
 	case AcquireConnModeTimeout:
-		return m.getConnTimeout()
+		conn, err = m.getConnTimeout()
 	case AcquireConnModeBlock:
-		return <-m.conns, nil
+		conn, err = m.getConnBlock()
 	case AcquireConnModeUnblock:
-		return m.getConnUnblock()
+		conn, err = m.getConnUnblock()
 	default:
 		return nil, fmt.Errorf("unsupported acquire conn mode: %d", m.opt.mode)
 	}
+	if err != nil {
+		return nil, err
+	}
+	// 过期或探测失败的连接直接关闭，新建一个替代
+	if !m.checkConn(conn) {
+		m.discardConn(conn)
+		return m.newConn()
+	}
+	return conn, nil
+}
+
+func (m *Manager) getConnBlock() (*Conn, error) {
+	select {
+	case conn := <-m.pool.conns:
+		return conn, nil
+	default:
+	}
+	atomic.AddInt64(&m.pool.waitCount, 1)
+	select {
+	case conn := <-m.pool.conns:
+		return conn, nil
+	case <-m.pool.done:
+		return m.newConn()
+	}
 }
 
 func (m *Manager) getConnTimeout() (*Conn, error) {
 	select {
-	case conn := <-m.conns:
+	case conn := <-m.pool.conns:
+		return conn, nil
+	default:
+	}
+	atomic.AddInt64(&m.pool.waitCount, 1)
+	select {
+	case conn := <-m.pool.conns:
 		return conn, nil
+	case <-m.pool.done:
+		return m.newConn()
 	case <-time.After(m.opt.waitTimeout):
+		atomic.AddInt64(&m.pool.timeoutCount, 1)
 		return nil, ErrAcquiredConnTimeout
 	}
 }
 
 func (m *Manager) getConnUnblock() (*Conn, error) {
 	select {
-	case conn := <-m.conns:
+	case conn := <-m.pool.conns:
 		return conn, nil
 	default:
 		return nil, ErrEmptyConnPool
@@ -250,25 +383,102 @@ func (m *Manager) getConnUnblock() (*Conn, error) {
 }
 
 func (m *Manager) putConn(conn *Conn) {
+	if m.sentinel != nil && conn.addr != m.sentinel.masterAddr() {
+		m.discardConn(conn)
+		return
+	}
+	// 连接池已关闭或节点已摘除时连接不再复用
+	if m.pool.closed() || (m.nodemgr != nil && m.nodemgr.isEjected(conn.addr)) {
+		m.discardConn(conn)
+		return
+	}
+	now := time.Now()
+	if m.tooOld(conn, now) {
+		m.discardConn(conn)
+		return
+	}
+	conn.usedAt = now
 	select {
-	case m.conns <- conn:
+	case m.pool.conns <- conn:
 	default:
-		m.mu.Lock()
-		conn.Close()
-		m.activeConn--
-		m.mu.Unlock()
+		m.discardConn(conn)
 	}
 }
 
+// drainPool 关闭连接池中的空闲连接
+func (m *Manager) drainPool() {
+	for {
+		select {
+		case conn := <-m.pool.conns:
+			m.discardConn(conn)
+		default:
+			return
+		}
+	}
+}
+
+// Close 停止后台任务并关闭连接池中的空闲连接，WithPrefix 返回的视图上调用时不做任何操作
+func (m *Manager) Close() error {
+	if m.view {
+		return nil
+	}
+	if m.nodemgr != nil {
+		m.nodemgr.close()
+	}
+	if m.sentinel != nil {
+		m.sentinel.close()
+	}
+	if m.cluster != nil {
+		m.cluster.close()
+		return nil
+	}
+	m.pool.close()
+	m.drainPool()
+	return nil
+}
+
+// discardConn 关闭连接，不再放回连接池
+func (m *Manager) discardConn(conn *Conn) {
+	m.pool.mu.Lock()
+	conn.Close()
+	m.pool.active--
+	m.pool.mu.Unlock()
+}
+
+// acquireConn 从连接池获取连接，连接池不可用时新建连接
+func (m *Manager) acquireConn() (*Conn, error) {
+	conn, err := m.getConn()
+	if err == nil {
+		return conn, nil
+	}
+	return m.newConn()
+}
+
 func (m *Manager) do(ctx context.Context, action func(*Conn) (interface{}, error), cmd string, arg ...interface{}) (interface{}, error) {
+	if m.cluster != nil {
+		var key string
+		if len(arg) > 0 {
+			key = fmt.Sprint(arg[0])
+		}
+		return m.cluster.do(ctx, key, action, cmd, arg...)
+	}
+	if m.sentinel != nil && m.opt.readFromReplica && readOnlyCommands[cmd] {
+		if replica := m.sentinel.replica(); replica != nil {
+			return replica.do(ctx, action, cmd, arg...)
+		}
+	}
 	if m.opt.slaFuse && !dctx.CheckSLA(ctx) {
 		return nil, ErrSLATimeout
 	}
 	et := elapsed.New()
 	et.Start()
 	ret, err := m.redialDo(ctx, action)
-	cost := et.Stop()
+	m.stat(ctx, et.Stop(), err, cmd, arg...)
+	return ret, err
+}
 
+// stat 上报命令耗时到 statFunc 和 ctx
+func (m *Manager) stat(ctx context.Context, cost time.Duration, err error, cmd string, arg ...interface{}) {
 	if m.opt.statFunc != nil {
 		cmdStr := cmd
 		for _, v := range arg {
@@ -278,10 +488,20 @@ func (m *Manager) do(ctx context.Context, action func(*Conn) (interface{}, error
 	}
 
 	dctx.AddRedisElapsed(ctx, cost)
-	return ret, err
+}
+
+// sentError 命令已经发出之后的连接错误，命令可能已经执行，redialDo 不再重试
+type sentError struct {
+	err error
+}
+
+func (e sentError) Error() string {
+	return e.err.Error()
 }
 
 func (m *Manager) redialDo(ctx context.Context, action func(conn *Conn) (interface{}, error)) (reply interface{}, err error) {
+	m.enter()
+	defer m.leave()
 	conn, err := m.getConn()
 	tried := int64(0)
 	if err != nil {
@@ -295,8 +515,16 @@ start:
 		return
 	}
 	reply, err = action(conn)
-	if err != nil {
+	if e, ok := err.(sentError); ok {
 		m.voteUnhealthy(conn.addr)
+		m.discardConn(conn)
+		return nil, e.err
+	}
+	if err != nil {
+		// 服务端返回的错误不计入节点故障
+		if _, ok := err.(redis.Error); !ok {
+			m.voteUnhealthy(conn.addr)
+		}
 		goto retry
 	}
 	m.voteHealthy(conn.addr)
@@ -305,10 +533,7 @@ start:
 
 retry:
 	if conn != nil {
-		m.mu.Lock()
-		conn.Close()
-		m.activeConn--
-		m.mu.Unlock()
+		m.discardConn(conn)
 	}
 	var (
 		newConn *Conn
@@ -324,6 +549,7 @@ retry:
 
 // Set command
 func (m *Manager) Set(ctx context.Context, key string, val interface{}) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSet, key, val)
 	}
@@ -332,6 +558,7 @@ func (m *Manager) Set(ctx context.Context, key string, val interface{}) (reply i
 
 // SetEx command
 func (m *Manager) SetEx(ctx context.Context, key string, expireTime int, val interface{}) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSetEx, key, expireTime, val)
 	}
@@ -340,6 +567,7 @@ func (m *Manager) SetEx(ctx context.Context, key string, expireTime int, val int
 
 // SetNEx setNX与Expire的合并 需要redis版本大于2.6.12
 func (m *Manager) SetNEx(ctx context.Context, key string, expireTime int, val interface{}) (reply interface{}, err error) {
+	key = m.key(key)
 	strVal := fmt.Sprint(val)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSet, key, strVal, "EX", expireTime, "NX")
@@ -349,6 +577,7 @@ func (m *Manager) SetNEx(ctx context.Context, key string, expireTime int, val in
 
 // Get command
 func (m *Manager) Get(ctx context.Context, key string) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandGet, key)
 	}
@@ -357,6 +586,7 @@ func (m *Manager) Get(ctx context.Context, key string) (reply interface{}, err e
 
 // Incr command
 func (m *Manager) Incr(ctx context.Context, key string) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandIncr, key)
 	}
@@ -365,6 +595,7 @@ func (m *Manager) Incr(ctx context.Context, key string) (reply interface{}, err
 
 // IncrBy command
 func (m *Manager) IncrBy(ctx context.Context, key string, delt int) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandIncrBy, key, delt)
 	}
@@ -373,6 +604,7 @@ func (m *Manager) IncrBy(ctx context.Context, key string, delt int) (reply inter
 
 // Decr command
 func (m *Manager) Decr(ctx context.Context, key string) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandDecr, key)
 	}
@@ -381,6 +613,7 @@ func (m *Manager) Decr(ctx context.Context, key string) (reply interface{}, err
 
 // DecrBy command
 func (m *Manager) DecrBy(ctx context.Context, key string, delt int) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandDecrBy, key, delt)
 	}
@@ -389,6 +622,16 @@ func (m *Manager) DecrBy(ctx context.Context, key string, delt int) (reply inter
 
 // MSet command
 func (m *Manager) MSet(ctx context.Context, kv map[string]interface{}) (reply interface{}, err error) {
+	if m.opt.prefix != "" {
+		pkv := make(map[string]interface{}, len(kv))
+		for k, v := range kv {
+			pkv[m.key(k)] = v
+		}
+		kv = pkv
+	}
+	if m.cluster != nil {
+		return m.cluster.mset(ctx, kv)
+	}
 	var kvList []interface{}
 	for k, v := range kv {
 		kvList = append(kvList, k, v)
@@ -401,9 +644,20 @@ func (m *Manager) MSet(ctx context.Context, kv map[string]interface{}) (reply in
 
 // MGet command
 func (m *Manager) MGet(ctx context.Context, keys []string) (map[string]string, error) {
+	if m.cluster != nil {
+		ret, err := m.cluster.mget(ctx, m.keys(keys))
+		if err != nil || m.opt.prefix == "" {
+			return ret, err
+		}
+		stripped := make(map[string]string, len(ret))
+		for k, v := range ret {
+			stripped[m.stripKey(k)] = v
+		}
+		return stripped, nil
+	}
 	var keyList []interface{}
 	for _, k := range keys {
-		keyList = append(keyList, k)
+		keyList = append(keyList, m.key(k))
 	}
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandMGet, keyList...)
@@ -414,6 +668,7 @@ func (m *Manager) MGet(ctx context.Context, keys []string) (map[string]string, e
 
 // Exists command
 func (m *Manager) Exists(ctx context.Context, key string) (bool, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandExists, key)
 	}
@@ -422,6 +677,7 @@ func (m *Manager) Exists(ctx context.Context, key string) (bool, error) {
 
 // Expire command
 func (m *Manager) Expire(ctx context.Context, key string, ttl int64) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandExpire, key, ttl)
 	}
@@ -430,6 +686,7 @@ func (m *Manager) Expire(ctx context.Context, key string, ttl int64) (interface{
 
 // Del command
 func (m *Manager) Del(ctx context.Context, key string) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandDel, key)
 	}
@@ -438,6 +695,7 @@ func (m *Manager) Del(ctx context.Context, key string) (interface{}, error) {
 
 // HExists command
 func (m *Manager) HExists(ctx context.Context, key, sub string) (bool, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHExists, key, sub)
 	}
@@ -446,6 +704,7 @@ func (m *Manager) HExists(ctx context.Context, key, sub string) (bool, error) {
 
 // HGet command
 func (m *Manager) HGet(ctx context.Context, key, sub string) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHGet, key, sub)
 	}
@@ -454,6 +713,7 @@ func (m *Manager) HGet(ctx context.Context, key, sub string) (reply interface{},
 
 // HGetAll 线上应该谨慎(禁止)使用，subKey数目过多时会阻塞请求,影响性能
 func (m *Manager) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHGetAll, key)
 	}
@@ -462,6 +722,7 @@ func (m *Manager) HGetAll(ctx context.Context, key string) (map[string]string, e
 
 // HSet command
 func (m *Manager) HSet(ctx context.Context, key, sub string, val interface{}) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHSet, key, sub, val)
 	}
@@ -470,6 +731,7 @@ func (m *Manager) HSet(ctx context.Context, key, sub string, val interface{}) (r
 
 // HIncrBy command
 func (m *Manager) HIncrBy(ctx context.Context, key, sub string, delt int) (reply interface{}, err error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHIncrBy, key, sub, delt)
 	}
@@ -478,6 +740,7 @@ func (m *Manager) HIncrBy(ctx context.Context, key, sub string, delt int) (reply
 
 // HMSet command
 func (m *Manager) HMSet(ctx context.Context, key string, subKV map[string]interface{}) (interface{}, error) {
+	key = m.key(key)
 	var kvList []interface{}
 	kvList = append(kvList, key)
 	for k, v := range subKV {
@@ -491,6 +754,7 @@ func (m *Manager) HMSet(ctx context.Context, key string, subKV map[string]interf
 
 // HMGet command
 func (m *Manager) HMGet(ctx context.Context, key string, subKeys []string) (map[string]string, error) {
+	key = m.key(key)
 	var args []interface{}
 	args = append(args, key)
 	for _, k := range subKeys {
@@ -505,6 +769,7 @@ func (m *Manager) HMGet(ctx context.Context, key string, subKeys []string) (map[
 
 // HLen command
 func (m *Manager) HLen(ctx context.Context, key string) (int, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHLen, key)
 	}
@@ -513,6 +778,7 @@ func (m *Manager) HLen(ctx context.Context, key string) (int, error) {
 
 // HDel command
 func (m *Manager) HDel(ctx context.Context, key, sub string) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHDel, key, sub)
 	}
@@ -521,6 +787,7 @@ func (m *Manager) HDel(ctx context.Context, key, sub string) (interface{}, error
 
 // HKeys command
 func (m *Manager) HKeys(ctx context.Context, key string) ([]string, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandHKeys, key)
 	}
@@ -529,6 +796,7 @@ func (m *Manager) HKeys(ctx context.Context, key string) ([]string, error) {
 
 // LPush command
 func (m *Manager) LPush(ctx context.Context, key string, val interface{}) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandLPush, key, val)
 	}
@@ -537,6 +805,7 @@ func (m *Manager) LPush(ctx context.Context, key string, val interface{}) (inter
 
 // RPush command
 func (m *Manager) RPush(ctx context.Context, key string, val interface{}) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandRPush, key, val)
 	}
@@ -545,6 +814,7 @@ func (m *Manager) RPush(ctx context.Context, key string, val interface{}) (inter
 
 // LPop command
 func (m *Manager) LPop(ctx context.Context, key string) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandLPop, key)
 	}
@@ -553,6 +823,7 @@ func (m *Manager) LPop(ctx context.Context, key string) (interface{}, error) {
 
 // RPop command
 func (m *Manager) RPop(ctx context.Context, key string) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandRPop, key)
 	}
@@ -561,22 +832,25 @@ func (m *Manager) RPop(ctx context.Context, key string) (interface{}, error) {
 
 // BLPop command
 func (m *Manager) BLPop(ctx context.Context, key string, secTimeout int64) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandBLPop, key, secTimeout)
 	}
-	return m.do(ctx, action, commandBLPop, key, secTimeout)
+	return m.stripPopKey(m.do(ctx, action, commandBLPop, key, secTimeout))
 }
 
 // BRPop command
 func (m *Manager) BRPop(ctx context.Context, key string, secTimeout int64) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandBRPop, key, secTimeout)
 	}
-	return m.do(ctx, action, commandBRPop, key, secTimeout)
+	return m.stripPopKey(m.do(ctx, action, commandBRPop, key, secTimeout))
 }
 
 // LLen command
 func (m *Manager) LLen(ctx context.Context, key string) (int, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandLLen, key)
 	}
@@ -585,6 +859,7 @@ func (m *Manager) LLen(ctx context.Context, key string) (int, error) {
 
 // LRange command
 func (m *Manager) LRange(ctx context.Context, key string, start, end int) ([]interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandLRange, key, start, end)
 	}
@@ -593,6 +868,7 @@ func (m *Manager) LRange(ctx context.Context, key string, start, end int) ([]int
 
 // LRem command
 func (m *Manager) LRem(ctx context.Context, key string, count int, val interface{}) (int64, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandLRem, key, count, val)
 	}
@@ -601,6 +877,7 @@ func (m *Manager) LRem(ctx context.Context, key string, count int, val interface
 
 // SAdd command
 func (m *Manager) SAdd(ctx context.Context, key string, member interface{}) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSAdd, key, member)
 	}
@@ -609,6 +886,7 @@ func (m *Manager) SAdd(ctx context.Context, key string, member interface{}) (int
 
 // SCard command
 func (m *Manager) SCard(ctx context.Context, key string) (int, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSCard, key)
 	}
@@ -617,6 +895,7 @@ func (m *Manager) SCard(ctx context.Context, key string) (int, error) {
 
 // SIsMember command
 func (m *Manager) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSIsMember, key, member)
 	}
@@ -625,6 +904,7 @@ func (m *Manager) SIsMember(ctx context.Context, key string, member interface{})
 
 // SMembers command
 func (m *Manager) SMembers(ctx context.Context, key string) ([]interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSMembers, key)
 	}
@@ -633,6 +913,7 @@ func (m *Manager) SMembers(ctx context.Context, key string) ([]interface{}, erro
 
 // SRem command
 func (m *Manager) SRem(ctx context.Context, key string, member interface{}) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandSRem, key, member)
 	}
@@ -641,6 +922,7 @@ func (m *Manager) SRem(ctx context.Context, key string, member interface{}) (int
 
 // ZAdd command
 func (m *Manager) ZAdd(ctx context.Context, key string, score float64, member interface{}) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandZAdd, key, score, member)
 	}
@@ -649,6 +931,7 @@ func (m *Manager) ZAdd(ctx context.Context, key string, score float64, member in
 
 // ZRangeByScore command
 func (m *Manager) ZRangeByScore(ctx context.Context, key string, min, max float64) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandZRangeByScore, key, min, max)
 	}
@@ -657,6 +940,7 @@ func (m *Manager) ZRangeByScore(ctx context.Context, key string, min, max float6
 
 // ZRemRangeByScore command
 func (m *Manager) ZRemRangeByScore(ctx context.Context, key string, min, max float64) (interface{}, error) {
+	key = m.key(key)
 	action := func(conn *Conn) (interface{}, error) {
 		return conn.Do(commandZRemRangeByScore, key, min, max)
 	}
@@ -665,6 +949,10 @@ func (m *Manager) ZRemRangeByScore(ctx context.Context, key string, min, max flo
 
 // SUnion command
 func (m *Manager) SUnion(ctx context.Context, sets []string) ([]interface{}, error) {
+	sets = m.keys(sets)
+	if m.cluster != nil {
+		return m.cluster.sunion(ctx, sets)
+	}
 	var list []interface{}
 	for _, s := range sets {
 		list = append(list, s)
@@ -681,6 +969,26 @@ func (m *Manager) GetString(ctx context.Context, key string) (reply string, err
 }
 
 func (m *Manager) mockBlock(sec time.Duration) {
+	// cluster 模式下在每个 master 上各占用一个连接
+	if m.cluster != nil {
+		nodes, err := m.cluster.masters()
+		if err != nil {
+			println(err.Error())
+			return
+		}
+		var wg sync.WaitGroup
+		for _, node := range nodes {
+			wg.Add(1)
+			go func(node *Manager) {
+				defer wg.Done()
+				node.mockBlock(sec)
+			}(node)
+		}
+		wg.Wait()
+		return
+	}
+	m.enter()
+	defer m.leave()
 	conn, err := m.getConn()
 	if err != nil {
 		println(err.Error())
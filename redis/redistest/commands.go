@@ -0,0 +1,1726 @@
+// Package redistest 提供进程内的 redis 模拟服务，用于离线测试 redis.Manager
+package redistest
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// handler 在 Server.mu 保护下执行
+type handler func(c *client, d *db, now time.Time, args [][]byte) interface{}
+
+type command struct {
+	fn handler
+	// 参数个数(含命令名)，负数表示至少 -arity 个，与 COMMAND 的返回一致
+	arity int
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":     {cmdPing, -1},
+		"ECHO":     {cmdEcho, 2},
+		"FLUSHALL": {cmdFlushAll, -1},
+		"FLUSHDB":  {cmdFlushDB, -1},
+		"DBSIZE":   {cmdDBSize, 1},
+		"ASKING":   {cmdAsking, 1},
+		"SCRIPT":   {cmdScript, -2},
+		"EVAL":     {cmdEval, -3},
+		"EVALSHA":  {cmdEvalSha, -3},
+
+		"DEL":     {cmdDel, -2},
+		"EXISTS":  {cmdExists, -2},
+		"TYPE":    {cmdType, 2},
+		"EXPIRE":  {cmdExpire, 3},
+		"PEXPIRE": {cmdPExpire, 3},
+		"TTL":     {cmdTTL, 2},
+		"PTTL":    {cmdPTTL, 2},
+		"PERSIST": {cmdPersist, 2},
+		"KEYS":    {cmdKeys, 2},
+		"SCAN":    {cmdScan, -2},
+
+		"SET":    {cmdSet, -3},
+		"SETEX":  {cmdSetEx, 4},
+		"PSETEX": {cmdPSetEx, 4},
+		"SETNX":  {cmdSetNx, 3},
+		"GET":    {cmdGet, 2},
+		"GETSET": {cmdGetSet, 3},
+		"INCR":   {cmdIncr, 2},
+		"INCRBY": {cmdIncrBy, 3},
+		"DECR":   {cmdDecr, 2},
+		"DECRBY": {cmdDecrBy, 3},
+		"MGET":   {cmdMGet, -2},
+		"MSET":   {cmdMSet, -3},
+
+		"HGET":    {cmdHGet, 3},
+		"HGETALL": {cmdHGetAll, 2},
+		"HSET":    {cmdHSet, -4},
+		"HMSET":   {cmdHMSet, -4},
+		"HKEYS":   {cmdHKeys, 2},
+		"HVALS":   {cmdHVals, 2},
+		"HDEL":    {cmdHDel, -3},
+		"HEXISTS": {cmdHExists, 3},
+		"HINCRBY": {cmdHIncrBy, 4},
+		"HMGET":   {cmdHMGet, -3},
+		"HLEN":    {cmdHLen, 2},
+		"HSCAN":   {cmdHScan, -3},
+
+		"LPUSH":  {cmdLPush, -3},
+		"RPUSH":  {cmdRPush, -3},
+		"LPOP":   {cmdLPop, 2},
+		"RPOP":   {cmdRPop, 2},
+		"LLEN":   {cmdLLen, 2},
+		"LRANGE": {cmdLRange, 4},
+		"LREM":   {cmdLRem, 4},
+		"LTRIM":  {cmdLTrim, 4},
+		"LINDEX": {cmdLIndex, 3},
+
+		"SADD":      {cmdSAdd, -3},
+		"SREM":      {cmdSRem, -3},
+		"SCARD":     {cmdSCard, 2},
+		"SISMEMBER": {cmdSIsMember, 3},
+		"SMEMBERS":  {cmdSMembers, 2},
+		"SUNION":    {cmdSUnion, -2},
+		"SSCAN":     {cmdSScan, -3},
+
+		"ZADD":             {cmdZAdd, -4},
+		"ZSCORE":           {cmdZScore, 3},
+		"ZCARD":            {cmdZCard, 2},
+		"ZREM":             {cmdZRem, -3},
+		"ZRANGEBYSCORE":    {cmdZRangeByScore, -4},
+		"ZREVRANGEBYSCORE": {cmdZRevRangeByScore, -4},
+		"ZRANGE":           {cmdZRange, -4},
+		"ZREVRANGE":        {cmdZRevRange, -4},
+		"ZRANK":            {cmdZRank, 3},
+		"ZREVRANK":         {cmdZRevRank, 3},
+		"ZINCRBY":          {cmdZIncrBy, 4},
+		"ZCOUNT":           {cmdZCount, 4},
+		"ZUNIONSTORE":      {cmdZUnionStore, -4},
+		"ZINTERSTORE":      {cmdZInterStore, -4},
+		"ZREMRANGEBYSCORE": {cmdZRemRangeByScore, 4},
+		"ZSCAN":            {cmdZScan, -3},
+
+		"XADD":       {cmdXAdd, -5},
+		"XLEN":       {cmdXLen, 2},
+		"XDEL":       {cmdXDel, -3},
+		"XGROUP":     {cmdXGroup, -2},
+		"XREADGROUP": {cmdXReadGroup, -7},
+		"XACK":       {cmdXAck, -4},
+		"XPENDING":   {cmdXPending, -3},
+		"XCLAIM":     {cmdXClaim, -6},
+
+		"PUBLISH": {cmdPublish, 3},
+
+		"SENTINEL": {cmdSentinel, -2},
+	}
+}
+
+// noReply 回复已经直接写出
+type noReply struct{}
+
+func wrongArgs(cmd string) errReply {
+	return errReply("ERR wrong number of arguments for '" + strings.ToLower(cmd) + "' command")
+}
+
+func checkArity(cmd string, arity, n int) errReply {
+	n++
+	if (arity >= 0 && n != arity) || (arity < 0 && n < -arity) {
+		return wrongArgs(cmd)
+	}
+	return ""
+}
+
+func (c *client) subscribed() bool {
+	return len(c.channels)+len(c.patterns) > 0
+}
+
+func (c *client) dispatch(cmd string, args [][]byte) interface{} {
+	if cmd == "AUTH" {
+		return c.cmdAuth(args)
+	}
+	if !c.authed() {
+		return errReply("NOAUTH Authentication required.")
+	}
+	switch cmd {
+	case "SUBSCRIBE", "PSUBSCRIBE", "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		return c.cmdSubscribe(cmd, args)
+	}
+	if c.subscribed() {
+		if cmd == "PING" {
+			msg := ""
+			if len(args) > 0 {
+				msg = string(args[0])
+			}
+			return []interface{}{"pong", msg}
+		}
+		return errReply("ERR only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT allowed in this context")
+	}
+	switch cmd {
+	case "SELECT":
+		return c.cmdSelect(args)
+	case "MULTI":
+		if c.multi {
+			return errReply("ERR MULTI calls can not be nested")
+		}
+		c.multi, c.queued, c.txErr = true, nil, false
+		return okReply
+	case "EXEC":
+		return c.cmdExec()
+	case "DISCARD":
+		if !c.multi {
+			return errReply("ERR DISCARD without MULTI")
+		}
+		c.multi, c.queued, c.watched = false, nil, nil
+		return okReply
+	case "WATCH":
+		return c.cmdWatch(args)
+	case "UNWATCH":
+		c.watched = nil
+		return okReply
+	}
+
+	spec, ok := commands[cmd]
+	if cmd == "BLPOP" || cmd == "BRPOP" {
+		spec, ok = command{arity: -3}, true
+	}
+	if !ok {
+		if c.multi {
+			c.txErr = true
+		}
+		return errReply("ERR unknown command '" + strings.ToLower(cmd) + "'")
+	}
+	if e := checkArity(cmd, spec.arity, len(args)); e != "" {
+		if c.multi {
+			c.txErr = true
+		}
+		return e
+	}
+	if c.multi {
+		c.queued = append(c.queued, append([][]byte{[]byte(cmd)}, args...))
+		return queuedReply
+	}
+	if spec.fn == nil {
+		return c.cmdBPop(cmd == "BLPOP", args)
+	}
+	if cmd == "XREADGROUP" {
+		return c.cmdXReadGroupBlock(args)
+	}
+	return c.exec(spec.fn, args)
+}
+
+func (c *client) exec(fn handler, args [][]byte) interface{} {
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(c, s.db(c.db), s.now(), args)
+}
+
+func (c *client) cmdAuth(args [][]byte) interface{} {
+	if len(args) != 1 {
+		return wrongArgs("auth")
+	}
+	c.srv.mu.Lock()
+	auth := c.srv.auth
+	c.srv.mu.Unlock()
+	if auth == "" {
+		return errReply("ERR Client sent AUTH, but no password is set")
+	}
+	if string(args[0]) != auth {
+		c.password = ""
+		return errReply("ERR invalid password")
+	}
+	c.password = auth
+	return okReply
+}
+
+func (c *client) cmdSelect(args [][]byte) interface{} {
+	if len(args) != 1 {
+		return wrongArgs("select")
+	}
+	n, err := strconv.Atoi(string(args[0]))
+	if err != nil || n < 0 || n > 15 {
+		return errReply("ERR DB index is out of range")
+	}
+	c.db = n
+	return okReply
+}
+
+func (c *client) cmdWatch(args [][]byte) interface{} {
+	if c.multi {
+		return errReply("ERR WATCH inside MULTI is not allowed")
+	}
+	if len(args) == 0 {
+		return wrongArgs("watch")
+	}
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.db(c.db)
+	if c.watched == nil {
+		c.watched = make(map[string]uint64)
+	}
+	for _, k := range args {
+		d.get(string(k), s.now())
+		c.watched[string(k)] = d.versions[string(k)]
+	}
+	return okReply
+}
+
+func (c *client) cmdExec() interface{} {
+	if !c.multi {
+		return errReply("ERR EXEC without MULTI")
+	}
+	queued, watched, txErr := c.queued, c.watched, c.txErr
+	c.multi, c.queued, c.watched, c.txErr = false, nil, nil, false
+	if txErr {
+		return errReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	s := c.srv
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d := s.db(c.db)
+	now := s.now()
+	for k, v := range watched {
+		d.get(k, now)
+		if d.versions[k] != v {
+			return nilArray{}
+		}
+	}
+	ret := make([]interface{}, len(queued))
+	for i, args := range queued {
+		cmd := string(args[0])
+		if cmd == "BLPOP" || cmd == "BRPOP" {
+			// 事务中不阻塞
+			if ret[i] = bpopOnce(d, now, cmd == "BLPOP", args[1:len(args)-1]); ret[i] == nil {
+				ret[i] = nilArray{}
+			}
+			continue
+		}
+		ret[i] = commands[cmd].fn(c, d, now, args[1:])
+	}
+	return ret
+}
+
+func (c *client) cmdSubscribe(cmd string, args [][]byte) interface{} {
+	s := c.srv
+	pattern := cmd == "PSUBSCRIBE" || cmd == "PUNSUBSCRIBE"
+	subscribe := cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE"
+	if subscribe && len(args) == 0 {
+		return wrongArgs(cmd)
+	}
+
+	s.mu.Lock()
+	set := &c.channels
+	if pattern {
+		set = &c.patterns
+	}
+	if *set == nil {
+		*set = make(map[string]struct{})
+	}
+	if !subscribe && len(args) == 0 {
+		for k := range *set {
+			args = append(args, []byte(k))
+		}
+	}
+	kind := strings.ToLower(cmd)
+	replies := make([]interface{}, 0, len(args))
+	for _, a := range args {
+		if subscribe {
+			(*set)[string(a)] = struct{}{}
+		} else {
+			delete(*set, string(a))
+		}
+		replies = append(replies, []interface{}{kind, a, len(c.channels) + len(c.patterns)})
+	}
+	if len(args) == 0 {
+		replies = append(replies, []interface{}{kind, nil, len(c.channels) + len(c.patterns)})
+	}
+	if c.subscribed() {
+		s.subs[c] = struct{}{}
+	} else {
+		delete(s.subs, c)
+	}
+	s.mu.Unlock()
+
+	for _, r := range replies {
+		c.write(r)
+	}
+	return noReply{}
+}
+
+func cmdPublish(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return c.srv.publishLocked(string(args[0]), args[1])
+}
+
+func (s *Server) publishLocked(ch string, msg []byte) int {
+	n := 0
+	for sub := range s.subs {
+		if _, ok := sub.channels[ch]; ok {
+			sub.write([]interface{}{"message", ch, msg})
+			n++
+		}
+		for p := range sub.patterns {
+			if globMatch(p, ch) {
+				sub.write([]interface{}{"pmessage", p, ch, msg})
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func cmdPing(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if len(args) > 0 {
+		return args[0]
+	}
+	return statusReply("PONG")
+}
+
+// cmdAsking 单节点没有 slot 迁移，ASKING 只返回 OK，用于测试 cluster 的 ASK 重定向
+func cmdAsking(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return okReply
+}
+
+func cmdEcho(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return args[0]
+}
+
+func cmdFlushAll(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	for n, old := range c.srv.dbs {
+		for k := range old.items {
+			old.versions[k]++
+		}
+		c.srv.dbs[n] = &db{items: make(map[string]*item), versions: old.versions}
+	}
+	return okReply
+}
+
+func cmdFlushDB(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	for k := range d.items {
+		d.versions[k]++
+	}
+	d.items = make(map[string]*item)
+	return okReply
+}
+
+func cmdDBSize(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return len(d.keys(now))
+}
+
+func cmdDel(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	n := 0
+	for _, k := range args {
+		if d.del(string(k), now) {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdExists(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	n := 0
+	for _, k := range args {
+		if d.get(string(k), now) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func cmdType(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it := d.get(string(args[0]), now)
+	if it == nil {
+		return statusReply("none")
+	}
+	return statusReply(it.kind)
+}
+
+func expire(d *db, now time.Time, key string, ttl time.Duration) interface{} {
+	it := d.get(key, now)
+	if it == nil {
+		return 0
+	}
+	if ttl <= 0 {
+		d.del(key, now)
+		return 1
+	}
+	it.expireAt = now.Add(ttl)
+	d.touch(key)
+	return 1
+}
+
+func cmdExpire(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	n, ok := parseInt(args[1])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	return expire(d, now, string(args[0]), time.Duration(n)*time.Second)
+}
+
+func cmdPExpire(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	n, ok := parseInt(args[1])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	return expire(d, now, string(args[0]), time.Duration(n)*time.Millisecond)
+}
+
+func ttl(d *db, now time.Time, key string, unit time.Duration) interface{} {
+	it := d.get(key, now)
+	if it == nil {
+		return -2
+	}
+	if it.expireAt.IsZero() {
+		return -1
+	}
+	left := it.expireAt.Sub(now)
+	return int64((left + unit - 1) / unit)
+}
+
+func cmdTTL(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return ttl(d, now, string(args[0]), time.Second)
+}
+
+func cmdPTTL(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return ttl(d, now, string(args[0]), time.Millisecond)
+}
+
+func cmdPersist(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it := d.get(string(args[0]), now)
+	if it == nil || it.expireAt.IsZero() {
+		return 0
+	}
+	it.expireAt = time.Time{}
+	d.touch(string(args[0]))
+	return 1
+}
+
+func cmdKeys(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	ret := []interface{}{}
+	for _, k := range d.keys(now) {
+		if globMatch(string(args[0]), k) {
+			ret = append(ret, k)
+		}
+	}
+	return ret
+}
+
+// scanArgs 解析 cursor [MATCH pattern] [COUNT count]
+func scanArgs(args [][]byte) (cursor int, match string, count int, e errReply) {
+	cursor, err := strconv.Atoi(string(args[0]))
+	if err != nil || cursor < 0 {
+		return 0, "", 0, "ERR invalid cursor"
+	}
+	count = 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return 0, "", 0, msgSyntax
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			match = string(args[i+1])
+		case "COUNT":
+			n, ok := parseInt(args[i+1])
+			if !ok || n < 1 {
+				return 0, "", 0, msgSyntax
+			}
+			count = int(n)
+		default:
+			return 0, "", 0, msgSyntax
+		}
+	}
+	return cursor, match, count, ""
+}
+
+// scan 游标为元素在有序列表中的下标，pairs 为每个元素返回的值
+func scan(names []string, args [][]byte, pairs func(name string) []interface{}) interface{} {
+	cursor, match, count, e := scanArgs(args)
+	if e != "" {
+		return e
+	}
+	items := []interface{}{}
+	next := 0
+	for i := cursor; i < len(names); i++ {
+		if i-cursor >= count {
+			next = i
+			break
+		}
+		if match != "" && !globMatch(match, names[i]) {
+			continue
+		}
+		items = append(items, pairs(names[i])...)
+	}
+	return []interface{}{strconv.Itoa(next), items}
+}
+
+func cmdScan(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return scan(d.keys(now), args, func(k string) []interface{} {
+		return []interface{}{k}
+	})
+}
+
+func cmdSet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	key := string(args[0])
+	var (
+		ttl          time.Duration
+		nx, xx, keep bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keep = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errReply(msgSyntax)
+			}
+			i++
+			n, ok := parseInt(args[i])
+			if !ok {
+				return errReply(msgNotInt)
+			}
+			if n <= 0 {
+				return errReply("ERR invalid expire time in 'set' command")
+			}
+			ttl = time.Duration(n) * time.Second
+			if opt == "PX" {
+				ttl = time.Duration(n) * time.Millisecond
+			}
+		default:
+			return errReply(msgSyntax)
+		}
+	}
+	if nx && xx {
+		return errReply(msgSyntax)
+	}
+	old := d.get(key, now)
+	if (nx && old != nil) || (xx && old == nil) {
+		return nil
+	}
+	it := &item{kind: typeString, str: args[1]}
+	if ttl > 0 {
+		it.expireAt = now.Add(ttl)
+	} else if keep && old != nil {
+		it.expireAt = old.expireAt
+	}
+	d.items[key] = it
+	d.touch(key)
+	return okReply
+}
+
+func cmdSetEx(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return cmdSet(c, d, now, [][]byte{args[0], args[2], []byte("EX"), args[1]})
+}
+
+func cmdPSetEx(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return cmdSet(c, d, now, [][]byte{args[0], args[2], []byte("PX"), args[1]})
+}
+
+func cmdSetNx(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if cmdSet(c, d, now, [][]byte{args[0], args[1], []byte("NX")}) == nil {
+		return 0
+	}
+	return 1
+}
+
+func cmdGet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeString, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return nil
+	}
+	return it.str
+}
+
+func cmdGetSet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	old := cmdGet(c, d, now, args[:1])
+	if _, ok := old.(errReply); ok {
+		return old
+	}
+	cmdSet(c, d, now, args)
+	return old
+}
+
+func incrBy(d *db, now time.Time, key string, delta int64) interface{} {
+	it, e := d.typed(key, typeString, now)
+	if e != "" {
+		return e
+	}
+	var n int64
+	if it != nil {
+		var ok bool
+		if n, ok = parseInt(it.str); !ok {
+			return errReply(msgNotInt)
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return errReply("ERR increment or decrement would overflow")
+	}
+	n += delta
+	if it == nil {
+		it = &item{kind: typeString}
+		d.items[key] = it
+	}
+	it.str = []byte(strconv.FormatInt(n, 10))
+	d.touch(key)
+	return n
+}
+
+func cmdIncr(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return incrBy(d, now, string(args[0]), 1)
+}
+
+func cmdIncrBy(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	n, ok := parseInt(args[1])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	return incrBy(d, now, string(args[0]), n)
+}
+
+func cmdDecr(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return incrBy(d, now, string(args[0]), -1)
+}
+
+func cmdDecrBy(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	n, ok := parseInt(args[1])
+	if !ok || n == math.MinInt64 {
+		return errReply(msgNotInt)
+	}
+	return incrBy(d, now, string(args[0]), -n)
+}
+
+func cmdMGet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	ret := make([]interface{}, len(args))
+	for i, k := range args {
+		if it := d.get(string(k), now); it != nil && it.kind == typeString {
+			ret[i] = it.str
+		}
+	}
+	return ret
+}
+
+func cmdMSet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if len(args)%2 != 0 {
+		return wrongArgs("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		d.items[string(args[i])] = &item{kind: typeString, str: args[i+1]}
+		d.touch(string(args[i]))
+	}
+	return okReply
+}
+
+func cmdHGet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return nil
+	}
+	if v, ok := it.hash[string(args[1])]; ok {
+		return v
+	}
+	return nil
+}
+
+func cmdHGetAll(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	ret := []interface{}{}
+	if it == nil {
+		return ret
+	}
+	for _, f := range sortedFields(it.hash) {
+		ret = append(ret, f, it.hash[f])
+	}
+	return ret
+}
+
+func hset(d *db, now time.Time, args [][]byte) (int, errReply) {
+	if len(args)%2 != 1 {
+		return 0, ""
+	}
+	it, e := d.create(string(args[0]), typeHash, now)
+	if e != "" {
+		return 0, e
+	}
+	n := 0
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := it.hash[string(args[i])]; !ok {
+			n++
+		}
+		it.hash[string(args[i])] = args[i+1]
+	}
+	d.touch(string(args[0]))
+	return n, ""
+}
+
+func cmdHSet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if len(args)%2 != 1 {
+		return wrongArgs("hset")
+	}
+	n, e := hset(d, now, args)
+	if e != "" {
+		return e
+	}
+	return n
+}
+
+func cmdHMSet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if len(args)%2 != 1 {
+		return wrongArgs("hmset")
+	}
+	if _, e := hset(d, now, args); e != "" {
+		return e
+	}
+	return okReply
+}
+
+func cmdHKeys(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	ret := []interface{}{}
+	if it != nil {
+		for _, f := range sortedFields(it.hash) {
+			ret = append(ret, f)
+		}
+	}
+	return ret
+}
+
+func cmdHVals(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	ret := []interface{}{}
+	if it != nil {
+		for _, f := range sortedFields(it.hash) {
+			ret = append(ret, it.hash[f])
+		}
+	}
+	return ret
+}
+
+func cmdHDel(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	n := 0
+	for _, f := range args[1:] {
+		if _, ok := it.hash[string(f)]; ok {
+			delete(it.hash, string(f))
+			n++
+		}
+	}
+	d.touch(string(args[0]))
+	return n
+}
+
+func cmdHExists(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if v := cmdHGet(c, d, now, args); v != nil {
+		if _, ok := v.(errReply); ok {
+			return v
+		}
+		return 1
+	}
+	return 0
+}
+
+func cmdHIncrBy(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	delta, ok := parseInt(args[2])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	it, e := d.create(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	var n int64
+	if v, exists := it.hash[string(args[1])]; exists {
+		if n, ok = parseInt(v); !ok {
+			d.touch(string(args[0]))
+			return errReply("ERR hash value is not an integer")
+		}
+	}
+	n += delta
+	it.hash[string(args[1])] = []byte(strconv.FormatInt(n, 10))
+	d.touch(string(args[0]))
+	return n
+}
+
+func cmdHMGet(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	ret := make([]interface{}, len(args)-1)
+	if it == nil {
+		return ret
+	}
+	for i, f := range args[1:] {
+		if v, ok := it.hash[string(f)]; ok {
+			ret[i] = v
+		}
+	}
+	return ret
+}
+
+func cmdHLen(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	return len(it.hash)
+}
+
+func cmdHScan(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeHash, now)
+	if e != "" {
+		return e
+	}
+	var hash map[string][]byte
+	if it != nil {
+		hash = it.hash
+	}
+	return scan(sortedFields(hash), args[1:], func(f string) []interface{} {
+		return []interface{}{f, hash[f]}
+	})
+}
+
+func push(d *db, now time.Time, args [][]byte, left bool) interface{} {
+	it, e := d.create(string(args[0]), typeList, now)
+	if e != "" {
+		return e
+	}
+	for _, v := range args[1:] {
+		if left {
+			it.list = append([][]byte{v}, it.list...)
+		} else {
+			it.list = append(it.list, v)
+		}
+	}
+	d.touch(string(args[0]))
+	return len(it.list)
+}
+
+func cmdLPush(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return push(d, now, args, true)
+}
+
+func cmdRPush(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return push(d, now, args, false)
+}
+
+func pop(d *db, now time.Time, key string, left bool) interface{} {
+	it, e := d.typed(key, typeList, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return nil
+	}
+	var v []byte
+	if left {
+		v, it.list = it.list[0], it.list[1:]
+	} else {
+		v, it.list = it.list[len(it.list)-1], it.list[:len(it.list)-1]
+	}
+	d.touch(key)
+	return v
+}
+
+func cmdLPop(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return pop(d, now, string(args[0]), true)
+}
+
+func cmdRPop(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return pop(d, now, string(args[0]), false)
+}
+
+// bpopOnce 依次尝试从 keys 中弹出元素，都为空时返回 nil
+func bpopOnce(d *db, now time.Time, left bool, keys [][]byte) interface{} {
+	for _, k := range keys {
+		v := pop(d, now, string(k), left)
+		switch v.(type) {
+		case nil:
+			continue
+		case errReply:
+			return v
+		}
+		return []interface{}{k, v}
+	}
+	return nil
+}
+
+// cmdBPop BLPOP/BRPOP 轮询直到有元素、超时或服务关闭
+func (c *client) cmdBPop(left bool, args [][]byte) interface{} {
+	sec, err := strconv.ParseFloat(string(args[len(args)-1]), 64)
+	if err != nil || sec < 0 {
+		return errReply("ERR timeout is not a float or out of range")
+	}
+	keys := args[:len(args)-1]
+	var deadline time.Time
+	if sec > 0 {
+		deadline = time.Now().Add(time.Duration(sec * float64(time.Second)))
+	}
+	for {
+		s := c.srv
+		s.mu.Lock()
+		v := bpopOnce(s.db(c.db), s.now(), left, keys)
+		closed := s.closed
+		s.mu.Unlock()
+		if v != nil {
+			return v
+		}
+		if closed || (!deadline.IsZero() && time.Now().After(deadline)) {
+			return nilArray{}
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func cmdLLen(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeList, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	return len(it.list)
+}
+
+// listRange 将 redis 的 start/stop(可为负数)转换为切片下标，区间为空时 ok 为 false
+func listRange(n int, start, stop int64) (int, int, bool) {
+	if start < 0 {
+		start += int64(n)
+	}
+	if stop < 0 {
+		stop += int64(n)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= int64(n) {
+		stop = int64(n) - 1
+	}
+	if start > stop || start >= int64(n) {
+		return 0, 0, false
+	}
+	return int(start), int(stop) + 1, true
+}
+
+func cmdLRange(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errReply(msgNotInt)
+	}
+	it, e := d.typed(string(args[0]), typeList, now)
+	if e != "" {
+		return e
+	}
+	ret := []interface{}{}
+	if it == nil {
+		return ret
+	}
+	if lo, hi, ok := listRange(len(it.list), start, stop); ok {
+		for _, v := range it.list[lo:hi] {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func cmdLRem(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	count, ok := parseInt(args[1])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	it, e := d.typed(string(args[0]), typeList, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	val := string(args[2])
+	n := int64(0)
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	match := func(v []byte) bool {
+		if string(v) == val && (limit == 0 || n < limit) {
+			n++
+			return true
+		}
+		return false
+	}
+	kept := make([][]byte, 0, len(it.list))
+	if count >= 0 {
+		for _, v := range it.list {
+			if !match(v) {
+				kept = append(kept, v)
+			}
+		}
+	} else {
+		for i := len(it.list) - 1; i >= 0; i-- {
+			if !match(it.list[i]) {
+				kept = append([][]byte{it.list[i]}, kept...)
+			}
+		}
+	}
+	it.list = kept
+	d.touch(string(args[0]))
+	return n
+}
+
+func cmdLTrim(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errReply(msgNotInt)
+	}
+	it, e := d.typed(string(args[0]), typeList, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return okReply
+	}
+	if lo, hi, ok := listRange(len(it.list), start, stop); ok {
+		it.list = it.list[lo:hi]
+	} else {
+		it.list = nil
+	}
+	d.touch(string(args[0]))
+	return okReply
+}
+
+func cmdLIndex(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	idx, ok := parseInt(args[1])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	it, e := d.typed(string(args[0]), typeList, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return nil
+	}
+	if idx < 0 {
+		idx += int64(len(it.list))
+	}
+	if idx < 0 || idx >= int64(len(it.list)) {
+		return nil
+	}
+	return it.list[idx]
+}
+
+func cmdSAdd(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.create(string(args[0]), typeSet, now)
+	if e != "" {
+		return e
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, ok := it.set[string(m)]; !ok {
+			it.set[string(m)] = struct{}{}
+			n++
+		}
+	}
+	d.touch(string(args[0]))
+	return n
+}
+
+func cmdSRem(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, ok := it.set[string(m)]; ok {
+			delete(it.set, string(m))
+			n++
+		}
+	}
+	d.touch(string(args[0]))
+	return n
+}
+
+func cmdSCard(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	return len(it.set)
+}
+
+func cmdSIsMember(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	if _, ok := it.set[string(args[1])]; ok {
+		return 1
+	}
+	return 0
+}
+
+func setMembers(set map[string]struct{}) []string {
+	ret := make([]string, 0, len(set))
+	for m := range set {
+		ret = append(ret, m)
+	}
+	sortStrings(ret)
+	return ret
+}
+
+func cmdSMembers(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return cmdSUnion(c, d, now, args[:1])
+}
+
+func cmdSUnion(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	union := make(map[string]struct{})
+	for _, k := range args {
+		it, e := d.typed(string(k), typeSet, now)
+		if e != "" {
+			return e
+		}
+		if it == nil {
+			continue
+		}
+		for m := range it.set {
+			union[m] = struct{}{}
+		}
+	}
+	ret := []interface{}{}
+	for _, m := range setMembers(union) {
+		ret = append(ret, m)
+	}
+	return ret
+}
+
+func cmdSScan(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeSet, now)
+	if e != "" {
+		return e
+	}
+	var members []string
+	if it != nil {
+		members = setMembers(it.set)
+	}
+	return scan(members, args[1:], func(m string) []interface{} {
+		return []interface{}{m}
+	})
+}
+
+func cmdZAdd(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	key := string(args[0])
+	var nx, xx, ch, incr bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		case "INCR":
+			incr = true
+			continue
+		}
+		break
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 || (nx && xx) || (incr && len(pairs) != 2) {
+		return errReply(msgSyntax)
+	}
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		f, ok := parseFloat(pairs[j*2])
+		if !ok {
+			return errReply(msgNotFloat)
+		}
+		scores[j] = f
+	}
+	it, e := d.create(key, typeZSet, now)
+	if e != "" {
+		return e
+	}
+	defer d.touch(key)
+	n := 0
+	for j, score := range scores {
+		m := string(pairs[j*2+1])
+		old, exists := it.zset[m]
+		if (nx && exists) || (xx && !exists) {
+			if incr {
+				return nil
+			}
+			continue
+		}
+		if incr {
+			score += old
+			it.zset[m] = score
+			return formatFloat(score)
+		}
+		if !exists {
+			n++
+		} else if ch && old != score {
+			n++
+		}
+		it.zset[m] = score
+	}
+	return n
+}
+
+func cmdZScore(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return nil
+	}
+	if s, ok := it.zset[string(args[1])]; ok {
+		return formatFloat(s)
+	}
+	return nil
+}
+
+func cmdZCard(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	return len(it.zset)
+}
+
+func cmdZRem(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	n := 0
+	for _, m := range args[1:] {
+		if _, ok := it.zset[string(m)]; ok {
+			delete(it.zset, string(m))
+			n++
+		}
+	}
+	d.touch(string(args[0]))
+	return n
+}
+
+// scoreBound 解析 min/max，支持 -inf、+inf 和 ( 开区间
+type scoreBound struct {
+	val  float64
+	open bool
+}
+
+func parseBound(b []byte) (scoreBound, bool) {
+	s := string(b)
+	var bd scoreBound
+	if strings.HasPrefix(s, "(") {
+		bd.open, s = true, s[1:]
+	}
+	f, ok := parseFloat([]byte(s))
+	bd.val = f
+	return bd, ok
+}
+
+func (b scoreBound) below(f float64) bool {
+	if b.open {
+		return b.val < f
+	}
+	return b.val <= f
+}
+
+func (b scoreBound) above(f float64) bool {
+	if b.open {
+		return f < b.val
+	}
+	return f <= b.val
+}
+
+func cmdZRangeByScore(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zrangeByScore(d, now, args, false)
+}
+
+// cmdZRevRangeByScore 参数顺序为 max min
+func cmdZRevRangeByScore(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	args = append([][]byte{args[0], args[2], args[1]}, args[3:]...)
+	return zrangeByScore(d, now, args, true)
+}
+
+func zrangeByScore(d *db, now time.Time, args [][]byte, rev bool) interface{} {
+	min, ok1 := parseBound(args[1])
+	max, ok2 := parseBound(args[2])
+	if !ok1 || !ok2 {
+		return errReply("ERR min or max is not a float")
+	}
+	var (
+		withScores    bool
+		offset, count int64 = 0, -1
+	)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WITHSCORES":
+			withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return errReply(msgSyntax)
+			}
+			var ok bool
+			if offset, ok = parseInt(args[i+1]); !ok {
+				return errReply(msgNotInt)
+			}
+			if count, ok = parseInt(args[i+2]); !ok {
+				return errReply(msgNotInt)
+			}
+			i += 2
+		default:
+			return errReply(msgSyntax)
+		}
+	}
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	ret := []interface{}{}
+	if it == nil || offset < 0 {
+		return ret
+	}
+	for _, z := range sortedZSetDir(it.zset, rev) {
+		if !min.below(z.score) || !max.above(z.score) {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if count == 0 {
+			break
+		}
+		count--
+		ret = append(ret, z.member)
+		if withScores {
+			ret = append(ret, formatFloat(z.score))
+		}
+	}
+	return ret
+}
+
+func cmdZRange(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zrange(d, now, args, false)
+}
+
+func cmdZRevRange(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zrange(d, now, args, true)
+}
+
+func zrange(d *db, now time.Time, args [][]byte, rev bool) interface{} {
+	start, ok1 := parseInt(args[1])
+	stop, ok2 := parseInt(args[2])
+	if !ok1 || !ok2 {
+		return errReply(msgNotInt)
+	}
+	withScores := false
+	switch {
+	case len(args) == 4 && strings.ToUpper(string(args[3])) == "WITHSCORES":
+		withScores = true
+	case len(args) > 3:
+		return errReply(msgSyntax)
+	}
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	ret := []interface{}{}
+	if it == nil {
+		return ret
+	}
+	lst := sortedZSetDir(it.zset, rev)
+	if lo, hi, ok := listRange(len(lst), start, stop); ok {
+		for _, z := range lst[lo:hi] {
+			ret = append(ret, z.member)
+			if withScores {
+				ret = append(ret, formatFloat(z.score))
+			}
+		}
+	}
+	return ret
+}
+
+func cmdZRank(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zrank(d, now, args, false)
+}
+
+func cmdZRevRank(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zrank(d, now, args, true)
+}
+
+func zrank(d *db, now time.Time, args [][]byte, rev bool) interface{} {
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return nil
+	}
+	for i, z := range sortedZSetDir(it.zset, rev) {
+		if z.member == string(args[1]) {
+			return i
+		}
+	}
+	return nil
+}
+
+func cmdZIncrBy(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	incr, ok := parseFloat(args[1])
+	if !ok {
+		return errReply(msgNotFloat)
+	}
+	key := string(args[0])
+	it, e := d.create(key, typeZSet, now)
+	if e != "" {
+		return e
+	}
+	defer d.touch(key)
+	score := it.zset[string(args[2])] + incr
+	if math.IsNaN(score) {
+		return errReply("ERR resulting score is not a number (NaN)")
+	}
+	it.zset[string(args[2])] = score
+	return formatFloat(score)
+}
+
+func cmdZCount(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	min, ok1 := parseBound(args[1])
+	max, ok2 := parseBound(args[2])
+	if !ok1 || !ok2 {
+		return errReply("ERR min or max is not a float")
+	}
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	n := 0
+	if it != nil {
+		for _, s := range it.zset {
+			if min.below(s) && max.above(s) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func cmdZUnionStore(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zstore(d, now, args, false)
+}
+
+func cmdZInterStore(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	return zstore(d, now, args, true)
+}
+
+// zstore dest numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func zstore(d *db, now time.Time, args [][]byte, inter bool) interface{} {
+	numKeys, ok := parseInt(args[1])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	if numKeys < 1 || numKeys > int64(len(args)-2) {
+		return errReply(msgSyntax)
+	}
+	n := int(numKeys)
+	keys := args[2 : 2+n]
+	weights := make([]float64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	for i := 2 + n; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "WEIGHTS":
+			if i+n >= len(args) {
+				return errReply(msgSyntax)
+			}
+			for j := range weights {
+				w, ok := parseFloat(args[i+1+j])
+				if !ok {
+					return errReply("ERR weight value is not a float")
+				}
+				weights[j] = w
+			}
+			i += n
+		case "AGGREGATE":
+			if i+1 >= len(args) {
+				return errReply(msgSyntax)
+			}
+			aggregate = strings.ToUpper(string(args[i+1]))
+			if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+				return errReply(msgSyntax)
+			}
+			i++
+		default:
+			return errReply(msgSyntax)
+		}
+	}
+	// set 类型的 key 按 score 为 1 的 zset 处理
+	sets := make([]map[string]float64, n)
+	for i, k := range keys {
+		it := d.get(string(k), now)
+		switch {
+		case it == nil:
+		case it.kind == typeZSet:
+			sets[i] = it.zset
+		case it.kind == typeSet:
+			sets[i] = make(map[string]float64, len(it.set))
+			for m := range it.set {
+				sets[i][m] = 1
+			}
+		default:
+			return errReply(msgWrongType)
+		}
+	}
+	ret := make(map[string]float64)
+	for i, set := range sets {
+		for m, s := range set {
+			s *= weights[i]
+			old, ok := ret[m]
+			switch {
+			case !ok:
+				ret[m] = s
+			case aggregate == "MIN":
+				ret[m] = math.Min(old, s)
+			case aggregate == "MAX":
+				ret[m] = math.Max(old, s)
+			default:
+				ret[m] = old + s
+			}
+		}
+	}
+	if inter {
+		for m := range ret {
+			for _, set := range sets {
+				if _, ok := set[m]; !ok {
+					delete(ret, m)
+					break
+				}
+			}
+		}
+	}
+	dest := string(args[0])
+	d.del(dest, now)
+	if len(ret) > 0 {
+		d.items[dest] = &item{kind: typeZSet, zset: ret}
+		d.touch(dest)
+	}
+	return len(ret)
+}
+
+func cmdZRemRangeByScore(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	min, ok1 := parseBound(args[1])
+	max, ok2 := parseBound(args[2])
+	if !ok1 || !ok2 {
+		return errReply("ERR min or max is not a float")
+	}
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	n := 0
+	for m, s := range it.zset {
+		if min.below(s) && max.above(s) {
+			delete(it.zset, m)
+			n++
+		}
+	}
+	d.touch(string(args[0]))
+	return n
+}
+
+func cmdZScan(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeZSet, now)
+	if e != "" {
+		return e
+	}
+	var (
+		members []string
+		zset    map[string]float64
+	)
+	if it != nil {
+		zset = it.zset
+		for _, z := range sortedZSet(zset) {
+			members = append(members, z.member)
+		}
+	}
+	return scan(members, args[1:], func(m string) []interface{} {
+		return []interface{}{m, formatFloat(zset[m])}
+	})
+}
+
+func parseInt(b []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	return n, err == nil
+}
+
+func parseFloat(b []byte) (float64, bool) {
+	switch strings.ToLower(string(b)) {
+	case "+inf", "inf":
+		return math.Inf(1), true
+	case "-inf":
+		return math.Inf(-1), true
+	}
+	f, err := strconv.ParseFloat(string(b), 64)
+	return f, err == nil && !math.IsNaN(f)
+}
@@ -0,0 +1,258 @@
+// Package redistest 提供进程内的 redis 模拟服务，用于离线测试 redis.Manager
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	typeString = "string"
+	typeHash   = "hash"
+	typeList   = "list"
+	typeSet    = "set"
+	typeZSet   = "zset"
+	typeStream = "stream"
+)
+
+const (
+	msgWrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+	msgNotInt    = "ERR value is not an integer or out of range"
+	msgNotFloat  = "ERR value is not a valid float"
+	msgSyntax    = "ERR syntax error"
+)
+
+// item 一个 key 对应的值，只有与 kind 对应的字段有效
+type item struct {
+	kind     string
+	str      []byte
+	hash     map[string][]byte
+	list     [][]byte
+	set      map[string]struct{}
+	zset     map[string]float64
+	stream   *stream
+	expireAt time.Time
+}
+
+func (it *item) empty() bool {
+	switch it.kind {
+	case typeHash:
+		return len(it.hash) == 0
+	case typeList:
+		return len(it.list) == 0
+	case typeSet:
+		return len(it.set) == 0
+	case typeZSet:
+		return len(it.zset) == 0
+	}
+	return false
+}
+
+type db struct {
+	items map[string]*item
+	// 每次写入递增，用于 WATCH
+	versions map[string]uint64
+}
+
+func newDB() *db {
+	return &db{
+		items:    make(map[string]*item),
+		versions: make(map[string]uint64),
+	}
+}
+
+// get 返回未过期的 key，过期的 key 被惰性删除
+func (d *db) get(key string, now time.Time) *item {
+	it, ok := d.items[key]
+	if !ok {
+		return nil
+	}
+	if !it.expireAt.IsZero() && !now.Before(it.expireAt) {
+		delete(d.items, key)
+		d.versions[key]++
+		return nil
+	}
+	return it
+}
+
+// typed 返回指定类型的 key，类型不符时返回 WRONGTYPE
+func (d *db) typed(key, kind string, now time.Time) (*item, errReply) {
+	it := d.get(key, now)
+	if it != nil && it.kind != kind {
+		return nil, msgWrongType
+	}
+	return it, ""
+}
+
+// create 返回指定类型的 key，不存在时新建
+func (d *db) create(key, kind string, now time.Time) (*item, errReply) {
+	it, e := d.typed(key, kind, now)
+	if e != "" || it != nil {
+		return it, e
+	}
+	it = &item{kind: kind}
+	switch kind {
+	case typeHash:
+		it.hash = make(map[string][]byte)
+	case typeSet:
+		it.set = make(map[string]struct{})
+	case typeZSet:
+		it.zset = make(map[string]float64)
+	}
+	d.items[key] = it
+	return it, ""
+}
+
+func (d *db) del(key string, now time.Time) bool {
+	if d.get(key, now) == nil {
+		return false
+	}
+	delete(d.items, key)
+	d.touch(key)
+	return true
+}
+
+// touch 标记 key 被修改，集合类型为空时删除 key
+func (d *db) touch(key string) {
+	d.versions[key]++
+	if it, ok := d.items[key]; ok && it.kind != typeString && it.empty() {
+		delete(d.items, key)
+	}
+}
+
+func (d *db) keys(now time.Time) []string {
+	keys := make([]string, 0, len(d.items))
+	for k := range d.items {
+		if d.get(k, now) != nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedFields(hash map[string][]byte) []string {
+	ret := make([]string, 0, len(hash))
+	for f := range hash {
+		ret = append(ret, f)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func sortStrings(s []string) {
+	sort.Strings(s)
+}
+
+type zmember struct {
+	member string
+	score  float64
+}
+
+// sortedZSet 按 score、member 升序排列
+func sortedZSet(z map[string]float64) []zmember {
+	return sortedZSetDir(z, false)
+}
+
+// sortedZSetDir rev 为 true 时按 score、member 降序排列
+func sortedZSetDir(z map[string]float64, rev bool) []zmember {
+	ret := make([]zmember, 0, len(z))
+	for m, s := range z {
+		ret = append(ret, zmember{m, s})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := ret[i], ret[j]
+		if rev {
+			a, b = b, a
+		}
+		if a.score != b.score {
+			return a.score < b.score
+		}
+		return a.member < b.member
+	})
+	return ret
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// globMatch redis 风格的通配符匹配，支持 * ? [...] 和 \ 转义
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := 1
+			for end < len(pattern) && pattern[end] != ']' {
+				if pattern[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(pattern) {
+				return false
+			}
+			if !matchClass(pattern[1:end], s[0]) {
+				return false
+			}
+			pattern = pattern[end:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+	return len(s) == 0
+}
+
+func matchClass(class string, c byte) bool {
+	not := len(class) > 0 && class[0] == '^'
+	if not {
+		class = class[1:]
+	}
+	matched := false
+	for i := 0; i < len(class); i++ {
+		lo := class[i]
+		if lo == '\\' && i+1 < len(class) {
+			i++
+			lo = class[i]
+		}
+		hi := lo
+		if i+2 < len(class) && class[i+1] == '-' {
+			hi = class[i+2]
+			i += 2
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+	}
+	return matched != not
+}
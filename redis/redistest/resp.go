@@ -0,0 +1,111 @@
+// Package redistest 提供进程内的 redis 模拟服务，用于离线测试 redis.Manager
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 回复类型，nil 表示 null bulk
+type (
+	statusReply string
+	errReply    string
+	// nilArray EXEC 被打断、BLPOP 超时等场景的 null array
+	nilArray struct{}
+)
+
+var (
+	okReply     = statusReply("OK")
+	queuedReply = statusReply("QUEUED")
+
+	errProtocol = errors.New("invalid request")
+)
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readCommand 读取一条 multibulk 或 inline 命令
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if line == "" {
+		return nil, nil
+	}
+	if line[0] != '*' {
+		fields := strings.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = []byte(f)
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 {
+		return nil, errProtocol
+	}
+	args := make([][]byte, n)
+	for i := range args {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" || line[0] != '$' {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, errProtocol
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = buf[:size]
+	}
+	return args, nil
+}
+
+func writeReply(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case noReply:
+	case nil:
+		w.WriteString("$-1\r\n")
+	case nilArray:
+		w.WriteString("*-1\r\n")
+	case statusReply:
+		w.WriteString("+" + string(v) + "\r\n")
+	case errReply:
+		w.WriteString("-" + string(v) + "\r\n")
+	case int:
+		w.WriteString(":" + strconv.Itoa(v) + "\r\n")
+	case int64:
+		w.WriteString(":" + strconv.FormatInt(v, 10) + "\r\n")
+	case string:
+		writeBulk(w, []byte(v))
+	case []byte:
+		writeBulk(w, v)
+	case []interface{}:
+		w.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	default:
+		w.WriteString("-ERR redistest: unsupported reply type\r\n")
+	}
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
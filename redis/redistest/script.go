@@ -0,0 +1,253 @@
+package redistest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// cmdScript 支持 LOAD、EXISTS 和 FLUSH，脚本缓存不受 FLUSHALL 影响
+func cmdScript(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	s := c.srv
+	switch strings.ToUpper(string(args[0])) {
+	case "LOAD":
+		if len(args) != 2 {
+			return wrongArgs("script|load")
+		}
+		src := string(args[1])
+		if _, err := compileScript(src); err != nil {
+			return scriptError("ERR Error compiling script (new function): ", err)
+		}
+		sha := scriptSha(src)
+		s.scripts[sha] = src
+		return sha
+	case "EXISTS":
+		ret := make([]interface{}, len(args)-1)
+		for i, sha := range args[1:] {
+			if _, ok := s.scripts[strings.ToLower(string(sha))]; ok {
+				ret[i] = 1
+			} else {
+				ret[i] = 0
+			}
+		}
+		return ret
+	case "FLUSH":
+		s.scripts = make(map[string]string)
+		return okReply
+	}
+	return errReply("ERR redistest: unsupported SCRIPT subcommand")
+}
+
+func cmdEval(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	src := string(args[0])
+	c.srv.scripts[scriptSha(src)] = src
+	return evalScript(c, d, now, src, args[1:])
+}
+
+func cmdEvalSha(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	src, ok := c.srv.scripts[strings.ToLower(string(args[0]))]
+	if !ok {
+		return errReply("NOSCRIPT No matching script. Please use EVAL.")
+	}
+	return evalScript(c, d, now, src, args[1:])
+}
+
+func scriptSha(src string) string {
+	sum := sha1.Sum([]byte(src))
+	return hex.EncodeToString(sum[:])
+}
+
+func compileScript(src string) (*lua.LFunction, error) {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	return L.LoadString(src)
+}
+
+// evalScript 在 Server.mu 保护下执行脚本，args 为 numkeys、keys 和 argv
+// 脚本中的 redis.call 直接调用命令的 handler，执行期间不会插入其他客户端的命令
+func evalScript(c *client, d *db, now time.Time, src string, args [][]byte) interface{} {
+	numKeys, ok := parseInt(args[0])
+	if !ok {
+		return errReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 0 || int(numKeys) > len(args)-1 {
+		return errReply("ERR Number of keys can't be greater than number of args")
+	}
+	keys, argv := args[1:1+numKeys], args[1+numKeys:]
+
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	defer L.Close()
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetGlobal("KEYS", stringsTable(L, keys))
+	L.SetGlobal("ARGV", stringsTable(L, argv))
+
+	call := func(raise bool) lua.LGFunction {
+		return func(L *lua.LState) int {
+			n := L.GetTop()
+			if n == 0 {
+				L.RaiseError("Please specify at least one argument for this redis lib call")
+			}
+			cmdArgs := make([][]byte, n)
+			for i := 1; i <= n; i++ {
+				switch v := L.Get(i).(type) {
+				case lua.LString, lua.LNumber:
+					cmdArgs[i-1] = []byte(v.String())
+				default:
+					L.RaiseError("Lua redis lib command arguments must be strings or integers")
+				}
+			}
+			reply := scriptCall(c, d, now, strings.ToUpper(string(cmdArgs[0])), cmdArgs[1:])
+			if e, ok := reply.(errReply); ok && raise {
+				t := L.NewTable()
+				t.RawSetString("err", lua.LString(e))
+				L.Error(t, 0)
+			}
+			L.Push(toLua(L, reply))
+			return 1
+		}
+	}
+	mod := L.NewTable()
+	mod.RawSetString("call", L.NewFunction(call(true)))
+	mod.RawSetString("pcall", L.NewFunction(call(false)))
+	mod.RawSetString("status_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	mod.RawSetString("error_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetGlobal("redis", mod)
+
+	fn, err := L.LoadString(src)
+	if err != nil {
+		return scriptError("ERR Error compiling script (new function): ", err)
+	}
+	L.Push(fn)
+	if err = L.PCall(0, 1, nil); err != nil {
+		if e, ok := err.(*lua.ApiError); ok {
+			if t, ok := e.Object.(*lua.LTable); ok {
+				if msg, ok := t.RawGetString("err").(lua.LString); ok {
+					return errReply(msg)
+				}
+			}
+		}
+		return scriptError("ERR Error running script: ", err)
+	}
+	return fromLua(L.Get(-1))
+}
+
+// scriptCall 执行脚本中的一条命令，不支持阻塞、事务和订阅类命令
+func scriptCall(c *client, d *db, now time.Time, cmd string, args [][]byte) interface{} {
+	spec, ok := commands[cmd]
+	if !ok || spec.fn == nil {
+		return errReply("ERR Unknown Redis command called from Lua script")
+	}
+	switch cmd {
+	case "EVAL", "EVALSHA", "SCRIPT", "XREADGROUP":
+		return errReply("ERR This Redis command is not allowed from scripts")
+	}
+	if e := checkArity(cmd, spec.arity, len(args)); e != "" {
+		return e
+	}
+	c.srv.calls[cmd]++
+	return spec.fn(c, d, now, args)
+}
+
+// scriptError lua 的错误信息可能跨行，错误回复只能占一行
+func scriptError(prefix string, err error) errReply {
+	return errReply(prefix + strings.Join(strings.Fields(err.Error()), " "))
+}
+
+func stringsTable(L *lua.LState, list [][]byte) *lua.LTable {
+	t := L.CreateTable(len(list), 0)
+	for _, v := range list {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+// toLua 按 redis 的规则把回复转换为 lua 值: nil bulk 为 false，状态和错误回复为带 ok/err 字段的 table
+func toLua(L *lua.LState, v interface{}) lua.LValue {
+	switch v := v.(type) {
+	case nil, nilArray:
+		return lua.LFalse
+	case statusReply:
+		t := L.NewTable()
+		t.RawSetString("ok", lua.LString(v))
+		return t
+	case errReply:
+		t := L.NewTable()
+		t.RawSetString("err", lua.LString(v))
+		return t
+	case int:
+		return lua.LNumber(v)
+	case int64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []byte:
+		return lua.LString(v)
+	case []interface{}:
+		t := L.CreateTable(len(v), 0)
+		for _, e := range v {
+			t.Append(toLua(L, e))
+		}
+		return t
+	}
+	return lua.LFalse
+}
+
+// fromLua 按 redis 的规则把脚本返回值转换为回复: 数字截断为整数，true 为 1，false 为 nil，数组在第一个 nil 处截断
+func fromLua(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LNumber:
+		return int64(v)
+	case lua.LString:
+		return string(v)
+	case lua.LBool:
+		if v {
+			return 1
+		}
+		return nil
+	case *lua.LTable:
+		if ok, isStr := v.RawGetString("ok").(lua.LString); isStr {
+			return statusReply(ok)
+		}
+		if e, isStr := v.RawGetString("err").(lua.LString); isStr {
+			return errReply(e)
+		}
+		var ret []interface{}
+		for i := 1; ; i++ {
+			e := v.RawGetInt(i)
+			if e == lua.LNil {
+				break
+			}
+			ret = append(ret, fromLua(e))
+		}
+		if ret == nil {
+			ret = []interface{}{}
+		}
+		return ret
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package redistest 提供进程内的 redis 模拟服务，用于离线测试 redis.Manager
+package redistest
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// sentinelMaster SetSentinel 设置的一个 master 及其从库
+type sentinelMaster struct {
+	addr     string
+	replicas []string
+}
+
+// SetSentinel 使服务同时作为 sentinel，name 对应的 master 地址为 master，从库为 replicas
+// 地址格式为 host:port，master 为空时取消
+func (s *Server) SetSentinel(name, master string, replicas ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if master == "" {
+		delete(s.sentinels, name)
+		return
+	}
+	s.sentinels[name] = &sentinelMaster{addr: master, replicas: replicas}
+}
+
+// Publish 向订阅了 channel 的客户端发送消息，用于模拟 sentinel 的 +switch-master 等事件
+func (s *Server) Publish(channel, msg string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.publishLocked(channel, []byte(msg))
+}
+
+// cmdSentinel 支持 get-master-addr-by-name 和 slaves/replicas
+func cmdSentinel(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	sub := strings.ToLower(string(args[0]))
+	switch sub {
+	case "get-master-addr-by-name", "slaves", "replicas":
+	default:
+		return errReply("ERR Unknown sentinel subcommand '" + sub + "'")
+	}
+	if len(args) != 2 {
+		return wrongArgs("sentinel " + sub)
+	}
+	m, ok := c.srv.sentinels[string(args[1])]
+	if sub == "get-master-addr-by-name" {
+		if !ok {
+			return nilArray{}
+		}
+		host, port, _ := net.SplitHostPort(m.addr)
+		return []interface{}{host, port}
+	}
+	if !ok {
+		return errReply("ERR No such master with that name")
+	}
+	ret := make([]interface{}, 0, len(m.replicas))
+	for _, addr := range m.replicas {
+		host, port, _ := net.SplitHostPort(addr)
+		ret = append(ret, []interface{}{
+			"name", addr,
+			"ip", host,
+			"port", port,
+			"flags", "slave",
+		})
+	}
+	return ret
+}
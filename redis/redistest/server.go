@@ -0,0 +1,294 @@
+// Package redistest 提供进程内的 redis 模拟服务，用于离线测试 redis.Manager
+// 实现了 strings、hashes、lists、sets、zsets、streams(消费组)、过期、事务、scan 和 pub/sub 的常用命令
+// 支持 EVAL/EVALSHA/SCRIPT 执行 lua 脚本，脚本中可以通过 redis.call 调用非阻塞命令
+// lua 脚本由 github.com/yuin/gopher-lua 执行，只有 import redistest 时才会引入该依赖
+// SetSentinel 之后可以作为 sentinel 使用，只支持 get-master-addr-by-name 和 slaves
+// 不支持 cluster
+package redistest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrClosed 服务已关闭
+var ErrClosed = errors.New("redistest: server closed")
+
+// Server 监听本地随机端口的 RESP 服务
+type Server struct {
+	ln net.Listener
+
+	mu      sync.Mutex
+	auth    string
+	dbs     map[int]*db
+	offset  time.Duration
+	clients map[*client]struct{}
+	subs    map[*client]struct{}
+	hooks   map[string]*hook
+	calls   map[string]int
+	scripts map[string]string
+	closed  bool
+
+	sentinels map[string]*sentinelMaster
+
+	wg sync.WaitGroup
+}
+
+// hook 注入到某个命令上的故障
+type hook struct {
+	err     string
+	latency time.Duration
+	drop    int
+}
+
+// NewServer 在 127.0.0.1 的随机端口上启动服务
+func NewServer() (*Server, error) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		ln:      ln,
+		dbs:     make(map[int]*db),
+		clients: make(map[*client]struct{}),
+		subs:    make(map[*client]struct{}),
+		hooks:   make(map[string]*hook),
+		calls:   make(map[string]int),
+		scripts: make(map[string]string),
+
+		sentinels: make(map[string]*sentinelMaster),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Addr 服务地址，host:port
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Close 关闭服务和所有连接
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.closed = true
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	err := s.ln.Close()
+	s.wg.Wait()
+	return err
+}
+
+// SetAuth 设置密码，设置后连接需要先 AUTH
+func (s *Server) SetAuth(password string) {
+	s.mu.Lock()
+	s.auth = password
+	s.mu.Unlock()
+}
+
+// FlushAll 清空所有数据
+func (s *Server) FlushAll() {
+	s.mu.Lock()
+	s.dbs = make(map[int]*db)
+	s.mu.Unlock()
+}
+
+// FastForward 将服务端时钟向前拨动 d，用于测试过期
+func (s *Server) FastForward(d time.Duration) {
+	s.mu.Lock()
+	s.offset += d
+	s.mu.Unlock()
+}
+
+// SetError 命令 cmd 返回错误 msg，cmd 为 "*" 时对所有命令生效，msg 为空时取消
+// msg 按 redis 错误回复发送，例如 "ERR mocked" 或 "LOADING ..."
+func (s *Server) SetError(cmd, msg string) {
+	s.mu.Lock()
+	s.hookLocked(cmd).err = msg
+	s.mu.Unlock()
+}
+
+// SetLatency 命令 cmd 在回复前等待 d，cmd 为 "*" 时对所有命令生效
+func (s *Server) SetLatency(cmd string, d time.Duration) {
+	s.mu.Lock()
+	s.hookLocked(cmd).latency = d
+	s.mu.Unlock()
+}
+
+// DropNext 接下来 n 次执行 cmd 时直接断开连接而不回复，用于测试重连
+func (s *Server) DropNext(cmd string, n int) {
+	s.mu.Lock()
+	s.hookLocked(cmd).drop = n
+	s.mu.Unlock()
+}
+
+// ClearHooks 取消所有注入的错误、延迟和断连
+func (s *Server) ClearHooks() {
+	s.mu.Lock()
+	s.hooks = make(map[string]*hook)
+	s.mu.Unlock()
+}
+
+// Calls 命令 cmd 被执行的次数，包括被注入错误的调用
+func (s *Server) Calls(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.ToUpper(cmd)]
+}
+
+func (s *Server) hookLocked(cmd string) *hook {
+	cmd = strings.ToUpper(cmd)
+	h, ok := s.hooks[cmd]
+	if !ok {
+		h = &hook{}
+		s.hooks[cmd] = h
+	}
+	return h
+}
+
+func (s *Server) now() time.Time {
+	return time.Now().Add(s.offset)
+}
+
+func (s *Server) db(n int) *db {
+	d, ok := s.dbs[n]
+	if !ok {
+		d = newDB()
+		s.dbs[n] = d
+	}
+	return d
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		c := &client{
+			srv:  s,
+			conn: conn,
+			r:    bufio.NewReader(conn),
+			w:    bufio.NewWriter(conn),
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.clients[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go c.serve()
+	}
+}
+
+// client 一个客户端连接的状态
+type client struct {
+	srv  *Server
+	conn net.Conn
+	r    *bufio.Reader
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	// 最近一次 AUTH 成功的密码，SetAuth 修改密码后需要重新认证
+	password string
+	db       int
+
+	multi   bool
+	queued  [][][]byte
+	txErr   bool
+	watched map[string]uint64
+
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (c *client) serve() {
+	defer func() {
+		c.srv.mu.Lock()
+		delete(c.srv.clients, c)
+		delete(c.srv.subs, c)
+		c.srv.mu.Unlock()
+		c.conn.Close()
+		c.srv.wg.Done()
+	}()
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if err != io.EOF {
+				c.write(errReply("ERR Protocol error: " + err.Error()))
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		cmd := strings.ToUpper(string(args[0]))
+		h, drop := c.srv.applyHooks(cmd)
+		if drop {
+			return
+		}
+		if h.latency > 0 {
+			time.Sleep(h.latency)
+		}
+		if h.err != "" {
+			c.write(errReply(h.err))
+			continue
+		}
+		if cmd == "QUIT" {
+			c.write(okReply)
+			return
+		}
+		c.write(c.dispatch(cmd, args[1:]))
+	}
+}
+
+// applyHooks 统计调用次数并返回生效的注入，"*" 与命令自身的注入叠加
+func (s *Server) applyHooks(cmd string) (h hook, drop bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[cmd]++
+	for _, name := range []string{"*", cmd} {
+		v, ok := s.hooks[name]
+		if !ok {
+			continue
+		}
+		if v.drop > 0 {
+			v.drop--
+			drop = true
+		}
+		if v.err != "" {
+			h.err = v.err
+		}
+		h.latency += v.latency
+	}
+	return
+}
+
+func (c *client) authed() bool {
+	c.srv.mu.Lock()
+	defer c.srv.mu.Unlock()
+	return c.srv.auth == "" || c.password == c.srv.auth
+}
+
+func (c *client) write(v interface{}) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	writeReply(c.w, v)
+	c.w.Flush()
+}
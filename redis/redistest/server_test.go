@@ -0,0 +1,353 @@
+package redistest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func newTestServer(t *testing.T) (*Server, redis.Conn) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := redis.Dial("tcp4", srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Close()
+	})
+	return srv, conn
+}
+
+func TestStrings(t *testing.T) {
+	srv, c := newTestServer(t)
+	if s, err := redis.String(c.Do("SET", "k", "v", "EX", 10)); err != nil || s != "OK" {
+		t.Fatal(s, err)
+	}
+	if s, _ := redis.String(c.Do("GET", "k")); s != "v" {
+		t.Fatal(s)
+	}
+	if _, err := c.Do("SET", "k", "v2", "NX"); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := redis.String(c.Do("GET", "k")); s != "v" {
+		t.Fatal("NX overwrote value")
+	}
+	if n, _ := redis.Int(c.Do("TTL", "k")); n != 10 {
+		t.Fatal(n)
+	}
+	srv.FastForward(time.Second * 10)
+	if _, err := redis.String(c.Do("GET", "k")); err != redis.ErrNil {
+		t.Fatal("key should be expired", err)
+	}
+
+	if n, _ := redis.Int(c.Do("INCRBY", "n", 5)); n != 5 {
+		t.Fatal(n)
+	}
+	if n, _ := redis.Int(c.Do("DECR", "n")); n != 4 {
+		t.Fatal(n)
+	}
+	c.Do("MSET", "a", "1", "b", "2")
+	vals, _ := redis.Strings(c.Do("MGET", "a", "x", "b"))
+	if len(vals) != 3 || vals[0] != "1" || vals[1] != "" || vals[2] != "2" {
+		t.Fatal(vals)
+	}
+	if _, err := c.Do("HGET", "a", "f"); err == nil || err.Error()[:9] != "WRONGTYPE" {
+		t.Fatal(err)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	_, c := newTestServer(t)
+	c.Do("HMSET", "h", "a", 1, "b", 2)
+	m, _ := redis.StringMap(c.Do("HGETALL", "h"))
+	if len(m) != 2 || m["b"] != "2" {
+		t.Fatal(m)
+	}
+	if n, _ := redis.Int(c.Do("HINCRBY", "h", "a", 2)); n != 3 {
+		t.Fatal(n)
+	}
+
+	c.Do("RPUSH", "l", "a", "b", "c", "b")
+	if n, _ := redis.Int(c.Do("LREM", "l", 0, "b")); n != 2 {
+		t.Fatal(n)
+	}
+	l, _ := redis.Strings(c.Do("LRANGE", "l", 0, -1))
+	if len(l) != 2 || l[0] != "a" || l[1] != "c" {
+		t.Fatal(l)
+	}
+	kv, _ := redis.Strings(c.Do("BLPOP", "empty", "l", 1))
+	if len(kv) != 2 || kv[0] != "l" || kv[1] != "a" {
+		t.Fatal(kv)
+	}
+	if v, err := c.Do("BRPOP", "empty", 0.05); v != nil || err != nil {
+		t.Fatal(v, err)
+	}
+
+	c.Do("SADD", "s1", "a", "b")
+	c.Do("SADD", "s2", "b", "c")
+	u, _ := redis.Strings(c.Do("SUNION", "s1", "s2"))
+	if len(u) != 3 {
+		t.Fatal(u)
+	}
+
+	c.Do("ZADD", "z", 1, "a", 2, "b", 3, "c")
+	z, _ := redis.Strings(c.Do("ZRANGEBYSCORE", "z", "(1", "+inf", "WITHSCORES", "LIMIT", 0, 1))
+	if len(z) != 2 || z[0] != "b" || z[1] != "2" {
+		t.Fatal(z)
+	}
+	if n, _ := redis.Int(c.Do("ZREMRANGEBYSCORE", "z", "-inf", 2)); n != 2 {
+		t.Fatal(n)
+	}
+}
+
+func TestScan(t *testing.T) {
+	_, c := newTestServer(t)
+	for _, k := range []string{"user:1", "user:2", "order:1"} {
+		c.Do("SET", k, 1)
+	}
+	var keys []string
+	cursor := "0"
+	for {
+		vals, err := redis.Values(c.Do("SCAN", cursor, "MATCH", "user:*", "COUNT", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, _ := redis.Strings(vals[1], nil)
+		keys = append(keys, page...)
+		if cursor, _ = redis.String(vals[0], nil); cursor == "0" {
+			break
+		}
+	}
+	if len(keys) != 2 || keys[0] != "user:1" {
+		t.Fatal(keys)
+	}
+}
+
+func TestTx(t *testing.T) {
+	srv, c := newTestServer(t)
+	other, err := redis.Dial("tcp4", srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	c.Do("WATCH", "k")
+	other.Do("SET", "k", 1)
+	c.Send("MULTI")
+	c.Send("INCR", "k")
+	if v, err := c.Do("EXEC"); v != nil || err != nil {
+		t.Fatal("EXEC should be aborted", v, err)
+	}
+
+	c.Do("WATCH", "k")
+	c.Send("MULTI")
+	c.Send("INCR", "k")
+	vals, err := redis.Ints(c.Do("EXEC"))
+	if err != nil || len(vals) != 1 || vals[0] != 2 {
+		t.Fatal(vals, err)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	srv, c := newTestServer(t)
+	sub, err := redis.Dial("tcp4", srv.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	psc := redis.PubSubConn{Conn: sub}
+	defer psc.Close()
+	psc.PSubscribe("news.*")
+	if _, ok := psc.Receive().(redis.Subscription); !ok {
+		t.Fatal("expect subscription")
+	}
+	if n, _ := redis.Int(c.Do("PUBLISH", "news.a", "hi")); n != 1 {
+		t.Fatal(n)
+	}
+	msg, ok := psc.Receive().(redis.PMessage)
+	if !ok || msg.Pattern != "news.*" || string(msg.Data) != "hi" {
+		t.Fatal(msg)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	srv, c := newTestServer(t)
+	srv.SetAuth("pw")
+	if _, err := c.Do("GET", "k"); err == nil {
+		t.Fatal("expect NOAUTH")
+	}
+	c.Do("AUTH", "pw")
+
+	srv.SetError("get", "ERR mocked")
+	if _, err := c.Do("GET", "k"); err == nil || err.Error() != "ERR mocked" {
+		t.Fatal(err)
+	}
+	srv.SetError("get", "")
+
+	srv.SetLatency("*", time.Millisecond*50)
+	start := time.Now()
+	c.Do("PING")
+	if time.Since(start) < time.Millisecond*50 {
+		t.Fatal("latency not injected")
+	}
+	srv.ClearHooks()
+
+	srv.DropNext("GET", 1)
+	if _, err := c.Do("GET", "k"); err == nil {
+		t.Fatal("expect connection error")
+	}
+	if srv.Calls("get") != 3 {
+		t.Fatal(srv.Calls("get"))
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "", true},
+		{"user:*", "user:1", true},
+		{"user:?", "user:12", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+		{"a/*", "a/b/c", true},
+	}
+	for _, c := range cases {
+		if got := globMatch(c.pattern, c.s); got != c.want {
+			t.Errorf("globMatch(%q, %q) = %v", c.pattern, c.s, got)
+		}
+	}
+}
+
+func TestStreams(t *testing.T) {
+	srv, c := newTestServer(t)
+	if _, err := c.Do("XGROUP", "CREATE", "s", "g", "0"); err == nil {
+		t.Fatal("XGROUP CREATE without MKSTREAM should fail")
+	}
+	if _, err := c.Do("XGROUP", "CREATE", "s", "g", "0", "MKSTREAM"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Do("XGROUP", "CREATE", "s", "g", "0"); err == nil || err.Error()[:9] != "BUSYGROUP" {
+		t.Fatal(err)
+	}
+	id1, _ := redis.String(c.Do("XADD", "s", "*", "payload", "a"))
+	id2, _ := redis.String(c.Do("XADD", "s", "*", "payload", "b"))
+	if id1 == "" || id1 == id2 {
+		t.Fatal(id1, id2)
+	}
+	if _, err := c.Do("XADD", "s", "1-0", "payload", "c"); err == nil {
+		t.Fatal("XADD with smaller id should fail")
+	}
+
+	reply, err := redis.Values(c.Do("XREADGROUP", "GROUP", "g", "c1", "COUNT", 1, "STREAMS", "s", ">"))
+	if err != nil || len(reply) != 1 {
+		t.Fatal(reply, err)
+	}
+	start := time.Now()
+	reply, err = redis.Values(c.Do("XREADGROUP", "GROUP", "g", "c1", "BLOCK", 50, "STREAMS", "s", ">"))
+	if err != nil || len(reply) != 1 {
+		t.Fatal(reply, err)
+	}
+	if v, err := c.Do("XREADGROUP", "GROUP", "g", "c1", "BLOCK", 50, "STREAMS", "s", ">"); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+	if time.Since(start) < time.Millisecond*50 {
+		t.Fatal("XREADGROUP did not block")
+	}
+
+	if n, _ := redis.Int(c.Do("XACK", "s", "g", id1)); n != 1 {
+		t.Fatal(n)
+	}
+	srv.FastForward(time.Second)
+	pending, _ := redis.Values(c.Do("XPENDING", "s", "g", "-", "+", 10))
+	if len(pending) != 1 {
+		t.Fatal(pending)
+	}
+	var (
+		id, consumer     string
+		idle, deliveries int64
+	)
+	fields, _ := redis.Values(pending[0], nil)
+	if _, err = redis.Scan(fields, &id, &consumer, &idle, &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if id != id2 || consumer != "c1" || idle < 1000 || deliveries != 1 {
+		t.Fatal(id, consumer, idle, deliveries)
+	}
+
+	claimed, _ := redis.Values(c.Do("XCLAIM", "s", "g", "c2", 2000, id2))
+	if len(claimed) != 0 {
+		t.Fatal("claimed message not idle long enough")
+	}
+	claimed, _ = redis.Values(c.Do("XCLAIM", "s", "g", "c2", 500, id2))
+	if len(claimed) != 1 {
+		t.Fatal(claimed)
+	}
+	c.Do("XDEL", "s", id2)
+	claimed, _ = redis.Values(c.Do("XCLAIM", "s", "g", "c1", 0, id2))
+	entry, _ := redis.Values(claimed[0], nil)
+	if len(entry) != 2 || entry[1] != nil {
+		t.Fatal(entry)
+	}
+	if n, _ := redis.Int(c.Do("XLEN", "s")); n != 1 {
+		t.Fatal(n)
+	}
+}
+
+func TestScripting(t *testing.T) {
+	srv, c := newTestServer(t)
+	src := `
+local n = redis.call('INCRBY', KEYS[1], ARGV[1])
+if redis.call('GET', KEYS[2]) == false then
+	redis.call('SET', KEYS[2], n)
+end
+return {n, redis.call('GET', KEYS[2]), redis.status_reply('DONE')}`
+	sha, err := redis.String(c.Do("SCRIPT", "LOAD", src))
+	if err != nil || len(sha) != 40 {
+		t.Fatal(sha, err)
+	}
+	if ok, _ := redis.Ints(c.Do("SCRIPT", "EXISTS", sha, "ffff")); len(ok) != 2 || ok[0] != 1 || ok[1] != 0 {
+		t.Fatal(ok)
+	}
+	vals, err := redis.Values(c.Do("EVALSHA", sha, 2, "n", "first", 3))
+	if err != nil || len(vals) != 3 || vals[0].(int64) != 3 || string(vals[1].([]byte)) != "3" || vals[2] != "DONE" {
+		t.Fatal(vals, err)
+	}
+	vals, _ = redis.Values(c.Do("EVAL", src, 2, "n", "first", 2))
+	if vals[0].(int64) != 5 || string(vals[1].([]byte)) != "3" {
+		t.Fatal(vals)
+	}
+	if srv.Calls("INCRBY") != 2 {
+		t.Fatal(srv.Calls("INCRBY"))
+	}
+
+	// redis.call 的错误中断脚本并原样返回，redis.pcall 返回错误 table
+	c.Do("HSET", "h", "f", "v")
+	if _, err = c.Do("EVAL", "redis.call('INCR', KEYS[1]) return 1", 1, "h"); err == nil || err.Error()[:9] != "WRONGTYPE" {
+		t.Fatal(err)
+	}
+	if n, err := redis.Int(c.Do("EVAL", "local r = redis.pcall('INCR', KEYS[1]) return r.err and 1 or 0", 1, "h")); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if _, err = c.Do("EVAL", "return redis.call('BLPOP', 'l', 0)", 0); err == nil {
+		t.Fatal("blocking command allowed in script")
+	}
+	if _, err = c.Do("EVAL", "return (", 0); err == nil {
+		t.Fatal("expect compile error")
+	}
+
+	if s, _ := redis.String(c.Do("SCRIPT", "FLUSH")); s != "OK" {
+		t.Fatal(s)
+	}
+	if _, err = c.Do("EVALSHA", sha, 0); err == nil || err.Error()[:8] != "NOSCRIPT" {
+		t.Fatal(err)
+	}
+}
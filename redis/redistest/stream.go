@@ -0,0 +1,503 @@
+// Package redistest 提供进程内的 redis 模拟服务，用于离线测试 redis.Manager
+package redistest
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	msgNoStream   = "ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+	msgBusyGroup  = "BUSYGROUP Consumer Group name already exists"
+	msgInvalidID  = "ERR Invalid stream ID specified as stream command argument"
+	msgSmallID    = "ERR The ID specified in XADD is equal or smaller than the target stream top item"
+	msgUnbalanced = "ERR Unbalanced XREAD list of streams: for each stream key an ID or '$' must be specified."
+)
+
+// streamID 消息 id，<ms>-<seq>
+type streamID struct {
+	ms, seq uint64
+}
+
+func (id streamID) less(o streamID) bool {
+	return id.ms < o.ms || id.ms == o.ms && id.seq < o.seq
+}
+
+func (id streamID) String() string {
+	return strconv.FormatUint(id.ms, 10) + "-" + strconv.FormatUint(id.seq, 10)
+}
+
+// parseStreamID 解析 "ms-seq" 或 "ms"，"-" 和 "+" 分别为最小和最大 id
+func parseStreamID(s string) (streamID, bool) {
+	switch s {
+	case "-":
+		return streamID{}, true
+	case "+":
+		return streamID{^uint64(0), ^uint64(0)}, true
+	}
+	var (
+		id  streamID
+		err error
+	)
+	ms, seq := s, ""
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		ms, seq = s[:i], s[i+1:]
+	}
+	if id.ms, err = strconv.ParseUint(ms, 10, 64); err != nil {
+		return id, false
+	}
+	if seq != "" {
+		if id.seq, err = strconv.ParseUint(seq, 10, 64); err != nil {
+			return id, false
+		}
+	}
+	return id, true
+}
+
+type streamEntry struct {
+	id     streamID
+	fields [][]byte
+}
+
+// pendingEntry 消费组中已投递未确认的消息
+type pendingEntry struct {
+	consumer    string
+	deliveredAt time.Time
+	deliveries  int64
+}
+
+type streamGroup struct {
+	lastID  streamID
+	pending map[streamID]*pendingEntry
+}
+
+type stream struct {
+	entries []streamEntry
+	lastID  streamID
+	groups  map[string]*streamGroup
+}
+
+func newStream() *stream {
+	return &stream{groups: make(map[string]*streamGroup)}
+}
+
+// find 返回 id 对应的消息，已被删除时返回 nil
+func (st *stream) find(id streamID) *streamEntry {
+	i := sort.Search(len(st.entries), func(i int) bool { return !st.entries[i].id.less(id) })
+	if i < len(st.entries) && st.entries[i].id == id {
+		return &st.entries[i]
+	}
+	return nil
+}
+
+// entryReply [id, [field, value, ...]]，已被删除的消息 fields 为 nil
+func entryReply(id streamID, e *streamEntry) interface{} {
+	if e == nil {
+		return []interface{}{id.String(), nil}
+	}
+	fields := make([]interface{}, len(e.fields))
+	for i, f := range e.fields {
+		fields[i] = f
+	}
+	return []interface{}{id.String(), fields}
+}
+
+func cmdXAdd(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	key := string(args[0])
+	if len(args[2:])%2 != 0 {
+		return wrongArgs("xadd")
+	}
+	st, e := streamOf(d, key, now)
+	if e != "" {
+		return e
+	}
+	var id streamID
+	if raw := string(args[1]); raw == "*" {
+		id = streamID{ms: uint64(now.UnixNano() / int64(time.Millisecond))}
+		if !st.lastID.less(id) {
+			id = streamID{st.lastID.ms, st.lastID.seq + 1}
+		}
+	} else {
+		var ok bool
+		if id, ok = parseStreamID(raw); !ok {
+			return errReply(msgInvalidID)
+		}
+		if !st.lastID.less(id) {
+			return errReply(msgSmallID)
+		}
+	}
+	if it := d.get(key, now); it == nil {
+		d.items[key] = &item{kind: typeStream, stream: st}
+	}
+	st.entries = append(st.entries, streamEntry{id: id, fields: args[2:]})
+	st.lastID = id
+	d.touch(key)
+	return id.String()
+}
+
+// streamOf 返回 key 对应的 stream，不存在时返回未加入 db 的空 stream
+func streamOf(d *db, key string, now time.Time) (*stream, errReply) {
+	it, e := d.typed(key, typeStream, now)
+	if e != "" {
+		return nil, e
+	}
+	if it == nil {
+		return newStream(), ""
+	}
+	return it.stream, ""
+}
+
+func cmdXLen(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	it, e := d.typed(string(args[0]), typeStream, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	return len(it.stream.entries)
+}
+
+func cmdXDel(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	key := string(args[0])
+	it, e := d.typed(key, typeStream, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		return 0
+	}
+	n := 0
+	for _, raw := range args[1:] {
+		id, ok := parseStreamID(string(raw))
+		if !ok {
+			return errReply(msgInvalidID)
+		}
+		st := it.stream
+		for i := range st.entries {
+			if st.entries[i].id == id {
+				st.entries = append(st.entries[:i], st.entries[i+1:]...)
+				n++
+				break
+			}
+		}
+	}
+	if n > 0 {
+		d.touch(key)
+	}
+	return n
+}
+
+// cmdXGroup 只支持 CREATE key group id [MKSTREAM]
+func cmdXGroup(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	if strings.ToUpper(string(args[0])) != "CREATE" {
+		return errReply("ERR Unknown XGROUP subcommand '" + string(args[0]) + "'")
+	}
+	if len(args) < 4 {
+		return wrongArgs("xgroup create")
+	}
+	key, group := string(args[1]), string(args[2])
+	mkstream := len(args) > 4 && strings.ToUpper(string(args[4])) == "MKSTREAM"
+	it, e := d.typed(key, typeStream, now)
+	if e != "" {
+		return e
+	}
+	if it == nil {
+		if !mkstream {
+			return errReply(msgNoStream)
+		}
+		it = &item{kind: typeStream, stream: newStream()}
+		d.items[key] = it
+	}
+	st := it.stream
+	if _, ok := st.groups[group]; ok {
+		return errReply(msgBusyGroup)
+	}
+	start := st.lastID
+	if raw := string(args[3]); raw != "$" {
+		var ok bool
+		if start, ok = parseStreamID(raw); !ok {
+			return errReply(msgInvalidID)
+		}
+	}
+	st.groups[group] = &streamGroup{lastID: start, pending: make(map[streamID]*pendingEntry)}
+	d.touch(key)
+	return okReply
+}
+
+// streamGroupOf 返回消费组，不存在时返回 NOGROUP
+func streamGroupOf(d *db, now time.Time, key, group, cmd string) (*stream, *streamGroup, errReply) {
+	it, e := d.typed(key, typeStream, now)
+	if e != "" {
+		return nil, nil, e
+	}
+	if it != nil {
+		if g, ok := it.stream.groups[group]; ok {
+			return it.stream, g, ""
+		}
+	}
+	return nil, nil, errReply("NOGROUP No such key '" + key + "' or consumer group '" + group + "' in " + cmd + " with GROUP option")
+}
+
+// xreadGroupArgs XREADGROUP GROUP group consumer [COUNT n] [BLOCK ms] [NOACK] STREAMS key... id...
+type xreadGroupArgs struct {
+	group, consumer string
+	count           int
+	block           time.Duration
+	blocking        bool
+	noack           bool
+	keys, ids       []string
+}
+
+func parseXReadGroup(args [][]byte) (*xreadGroupArgs, errReply) {
+	if strings.ToUpper(string(args[0])) != "GROUP" {
+		return nil, msgSyntax
+	}
+	a := &xreadGroupArgs{group: string(args[1]), consumer: string(args[2])}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COUNT", "BLOCK":
+			if i+1 >= len(args) {
+				return nil, msgSyntax
+			}
+			n, ok := parseInt(args[i+1])
+			if !ok || n < 0 {
+				return nil, msgNotInt
+			}
+			if strings.ToUpper(string(args[i])) == "COUNT" {
+				a.count = int(n)
+			} else {
+				a.block, a.blocking = time.Duration(n)*time.Millisecond, true
+			}
+			i++
+		case "NOACK":
+			a.noack = true
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, msgUnbalanced
+			}
+			for j := 0; j < len(rest)/2; j++ {
+				a.keys = append(a.keys, string(rest[j]))
+				a.ids = append(a.ids, string(rest[len(rest)/2+j]))
+			}
+			return a, ""
+		default:
+			return nil, msgSyntax
+		}
+	}
+	return nil, msgSyntax
+}
+
+// cmdXReadGroup 不阻塞的 XREADGROUP，id 为 ">" 时读取新消息，否则返回该消费者 id 之后的待确认消息
+func cmdXReadGroup(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	a, e := parseXReadGroup(args)
+	if e != "" {
+		return e
+	}
+	var ret []interface{}
+	for i, key := range a.keys {
+		st, g, e := streamGroupOf(d, now, key, a.group, "XREADGROUP")
+		if e != "" {
+			return e
+		}
+		var msgs []interface{}
+		if a.ids[i] == ">" {
+			for _, entry := range st.entries {
+				if a.count > 0 && len(msgs) >= a.count {
+					break
+				}
+				if !g.lastID.less(entry.id) {
+					continue
+				}
+				g.lastID = entry.id
+				if !a.noack {
+					g.pending[entry.id] = &pendingEntry{consumer: a.consumer, deliveredAt: now, deliveries: 1}
+				}
+				entry := entry
+				msgs = append(msgs, entryReply(entry.id, &entry))
+			}
+			if len(msgs) == 0 {
+				continue
+			}
+			d.touch(key)
+		} else {
+			start, ok := parseStreamID(a.ids[i])
+			if !ok {
+				return errReply(msgInvalidID)
+			}
+			msgs = []interface{}{}
+			for _, id := range sortedPending(g, start, streamID{^uint64(0), ^uint64(0)}) {
+				p := g.pending[id]
+				if id == start || p.consumer != a.consumer {
+					continue
+				}
+				if a.count > 0 && len(msgs) >= a.count {
+					break
+				}
+				msgs = append(msgs, entryReply(id, st.find(id)))
+			}
+		}
+		ret = append(ret, []interface{}{key, msgs})
+	}
+	if ret == nil {
+		return nilArray{}
+	}
+	return ret
+}
+
+// cmdXReadGroupBlock BLOCK 时在锁外轮询，直到有新消息或超时，BLOCK 0 一直等待
+func (c *client) cmdXReadGroupBlock(args [][]byte) interface{} {
+	a, e := parseXReadGroup(args)
+	if e != "" {
+		return e
+	}
+	if !a.blocking {
+		return c.exec(cmdXReadGroup, args)
+	}
+	var deadline time.Time
+	if a.block > 0 {
+		deadline = time.Now().Add(a.block)
+	}
+	for {
+		v := c.exec(cmdXReadGroup, args)
+		if _, empty := v.(nilArray); !empty {
+			return v
+		}
+		c.srv.mu.Lock()
+		closed := c.srv.closed
+		c.srv.mu.Unlock()
+		if closed || (!deadline.IsZero() && time.Now().After(deadline)) {
+			return v
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+// sortedPending 返回 [start, end] 内的待确认 id，按 id 排序
+func sortedPending(g *streamGroup, start, end streamID) []streamID {
+	ids := make([]streamID, 0, len(g.pending))
+	for id := range g.pending {
+		if !id.less(start) && !end.less(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].less(ids[j]) })
+	return ids
+}
+
+func cmdXAck(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	key := string(args[0])
+	_, g, e := streamGroupOf(d, now, key, string(args[1]), "XACK")
+	if e != "" {
+		if strings.HasPrefix(string(e), "NOGROUP") {
+			return 0
+		}
+		return e
+	}
+	n := 0
+	for _, raw := range args[2:] {
+		id, ok := parseStreamID(string(raw))
+		if !ok {
+			return errReply(msgInvalidID)
+		}
+		if _, ok := g.pending[id]; ok {
+			delete(g.pending, id)
+			n++
+		}
+	}
+	if n > 0 {
+		d.touch(key)
+	}
+	return n
+}
+
+// cmdXPending 支持 XPENDING key group 的汇总形式和 XPENDING key group start end count [consumer]
+func cmdXPending(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	_, g, e := streamGroupOf(d, now, string(args[0]), string(args[1]), "XPENDING")
+	if e != "" {
+		return e
+	}
+	all := sortedPending(g, streamID{}, streamID{^uint64(0), ^uint64(0)})
+	if len(args) == 2 {
+		if len(all) == 0 {
+			return []interface{}{0, nil, nil, nil}
+		}
+		counts := make(map[string]int)
+		var consumers []string
+		for _, id := range all {
+			name := g.pending[id].consumer
+			if counts[name] == 0 {
+				consumers = append(consumers, name)
+			}
+			counts[name]++
+		}
+		sort.Strings(consumers)
+		per := make([]interface{}, len(consumers))
+		for i, name := range consumers {
+			per[i] = []interface{}{name, strconv.Itoa(counts[name])}
+		}
+		return []interface{}{len(all), all[0].String(), all[len(all)-1].String(), per}
+	}
+	if len(args) < 5 {
+		return errReply(msgSyntax)
+	}
+	start, ok1 := parseStreamID(string(args[2]))
+	end, ok2 := parseStreamID(string(args[3]))
+	if !ok1 || !ok2 {
+		return errReply(msgInvalidID)
+	}
+	count, ok := parseInt(args[4])
+	if !ok {
+		return errReply(msgNotInt)
+	}
+	var consumer string
+	if len(args) > 5 {
+		consumer = string(args[5])
+	}
+	ret := []interface{}{}
+	for _, id := range sortedPending(g, start, end) {
+		if int64(len(ret)) >= count {
+			break
+		}
+		p := g.pending[id]
+		if consumer != "" && p.consumer != consumer {
+			continue
+		}
+		idle := now.Sub(p.deliveredAt) / time.Millisecond
+		ret = append(ret, []interface{}{id.String(), p.consumer, int64(idle), p.deliveries})
+	}
+	return ret
+}
+
+// cmdXClaim XCLAIM key group consumer min-idle-time id...，不支持 IDLE、JUSTID 等选项
+func cmdXClaim(c *client, d *db, now time.Time, args [][]byte) interface{} {
+	key := string(args[0])
+	st, g, e := streamGroupOf(d, now, key, string(args[1]), "XCLAIM")
+	if e != "" {
+		return e
+	}
+	consumer := string(args[2])
+	minIdle, ok := parseInt(args[3])
+	if !ok {
+		return errReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	ret := []interface{}{}
+	for _, raw := range args[4:] {
+		id, ok := parseStreamID(string(raw))
+		if !ok {
+			return errReply(msgInvalidID)
+		}
+		p, ok := g.pending[id]
+		if !ok || now.Sub(p.deliveredAt) < time.Duration(minIdle)*time.Millisecond {
+			continue
+		}
+		p.consumer, p.deliveredAt = consumer, now
+		p.deliveries++
+		ret = append(ret, entryReply(id, st.find(id)))
+	}
+	d.touch(key)
+	return ret
+}
@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/redis/redistest"
+	"github.com/garyburd/redigo/redis"
+)
+
+func newFakeManager(t *testing.T, opts ...Option) (*redistest.Server, *Manager) {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	mgr, err := NewManager([]string{srv.Addr()}, "", append([]Option{SetPoolSize(2)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mgr.Close() })
+	return srv, mgr
+}
+
+func TestFakeServer(t *testing.T) {
+	srv, mgr := newFakeManager(t, Prefix("t:"))
+	ctx := context.Background()
+
+	if _, err := mgr.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := mgr.GetString(ctx, "k")
+	if err != nil || v != "v" {
+		t.Fatal(v, err)
+	}
+	if _, err = mgr.HSet(ctx, "h", "f", 1); err != nil {
+		t.Fatal(err)
+	}
+	n, err := redis.Int(mgr.HIncrBy(ctx, "h", "f", 2))
+	if err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if _, err = mgr.Expire(ctx, "k", 10); err != nil {
+		t.Fatal(err)
+	}
+	srv.FastForward(time.Second * 11)
+	if _, err = mgr.GetString(ctx, "k"); err != ErrNilValue {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeServerRetry(t *testing.T) {
+	srv, mgr := newFakeManager(t)
+	ctx := context.Background()
+
+	srv.DropNext("GET", 1)
+	if v, err := mgr.Get(ctx, "k"); err != nil || v != nil {
+		t.Fatal(v, err)
+	}
+	if srv.Calls("GET") != 2 {
+		t.Fatal(srv.Calls("GET"))
+	}
+
+	srv.SetError("GET", "ERR mocked")
+	if _, err := mgr.Get(ctx, "k"); err == nil || err.Error() != "ERR mocked" {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,169 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ScanIterator 基于游标的迭代器，每次取一页时从连接池取连接，取完即归还
+// 迭代期间被修改的元素可能被跳过或重复返回，与 redis SCAN 语义一致
+type ScanIterator struct {
+	ctx   context.Context
+	m     *Manager
+	cmd   string
+	key   string
+	match string
+	count int64
+	// HSCAN/ZSCAN 返回 field/value 交替的列表
+	pair bool
+	// cluster 模式下 SCAN 依次遍历每个 master
+	nodes []*Manager
+	// SCAN 返回的 key 需要去掉的前缀
+	prefix string
+
+	cursor  string
+	started bool
+	page    []string
+	pos     int
+	val     string
+	value   string
+	err     error
+}
+
+// Scan 遍历整个 keyspace，match 为空时不过滤，count 为每页数量的提示值
+// 设置了前缀时只遍历前缀下的 key，返回的 key 不带前缀
+func (m *Manager) Scan(ctx context.Context, match string, count int64) *ScanIterator {
+	if m.opt.prefix != "" {
+		if match == "" {
+			match = "*"
+		}
+		match = globEscape(m.opt.prefix) + match
+	}
+	it := &ScanIterator{ctx: ctx, m: m, cmd: commandScan, match: match, count: count, prefix: m.opt.prefix}
+	if m.cluster != nil {
+		it.nodes, it.err = m.cluster.masters()
+		if len(it.nodes) > 0 {
+			it.m, it.nodes = it.nodes[0], it.nodes[1:]
+		}
+	}
+	return it
+}
+
+// HScan 遍历 hash，Val 为 field，Value 为对应的值
+func (m *Manager) HScan(ctx context.Context, key, match string, count int64) *ScanIterator {
+	return &ScanIterator{ctx: ctx, m: m, cmd: commandHScan, key: m.key(key), match: match, count: count, pair: true}
+}
+
+// SScan 遍历 set 的成员
+func (m *Manager) SScan(ctx context.Context, key, match string, count int64) *ScanIterator {
+	return &ScanIterator{ctx: ctx, m: m, cmd: commandSScan, key: m.key(key), match: match, count: count}
+}
+
+// ZScan 遍历 zset，Val 为 member，Value 为 score
+func (m *Manager) ZScan(ctx context.Context, key, match string, count int64) *ScanIterator {
+	return &ScanIterator{ctx: ctx, m: m, cmd: commandZScan, key: m.key(key), match: match, count: count, pair: true}
+}
+
+// Next 移动到下一个元素，遍历结束或出错时返回 false
+func (it *ScanIterator) Next() bool {
+	for {
+		if it.pos < len(it.page) {
+			it.val = strings.TrimPrefix(it.page[it.pos], it.prefix)
+			it.pos++
+			if it.pair {
+				it.value = ""
+				if it.pos < len(it.page) {
+					it.value = it.page[it.pos]
+					it.pos++
+				}
+			}
+			return true
+		}
+		if it.err != nil {
+			return false
+		}
+		if it.started && it.cursor == "0" {
+			if len(it.nodes) == 0 {
+				return false
+			}
+			it.m, it.nodes = it.nodes[0], it.nodes[1:]
+			it.started, it.cursor = false, ""
+		}
+		it.fetch()
+	}
+}
+
+// Val 当前元素，key/member/field
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+// Value HScan 时为 field 对应的值，ZScan 时为 score
+func (it *ScanIterator) Value() string {
+	return it.value
+}
+
+// Err 迭代过程中的错误
+func (it *ScanIterator) Err() error {
+	return it.err
+}
+
+func (it *ScanIterator) fetch() {
+	cursor := it.cursor
+	if !it.started {
+		cursor = "0"
+	}
+	args := make([]interface{}, 0, 6)
+	if it.key != "" {
+		args = append(args, it.key)
+	}
+	args = append(args, cursor)
+	if it.match != "" {
+		args = append(args, "MATCH", it.match)
+	}
+	if it.count > 0 {
+		args = append(args, "COUNT", it.count)
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(it.cmd, args...)
+	}
+	it.cursor, it.page, it.err = scanReply(it.m.do(it.ctx, action, it.cmd, args...))
+	it.started, it.pos = true, 0
+}
+
+// globEscape 转义 MATCH 中的通配符
+func globEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// scanReply 解析 [cursor, [item, ...]]
+func scanReply(reply interface{}, err error) (string, []string, error) {
+	vals, err := redis.Values(reply, err)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(vals) != 2 {
+		return "", nil, fmt.Errorf("unexpected scan reply: %v", vals)
+	}
+	cursor, err := redis.String(vals[0], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	items, err := redis.Strings(vals[1], nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return cursor, items, nil
+}
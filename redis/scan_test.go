@@ -0,0 +1,79 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestScanReply(t *testing.T) {
+	reply := []interface{}{[]byte("17"), []interface{}{[]byte("a"), []byte("1"), []byte("b"), []byte("2")}}
+	cursor, items, err := scanReply(reply, nil)
+	assert(t, err == nil && cursor == "17" && len(items) == 4)
+
+	it := &ScanIterator{pair: true, page: items, started: true, cursor: "0"}
+	var got string
+	for it.Next() {
+		got += it.Val() + "=" + it.Value() + ";"
+	}
+	assert(t, got == "a=1;b=2;" && it.Err() == nil)
+
+	_, _, err = scanReply([]interface{}{[]byte("0")}, nil)
+	assert(t, err != nil)
+}
+
+func TestHScan(t *testing.T) {
+	_, c := newFakeManager(t)
+	key := "test_hscan"
+	for i := 0; i < 100; i++ {
+		_, err := c.HSet(ctx, key, fmt.Sprint(i), i)
+		assert(t, err == nil)
+	}
+
+	it := c.HScan(ctx, key, "", 10)
+	seen := make(map[string]string)
+	for it.Next() {
+		seen[it.Val()] = it.Value()
+	}
+	assert(t, it.Err() == nil && len(seen) == 100 && seen["42"] == "42")
+
+	it = c.HScan(ctx, key, "9*", 10)
+	seen = make(map[string]string)
+	for it.Next() {
+		seen[it.Val()] = it.Value()
+	}
+	assert(t, it.Err() == nil && len(seen) == 11 && seen["99"] == "99")
+}
+
+func TestScanPrefix(t *testing.T) {
+	// 前缀中的通配符按字面匹配，不会扫到 s1:k0
+	srv, c := newFakeManager(t, Prefix("s[1]:"))
+	raw, err := NewManager([]string{srv.Addr()}, "", SetPoolSize(1))
+	assert(t, err == nil)
+	defer raw.Close()
+	for _, k := range []string{"s1:k0", "other"} {
+		_, err = raw.Set(ctx, k, "v")
+		assert(t, err == nil)
+	}
+	for i := 0; i < 30; i++ {
+		_, err = c.Set(ctx, fmt.Sprint("k", i), i)
+		assert(t, err == nil)
+	}
+
+	scan := func(match string) map[string]bool {
+		it := c.Scan(ctx, match, 5)
+		seen := make(map[string]bool)
+		for it.Next() {
+			seen[it.Val()] = true
+		}
+		assert(t, it.Err() == nil)
+		return seen
+	}
+	seen := scan("")
+	assert(t, len(seen) == 30 && seen["k0"] && seen["k29"])
+	seen = scan("k1*")
+	assert(t, len(seen) == 11 && seen["k1"] && seen["k19"] && !seen["k2"])
+
+	// 返回的 key 去掉前缀后可以直接用于其他命令
+	v, err := c.GetString(ctx, "k7")
+	assert(t, err == nil && v == "7")
+}
@@ -0,0 +1,110 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	scriptsMu sync.Mutex
+	// scripts 按 sha1 去重，重复创建相同内容的脚本不会增加预加载的数量
+	scripts = make(map[string]*Script)
+)
+
+// Script lua 脚本，通过 NewScript 注册，Manager 初始化连接池时会预加载所有已注册的脚本
+type Script struct {
+	name string
+	src  string
+	hash string
+}
+
+// NewScript 创建并注册 lua 脚本，name 用于 statFunc 统计
+// 一般在包级变量中调用，保证在 NewManager 之前完成注册，内容相同的脚本只注册一次
+func NewScript(name, src string) *Script {
+	h := sha1.New()
+	io.WriteString(h, src)
+	s := &Script{
+		name: name,
+		src:  src,
+		hash: hex.EncodeToString(h.Sum(nil)),
+	}
+	scriptsMu.Lock()
+	if _, ok := scripts[s.hash]; !ok {
+		scripts[s.hash] = s
+	}
+	scriptsMu.Unlock()
+	return s
+}
+
+// Name 脚本名
+func (s *Script) Name() string {
+	return s.name
+}
+
+// Hash 脚本的 sha1
+func (s *Script) Hash() string {
+	return s.hash
+}
+
+func (s *Script) args(spec string, keys []string, args []interface{}) []interface{} {
+	ret := make([]interface{}, 0, 2+len(keys)+len(args))
+	ret = append(ret, spec, len(keys))
+	for _, k := range keys {
+		ret = append(ret, k)
+	}
+	return append(ret, args...)
+}
+
+// do 优先使用 EVALSHA，服务端没有缓存该脚本时回退到 EVAL
+func (s *Script) do(conn redis.Conn, keys []string, args []interface{}) (interface{}, error) {
+	reply, err := conn.Do(commandEvalSha, s.args(s.hash, keys, args)...)
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "NOSCRIPT ") {
+		reply, err = conn.Do(commandEval, s.args(s.src, keys, args)...)
+	}
+	return reply, err
+}
+
+// RunScript 执行脚本，耗时以脚本名上报给 statFunc，keys 会加上前缀
+func (m *Manager) RunScript(ctx context.Context, s *Script, keys []string, args ...interface{}) (interface{}, error) {
+	return m.runScript(ctx, s, m.keys(keys), args...)
+}
+
+// runScript keys 已经加上前缀
+func (m *Manager) runScript(ctx context.Context, s *Script, keys []string, args ...interface{}) (interface{}, error) {
+	action := func(conn *Conn) (interface{}, error) {
+		return s.do(conn, keys, args)
+	}
+	if m.cluster != nil {
+		var key string
+		if len(keys) > 0 {
+			key = keys[0]
+		}
+		return m.cluster.do(ctx, key, action, s.name)
+	}
+	return m.do(ctx, action, s.name)
+}
+
+// loadScripts 将已注册的脚本加载到连接所在的 redis
+// 加载失败不影响使用，RunScript 会回退到 EVAL
+func loadScripts(conn redis.Conn) {
+	scriptsMu.Lock()
+	list := make([]*Script, 0, len(scripts))
+	for _, s := range scripts {
+		list = append(list, s)
+	}
+	scriptsMu.Unlock()
+
+	for _, s := range list {
+		conn.Send(commandScript, scriptLoad, s.src)
+	}
+	if len(list) > 0 {
+		conn.Do("")
+	}
+}
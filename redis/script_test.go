@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"testing"
+)
+
+func TestScriptHash(t *testing.T) {
+	s := NewScript("one", "return 1")
+	assert(t, s.Name() == "one")
+	assert(t, s.Hash() == "e0e1f9fabfc9d4800c877a703b823ac0578ff8db")
+
+	args := s.args(s.Hash(), []string{"k1", "k2"}, []interface{}{"a"})
+	assert(t, len(args) == 5)
+	assert(t, args[1] == 2 && args[2] == "k1" && args[4] == "a")
+}
+
+func TestScriptDedup(t *testing.T) {
+	src := "return 'dedup'"
+	a := NewScript("a", src)
+	b := NewScript("b", src)
+	assert(t, a.Hash() == b.Hash())
+	n := 0
+	scriptsMu.Lock()
+	for _, s := range scripts {
+		if s.src == src {
+			n++
+		}
+	}
+	scriptsMu.Unlock()
+	assert(t, n == 1)
+}
+
+func TestRunScript(t *testing.T) {
+	s := NewScript("incr_by", "return redis.call('INCRBY', KEYS[1], ARGV[1])")
+	srv, c := newFakeManager(t, Prefix("t:"))
+
+	// 连接池初始化时已经预加载，直接命中 EVALSHA
+	n, err := Int64(c.RunScript(ctx, s, []string{"script"}, 3))
+	assert(t, err == nil && n == 3)
+	assert(t, srv.Calls(commandEvalSha) == 1 && srv.Calls(commandEval) == 0)
+	v, err := c.GetString(ctx, "script")
+	assert(t, err == nil && v == "3")
+
+	// 服务端丢失脚本缓存后回退到 EVAL
+	p := c.Pipeline(ctx)
+	p.Send(commandScript, "FLUSH")
+	assert(t, p.Exec() == nil)
+	n, err = Int64(c.RunScript(ctx, s, []string{"script"}, 2))
+	assert(t, err == nil && n == 5)
+	assert(t, srv.Calls(commandEvalSha) == 2 && srv.Calls(commandEval) == 1)
+}
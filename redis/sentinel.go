@@ -0,0 +1,300 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dup2X/gopkg/discovery"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	sentinelMinBackoff = time.Millisecond * 100
+	sentinelMaxBackoff = time.Second * 5
+)
+
+// sentinel 通过 sentinel 发现 master，master 切换时重建连接池
+type sentinel struct {
+	m           *Manager
+	addrs       []string
+	name        string
+	connTimeout time.Duration
+
+	mu      sync.RWMutex
+	master  string
+	replMgr *Manager
+
+	done chan struct{}
+	once sync.Once
+}
+
+func newSentinelManager(addrs []string, auth string, opt *option) (*Manager, error) {
+	s := &sentinel{
+		addrs:       addrs,
+		name:        opt.sentinelMaster,
+		connTimeout: opt.connTimeout,
+		done:        make(chan struct{}),
+	}
+	master, err := s.resolveMaster()
+	if err != nil {
+		return nil, err
+	}
+	s.master = master
+	mgr, err := newManager([]string{master}, auth, opt)
+	if err != nil {
+		return mgr, err
+	}
+	s.m = mgr
+	mgr.sentinel = s
+	if opt.readFromReplica {
+		// 没有可用从库时读请求走 master，不影响初始化
+		s.report(sentinelSlaves, s.refreshReplicas())
+	}
+	go s.watch()
+	return mgr, nil
+}
+
+func (s *sentinel) masterAddr() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master
+}
+
+// replica 返回从库的 Manager，没有可用从库时返回 nil
+func (s *sentinel) replica() *Manager {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.replMgr
+}
+
+func (s *sentinel) dial(addr string) (redis.Conn, error) {
+	var opts []redis.DialOption
+	if s.connTimeout > 0 {
+		opts = append(opts, redis.DialConnectTimeout(s.connTimeout))
+	}
+	return redis.Dial("tcp4", addr, opts...)
+}
+
+// query 依次向 sentinel 发送命令，返回第一个成功的结果
+func (s *sentinel) query(args ...interface{}) (reply interface{}, err error) {
+	for _, addr := range s.addrs {
+		var conn redis.Conn
+		conn, err = s.dial(addr)
+		if err != nil {
+			continue
+		}
+		reply, err = conn.Do(commandSentinel, args...)
+		conn.Close()
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *sentinel) resolveMaster() (string, error) {
+	ret, err := redis.Strings(s.query(sentinelGetMaster, s.name))
+	if err != nil {
+		return "", err
+	}
+	if len(ret) != 2 {
+		return "", ErrSentinelNoMaster
+	}
+	return net.JoinHostPort(ret[0], ret[1]), nil
+}
+
+func (s *sentinel) resolveReplicas() ([]string, error) {
+	vals, err := redis.Values(s.query(sentinelSlaves, s.name))
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, v := range vals {
+		info, err := redis.StringMap(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		flags := info["flags"]
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") ||
+			strings.Contains(flags, "disconnected") {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(info["ip"], info["port"]))
+	}
+	return addrs, nil
+}
+
+// refreshReplicas 从库列表变化时重建从库的连接池，旧的连接池在正在执行的读请求结束后关闭
+// 返回 sentinel 查询或新从库建连的错误，此时读请求走 master
+func (s *sentinel) refreshReplicas() error {
+	var replMgr *Manager
+	addrs, err := s.resolveReplicas()
+	if cur := s.replica(); err == nil && cur != nil && sameAddrs(cur.servers, addrs) {
+		return nil
+	}
+	if err == nil && len(addrs) > 0 {
+		opt := *s.m.opt
+		opt.sentinelMaster = ""
+		opt.readFromReplica = false
+		opt.keepSilent = true
+		replMgr, err = newManager(addrs, s.m.auth, &opt)
+		if err == nil && replMgr.Connected == 0 {
+			err = ErrSentinelNoReplica
+		}
+		if err != nil {
+			replMgr.Close()
+			replMgr = nil
+		}
+	}
+	s.mu.Lock()
+	old := s.replMgr
+	s.replMgr = replMgr
+	s.mu.Unlock()
+	if old != nil {
+		old.retire()
+	}
+	return err
+}
+
+func sameAddrs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	seen := make(map[string]bool, len(a))
+	for _, addr := range a {
+		seen[addr] = true
+	}
+	for _, addr := range b {
+		if !seen[addr] {
+			return false
+		}
+	}
+	return true
+}
+
+// switchMaster master 变化时替换地址，关闭旧 master 的空闲连接并重建连接池
+// 正在使用中的旧连接在归还时关闭，新 master 建连失败时请求会按需新建连接
+func (s *sentinel) switchMaster(addr string) error {
+	s.mu.Lock()
+	if addr == s.master {
+		s.mu.Unlock()
+		return nil
+	}
+	s.master = addr
+	s.mu.Unlock()
+
+	b, _ := discovery.NewBalancer(discovery.LOCALTYPE, "", []string{addr})
+	s.m.setBalancer(b)
+	s.m.drainPool()
+	_, err := s.m.fillPool()
+	if s.m.opt.readFromReplica {
+		if e := s.refreshReplicas(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// report 后台的 master 切换和从库刷新没有调用方接收错误，通过 statFunc 上报
+func (s *sentinel) report(op string, err error) {
+	if err != nil && s.m.opt.statFunc != nil {
+		s.m.opt.statFunc(context.Background(), commandSentinel+" "+op+" "+s.name, 0, err)
+	}
+}
+
+// watch 订阅 +switch-master 和从库的上下线事件，连接断开后退避重连
+func (s *sentinel) watch() {
+	backoff := sentinelMinBackoff
+	for {
+		if s.subscribe() {
+			backoff = sentinelMinBackoff
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > sentinelMaxBackoff {
+			backoff = sentinelMaxBackoff
+		}
+	}
+}
+
+// subscribe 阻塞直到订阅连接断开，成功订阅过返回 true
+func (s *sentinel) subscribe() (subscribed bool) {
+	var (
+		conn redis.Conn
+		err  error
+	)
+	for _, addr := range s.addrs {
+		if conn, err = s.dial(addr); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return false
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-s.done:
+		case <-stop:
+		}
+		conn.Close()
+	}()
+
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(channelSwitchMaster, channelSlave, channelSdown, channelSdownCleared); err != nil {
+		return false
+	}
+	// 断线期间可能错过切换消息
+	if master, err := s.resolveMaster(); err == nil {
+		s.report(sentinelGetMaster, s.switchMaster(master))
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Subscription:
+			subscribed = true
+		case redis.Message:
+			s.handle(v.Channel, string(v.Data))
+		case error:
+			return
+		}
+	}
+}
+
+// handle 处理 sentinel 推送的事件
+func (s *sentinel) handle(channel, data string) {
+	fields := strings.Fields(data)
+	switch channel {
+	case channelSwitchMaster:
+		// <master name> <old ip> <old port> <new ip> <new port>
+		if len(fields) == 5 && fields[0] == s.name {
+			s.report(channelSwitchMaster, s.switchMaster(net.JoinHostPort(fields[3], fields[4])))
+		}
+	case channelSlave, channelSdown, channelSdownCleared:
+		// slave <name> <ip> <port> @ <master name> <master ip> <master port>
+		if s.m.opt.readFromReplica && len(fields) == 8 && fields[0] == "slave" && fields[5] == s.name {
+			s.report(channel, s.refreshReplicas())
+		}
+	}
+}
+
+func (s *sentinel) close() {
+	s.once.Do(func() {
+		close(s.done)
+	})
+	s.mu.Lock()
+	old := s.replMgr
+	s.replMgr = nil
+	s.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/dup2X/gopkg/redis/redistest"
+)
+
+func newFakeServer(t *testing.T) *redistest.Server {
+	srv, err := redistest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// publishUntil 订阅建立之前发布的事件会丢失，重复发布直到 cond 成立
+func publishUntil(t *testing.T, srv *redistest.Server, channel, msg string, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s %q", channel, msg)
+		}
+		srv.Publish(channel, msg)
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func replicaEvent(replica, master string) string {
+	host, port, _ := net.SplitHostPort(replica)
+	mhost, mport, _ := net.SplitHostPort(master)
+	return fmt.Sprintf("slave %s %s %s @ mymaster %s %s", replica, host, port, mhost, mport)
+}
+
+func TestSentinelSwitchMaster(t *testing.T) {
+	sen, m1, m2 := newFakeServer(t), newFakeServer(t), newFakeServer(t)
+	sen.SetSentinel("mymaster", m1.Addr())
+	mgr, err := NewManager([]string{sen.Addr()}, "", EnableSentinel("mymaster"), SetPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	ctx := context.Background()
+
+	_, err = mgr.Set(ctx, "k", "1")
+	assert(t, err == nil && m1.Calls(commandSet) == 1)
+
+	sen.SetSentinel("mymaster", m2.Addr())
+	h1, p1, _ := net.SplitHostPort(m1.Addr())
+	h2, p2, _ := net.SplitHostPort(m2.Addr())
+	msg := fmt.Sprintf("mymaster %s %s %s %s", h1, p1, h2, p2)
+	publishUntil(t, sen, channelSwitchMaster, msg, func() bool {
+		return mgr.sentinel.masterAddr() == m2.Addr()
+	})
+	_, err = mgr.Set(ctx, "k", "2")
+	assert(t, err == nil && m2.Calls(commandSet) == 1)
+}
+
+func TestSentinelReplicaEvents(t *testing.T) {
+	sen, master, r1, r2 := newFakeServer(t), newFakeServer(t), newFakeServer(t), newFakeServer(t)
+	sen.SetSentinel("mymaster", master.Addr(), r1.Addr())
+	mgr, err := NewManager([]string{sen.Addr()}, "",
+		EnableSentinel("mymaster"), SetReadFromReplica(true), SetPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	ctx := context.Background()
+
+	replicas := func(addrs ...string) func() bool {
+		return func() bool {
+			repl := mgr.sentinel.replica()
+			return repl != nil && sameAddrs(repl.servers, addrs)
+		}
+	}
+	assert(t, replicas(r1.Addr())())
+
+	// 新增从库
+	sen.SetSentinel("mymaster", master.Addr(), r1.Addr(), r2.Addr())
+	publishUntil(t, sen, channelSlave, replicaEvent(r2.Addr(), master.Addr()), replicas(r1.Addr(), r2.Addr()))
+
+	// 从库下线后不再接收读请求
+	sen.SetSentinel("mymaster", master.Addr(), r2.Addr())
+	publishUntil(t, sen, channelSdown, replicaEvent(r1.Addr(), master.Addr()), replicas(r2.Addr()))
+	for i := 0; i < 4; i++ {
+		_, err = mgr.Get(ctx, "k")
+		assert(t, err == nil)
+	}
+	assert(t, r2.Calls(commandGet) == 4 && r1.Calls(commandGet) == 0)
+	assert(t, master.Calls(commandGet) == 0)
+
+	// 恢复
+	sen.SetSentinel("mymaster", master.Addr(), r1.Addr(), r2.Addr())
+	publishUntil(t, sen, channelSdownCleared, replicaEvent(r1.Addr(), master.Addr()), replicas(r1.Addr(), r2.Addr()))
+}
+
+func TestSentinelMasterDown(t *testing.T) {
+	sen := newFakeServer(t)
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+	sen.SetSentinel("mymaster", dead)
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		_, err := NewManager([]string{sen.Addr()}, "", EnableSentinel("mymaster"), SetPoolSize(1))
+		assert(t, err != nil)
+	}
+	// 构造失败时不会启动订阅协程
+	time.Sleep(50 * time.Millisecond)
+	assert(t, runtime.NumGoroutine() < before+10)
+	assert(t, sen.Calls("SUBSCRIBE") == 0)
+}
+
+func TestSentinelReplicaRetire(t *testing.T) {
+	sen, master, r1, r2 := newFakeServer(t), newFakeServer(t), newFakeServer(t), newFakeServer(t)
+	sen.SetSentinel("mymaster", master.Addr(), r1.Addr())
+	mgr, err := NewManager([]string{sen.Addr()}, "",
+		EnableSentinel("mymaster"), SetReadFromReplica(true), SetPoolSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+
+	// 旧从库上的读请求还没结束，替换之后连接池仍然可用，请求结束后关闭
+	old := mgr.sentinel.replica()
+	conn, err := old.getConn()
+	assert(t, err == nil)
+	old.enter()
+	sen.SetSentinel("mymaster", master.Addr(), r2.Addr())
+	assert(t, mgr.sentinel.refreshReplicas() == nil)
+	assert(t, mgr.sentinel.replica() != old && !old.pool.closed())
+	old.putConn(conn)
+	old.leave()
+	assert(t, old.pool.closed())
+	assert(t, old.Stats().ActiveConns == 0)
+}
+
+func TestSentinelReplicaError(t *testing.T) {
+	sen, master := newFakeServer(t), newFakeServer(t)
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+	sen.SetSentinel("mymaster", master.Addr(), dead)
+
+	var reported error
+	stat := func(ctx context.Context, cmd string, cost time.Duration, err error) error {
+		if cmd == commandSentinel+" "+sentinelSlaves+" mymaster" {
+			reported = err
+		}
+		return nil
+	}
+	mgr, err := NewManager([]string{sen.Addr()}, "", EnableSentinel("mymaster"),
+		SetReadFromReplica(true), SetPoolSize(1), SetStatFunc(stat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mgr.Close()
+	// 从库不可用时读请求走 master
+	assert(t, reported == ErrSentinelNoReplica && mgr.sentinel.replica() == nil)
+	_, err = mgr.Get(context.Background(), "k")
+	assert(t, err == nil && master.Calls(commandGet) == 1)
+}
@@ -0,0 +1,361 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// StreamPayloadField StreamConsumer 默认从该字段读取消息内容
+	StreamPayloadField = "payload"
+
+	defaultStreamCount     = 16
+	defaultStreamBlock     = time.Second * 2
+	defaultStreamClaimIdle = time.Minute
+	streamRetryInterval    = time.Second
+)
+
+// XMessage stream 中的一条消息
+type XMessage struct {
+	ID     string
+	Values map[string]string
+}
+
+// XPendingEntry XPENDING 返回的一条待确认记录
+type XPendingEntry struct {
+	ID         string
+	Consumer   string
+	Idle       time.Duration
+	Deliveries int64
+}
+
+// XAdd 追加消息，id 由 redis 生成
+func (m *Manager) XAdd(ctx context.Context, stream string, values map[string]interface{}) (string, error) {
+	stream = m.key(stream)
+	args := make([]interface{}, 0, 2+len(values)*2)
+	args = append(args, stream, "*")
+	for k, v := range values {
+		args = append(args, k, v)
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandXAdd, args...)
+	}
+	return redis.String(m.do(ctx, action, commandXAdd, args...))
+}
+
+// XGroupCreate 创建消费组，stream 不存在时自动创建，start 为 "$" 时只消费新消息
+func (m *Manager) XGroupCreate(ctx context.Context, stream, group, start string) error {
+	stream = m.key(stream)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandXGroup, xgroupCreate, stream, group, start, "MKSTREAM")
+	}
+	_, err := m.do(ctx, action, commandXGroup, stream, xgroupCreate, group, start)
+	return err
+}
+
+// XReadGroup 以消费组的方式读取未投递过的消息，block 为 0 时不阻塞
+// 阻塞超时没有消息时返回空
+func (m *Manager) XReadGroup(ctx context.Context, group, consumer, stream string, count int64, block time.Duration) ([]XMessage, error) {
+	stream = m.key(stream)
+	args := []interface{}{"GROUP", group, consumer, "COUNT", count}
+	if block > 0 {
+		args = append(args, "BLOCK", int64(block/time.Millisecond))
+	}
+	args = append(args, xreadStreams, stream, ">")
+	action := func(conn *Conn) (interface{}, error) {
+		if block > 0 && m.opt.readTimeout > 0 {
+			return redis.DoWithTimeout(conn.Conn, m.opt.readTimeout+block, commandXReadGroup, args...)
+		}
+		return conn.Do(commandXReadGroup, args...)
+	}
+	reply, err := m.do(ctx, action, commandXReadGroup, stream, group, consumer)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	streams, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []XMessage
+	for _, s := range streams {
+		entry, err := redis.Values(s, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			continue
+		}
+		ret, err := xmessages(entry[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, ret...)
+	}
+	return msgs, nil
+}
+
+// XAck 确认消息
+func (m *Manager) XAck(ctx context.Context, stream, group string, ids ...string) (int64, error) {
+	stream = m.key(stream)
+	args := make([]interface{}, 0, 2+len(ids))
+	args = append(args, stream, group)
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandXAck, args...)
+	}
+	return redis.Int64(m.do(ctx, action, commandXAck, args...))
+}
+
+// XPending 返回消费组中最早的 count 条待确认记录
+func (m *Manager) XPending(ctx context.Context, stream, group string, count int64) ([]XPendingEntry, error) {
+	stream = m.key(stream)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandXPending, stream, group, "-", "+", count)
+	}
+	vals, err := redis.Values(m.do(ctx, action, commandXPending, stream, group, "-", "+", count))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]XPendingEntry, 0, len(vals))
+	for _, v := range vals {
+		fields, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		var (
+			e    XPendingEntry
+			idle int64
+		)
+		if _, err = redis.Scan(fields, &e.ID, &e.Consumer, &idle, &e.Deliveries); err != nil {
+			return nil, err
+		}
+		e.Idle = time.Duration(idle) * time.Millisecond
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// XClaim 将空闲超过 minIdle 的待确认消息转移给 consumer
+func (m *Manager) XClaim(ctx context.Context, stream, group, consumer string, minIdle time.Duration, ids ...string) ([]XMessage, error) {
+	stream = m.key(stream)
+	args := make([]interface{}, 0, 4+len(ids))
+	args = append(args, stream, group, consumer, int64(minIdle/time.Millisecond))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandXClaim, args...)
+	}
+	return xmessages(m.do(ctx, action, commandXClaim, args...))
+}
+
+// xmessages 解析 [[id, [field, value, ...]], ...]，已被删除的消息 Values 为 nil
+func xmessages(reply interface{}, err error) ([]XMessage, error) {
+	vals, err := redis.Values(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	msgs := make([]XMessage, 0, len(vals))
+	for _, v := range vals {
+		entry, err := redis.Values(v, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			continue
+		}
+		id, err := redis.String(entry[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		msg := XMessage{ID: id}
+		if entry[1] != nil {
+			if msg.Values, err = redis.StringMap(entry[1], nil); err != nil {
+				return nil, err
+			}
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+// StreamConsumer 基于消费组的 stream 消费者
+// 处理成功的消息会被 ack，失败的消息留在待确认列表，空闲超过 claimIdle 后被重新认领
+// 设置 SetStreamMaxDeliveries 后，投递次数用尽的消息交给死信处理函数，不再重试
+type StreamConsumer struct {
+	m          *Manager
+	stream     string
+	group      string
+	consumer   string
+	handler    func(topic string, payload []byte) error
+	deadLetter func(topic string, msg XMessage) error
+
+	count         int64
+	block         time.Duration
+	claimIdle     time.Duration
+	maxDeliveries int64
+	payloadField  string
+}
+
+// StreamConsumerOption StreamConsumer 的可选参数
+type StreamConsumerOption func(c *StreamConsumer)
+
+// SetStreamCount 每次读取的最大消息数
+func SetStreamCount(count int64) StreamConsumerOption {
+	return func(c *StreamConsumer) {
+		c.count = count
+	}
+}
+
+// SetStreamBlock 没有消息时的阻塞时间
+func SetStreamBlock(block time.Duration) StreamConsumerOption {
+	return func(c *StreamConsumer) {
+		c.block = block
+	}
+}
+
+// SetStreamClaimIdle 待确认消息空闲超过该时间后被重新认领
+func SetStreamClaimIdle(idle time.Duration) StreamConsumerOption {
+	return func(c *StreamConsumer) {
+		c.claimIdle = idle
+	}
+}
+
+// SetStreamMaxDeliveries 消息投递 n 次仍未确认时不再交给 handler，0 表示不限制(默认)
+func SetStreamMaxDeliveries(n int64) StreamConsumerOption {
+	return func(c *StreamConsumer) {
+		c.maxDeliveries = n
+	}
+}
+
+// SetStreamDeadLetter 投递次数用尽的消息交给 fn，返回 nil 后确认，返回错误时下次认领再处理
+// 未设置时这些消息直接确认丢弃
+func SetStreamDeadLetter(fn func(topic string, msg XMessage) error) StreamConsumerOption {
+	return func(c *StreamConsumer) {
+		c.deadLetter = fn
+	}
+}
+
+// SetStreamPayloadField 消息内容所在的字段，默认为 StreamPayloadField
+func SetStreamPayloadField(field string) StreamConsumerOption {
+	return func(c *StreamConsumer) {
+		c.payloadField = field
+	}
+}
+
+// NewStreamConsumer 创建消费者，consumer 在消费组内需要唯一
+func NewStreamConsumer(m *Manager, stream, group, consumer string, opts ...StreamConsumerOption) *StreamConsumer {
+	c := &StreamConsumer{
+		m:            m,
+		stream:       stream,
+		group:        group,
+		consumer:     consumer,
+		count:        defaultStreamCount,
+		block:        defaultStreamBlock,
+		claimIdle:    defaultStreamClaimIdle,
+		payloadField: StreamPayloadField,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	return c
+}
+
+// SetHandler 设置消息处理函数，与 dkafka.SetConsumerHandler 一致，topic 为 stream 名
+func (c *StreamConsumer) SetHandler(proc func(topic string, payload []byte) error) {
+	c.handler = proc
+}
+
+// Serve 阻塞消费直到 ctx 取消
+func (c *StreamConsumer) Serve(ctx context.Context) error {
+	if c.handler == nil {
+		return ErrNilStreamHandler
+	}
+	err := c.m.XGroupCreate(ctx, c.stream, c.group, "0")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+
+	var lastClaim time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if time.Since(lastClaim) >= c.claimIdle {
+			c.reclaim(ctx)
+			lastClaim = time.Now()
+		}
+		msgs, err := c.m.XReadGroup(ctx, c.group, c.consumer, c.stream, c.count, c.block)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(streamRetryInterval):
+			}
+			continue
+		}
+		for _, msg := range msgs {
+			c.handle(ctx, msg)
+		}
+	}
+}
+
+// reclaim 认领其他消费者(或自己)长时间未确认的消息并重新处理
+func (c *StreamConsumer) reclaim(ctx context.Context) {
+	pending, err := c.m.XPending(ctx, c.stream, c.group, c.count)
+	if err != nil {
+		return
+	}
+	var ids, dead []string
+	for _, p := range pending {
+		switch {
+		case p.Idle < c.claimIdle:
+		case c.maxDeliveries > 0 && p.Deliveries >= c.maxDeliveries:
+			dead = append(dead, p.ID)
+		default:
+			ids = append(ids, p.ID)
+		}
+	}
+	if len(ids) > 0 {
+		if msgs, err := c.m.XClaim(ctx, c.stream, c.group, c.consumer, c.claimIdle, ids...); err == nil {
+			for _, msg := range msgs {
+				c.handle(ctx, msg)
+			}
+		}
+	}
+	if len(dead) > 0 {
+		// 认领后再处理，避免与其他消费者重复处理死信
+		if msgs, err := c.m.XClaim(ctx, c.stream, c.group, c.consumer, c.claimIdle, dead...); err == nil {
+			for _, msg := range msgs {
+				c.handleDead(ctx, msg)
+			}
+		}
+	}
+}
+
+func (c *StreamConsumer) handleDead(ctx context.Context, msg XMessage) {
+	if msg.Values != nil && c.deadLetter != nil {
+		if err := c.deadLetter(c.stream, msg); err != nil {
+			return
+		}
+	}
+	c.m.XAck(ctx, c.stream, c.group, msg.ID)
+}
+
+func (c *StreamConsumer) handle(ctx context.Context, msg XMessage) {
+	// 已被 XDEL 删除的消息直接确认
+	if msg.Values != nil {
+		if err := c.handler(c.stream, []byte(msg.Values[c.payloadField])); err != nil {
+			return
+		}
+	}
+	c.m.XAck(ctx, c.stream, c.group, msg.ID)
+}
@@ -0,0 +1,94 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestXMessages(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{[]byte("1-0"), []interface{}{[]byte("payload"), []byte("hello")}},
+		[]interface{}{[]byte("2-0"), nil},
+	}
+	msgs, err := xmessages(reply, nil)
+	assert(t, err == nil && len(msgs) == 2)
+	assert(t, msgs[0].ID == "1-0" && msgs[0].Values[StreamPayloadField] == "hello")
+	assert(t, msgs[1].ID == "2-0" && msgs[1].Values == nil)
+}
+
+func TestStreamConsumerServe(t *testing.T) {
+	srv, mgr := newFakeManager(t, Prefix("t:"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		handled = make(map[string]int)
+		dead    []string
+	)
+	c := NewStreamConsumer(mgr, "s", "g", "c1",
+		SetStreamPayloadField("body"),
+		SetStreamBlock(10*time.Millisecond),
+		SetStreamClaimIdle(30*time.Millisecond),
+		SetStreamMaxDeliveries(3),
+		SetStreamDeadLetter(func(topic string, msg XMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			dead = append(dead, topic+":"+msg.Values["body"])
+			return nil
+		}))
+	c.SetHandler(func(topic string, payload []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled[string(payload)]++
+		switch {
+		case string(payload) == "poison":
+			return errors.New("poison")
+		case string(payload) == "flaky" && handled["flaky"] == 1:
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	for _, body := range []string{"ok", "flaky", "poison"} {
+		_, err := mgr.XAdd(ctx, "s", map[string]interface{}{"body": body})
+		assert(t, err == nil)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- c.Serve(ctx) }()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		mu.Lock()
+		done := len(dead) > 0
+		mu.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("poison message not dead-lettered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	assert(t, <-errc == context.Canceled)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert(t, handled["ok"] == 1 && handled["flaky"] == 2)
+	// 第一次读取加两次认领，之后交给死信
+	assert(t, handled["poison"] == 3)
+	assert(t, len(dead) == 1 && dead[0] == "s:poison")
+
+	pending, err := mgr.XPending(context.Background(), "s", "g", 10)
+	assert(t, err == nil && len(pending) == 0)
+	assert(t, srv.Calls(commandXClaim) >= 3 && srv.Calls(commandXAck) == 3)
+}
+
+func TestStreamConsumerNoHandler(t *testing.T) {
+	c := NewStreamConsumer(nil, "s", "g", "c1")
+	assert(t, c.count == defaultStreamCount && c.payloadField == StreamPayloadField)
+	assert(t, c.Serve(context.Background()) == ErrNilStreamHandler)
+}
@@ -0,0 +1,199 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const structTag = "redis"
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// HSetStruct 将结构体按 redis tag 写入 hash，没有 tag 时使用字段名，tag 为 "-" 时忽略
+// tag 带 omitempty 时零值字段不写入
+func (m *Manager) HSetStruct(ctx context.Context, key string, v interface{}) (interface{}, error) {
+	key = m.key(key)
+	args, err := structArgs(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	args = append([]interface{}{key}, args...)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandHMSet, args...)
+	}
+	return m.do(ctx, action, commandHMSet, args...)
+}
+
+// HGetStruct 读取 hash 并按 redis tag 填充结构体，hash 不存在时返回 missedKeyErr
+func (m *Manager) HGetStruct(ctx context.Context, key string, v interface{}) error {
+	key = m.key(key)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandHGetAll, key)
+	}
+	ret, err := redis.StringMap(m.do(ctx, action, commandHGetAll, key))
+	if err != nil {
+		return err
+	}
+	if len(ret) == 0 {
+		return &missedKeyErr{redis.ErrNil}
+	}
+	return decodeStruct(v, ret)
+}
+
+// structField 返回字段在 hash 中的名字，忽略的字段返回空
+func structField(f reflect.StructField) (name string, omitempty bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	tag := f.Tag.Get(structTag)
+	if tag == "-" {
+		return "", false
+	}
+	lst := strings.Split(tag, ",")
+	name = lst[0]
+	if name == "" {
+		name = f.Name
+	}
+	for _, o := range lst[1:] {
+		if o == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
+
+func structArgs(v interface{}) ([]interface{}, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("redis: HSetStruct expects a struct, got %T", v)
+	}
+	rt := rv.Type()
+	args := make([]interface{}, 0, rt.NumField()*2)
+	for i := 0; i < rt.NumField(); i++ {
+		name, omitempty := structField(rt.Field(i))
+		if name == "" {
+			continue
+		}
+		fv := rv.Field(i)
+		if omitempty && isZero(fv) {
+			continue
+		}
+		val, err := encodeField(fv)
+		if err != nil {
+			return nil, fmt.Errorf("redis: field %s: %v", rt.Field(i).Name, err)
+		}
+		args = append(args, name, val)
+	}
+	return args, nil
+}
+
+func isZero(v reflect.Value) bool {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).IsZero()
+	}
+	return v.IsZero()
+}
+
+func encodeField(v reflect.Value) (interface{}, error) {
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339Nano), nil
+	}
+	if v.Type() == bytesType {
+		return v.Bytes(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Bool:
+		return v.Bool(), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", v.Type())
+}
+
+func decodeStruct(v interface{}, hash map[string]string) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("redis: HGetStruct expects a non-nil struct pointer, got %T", v)
+	}
+	rv = rv.Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name, _ := structField(rt.Field(i))
+		if name == "" {
+			continue
+		}
+		s, ok := hash[name]
+		if !ok {
+			continue
+		}
+		if err := decodeField(rv.Field(i), s); err != nil {
+			return fmt.Errorf("redis: field %s: %v", rt.Field(i).Name, err)
+		}
+	}
+	return nil
+}
+
+func decodeField(v reflect.Value, s string) error {
+	if v.Type() == timeType {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.Type() == bytesType {
+		v.SetBytes([]byte(s))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
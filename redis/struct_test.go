@@ -0,0 +1,82 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type structUser struct {
+	ID       int64     `redis:"id"`
+	Name     string    `redis:"name"`
+	Score    float64   `redis:"score"`
+	Vip      bool      `redis:"vip"`
+	Age      uint8     `redis:"age,omitempty"`
+	Raw      []byte    `redis:"raw"`
+	Birthday time.Time `redis:"birthday"`
+	Ignored  string    `redis:"-"`
+	Nick     string
+	private  string
+}
+
+func TestStructCodec(t *testing.T) {
+	u := structUser{ID: 7, Name: "tom", Score: 1.5, Vip: true, Raw: []byte("x"),
+		Birthday: time.Date(2000, 1, 2, 3, 4, 5, 6, time.UTC), Ignored: "i", Nick: "t", private: "p"}
+	args, err := structArgs(&u)
+	assert(t, err == nil)
+	// age 为零值被 omitempty 忽略
+	assert(t, len(args) == 14)
+
+	hash := make(map[string]string)
+	for i := 0; i < len(args); i += 2 {
+		if b, ok := args[i+1].([]byte); ok {
+			hash[args[i].(string)] = string(b)
+			continue
+		}
+		if b, ok := args[i+1].(bool); ok && b {
+			hash[args[i].(string)] = "1"
+			continue
+		}
+		hash[args[i].(string)] = fmt.Sprint(args[i+1])
+	}
+	var got structUser
+	assert(t, decodeStruct(&got, hash) == nil)
+	assert(t, got.ID == 7 && got.Name == "tom" && got.Score == 1.5 && got.Vip && got.Nick == "t")
+	assert(t, string(got.Raw) == "x" && got.Birthday.Equal(u.Birthday))
+	assert(t, got.Ignored == "" && got.private == "")
+
+	assert(t, decodeStruct(got, hash) != nil)
+	assert(t, decodeStruct(&got, map[string]string{"id": "x"}) != nil)
+	_, err = structArgs(1)
+	assert(t, err != nil)
+}
+
+func TestHGetStruct(t *testing.T) {
+	_, c := newFakeManager(t)
+	key := "test_hstruct"
+
+	// hash 不存在时返回 MissedKey，不修改 v
+	got := structUser{Name: "keep"}
+	err := c.HGetStruct(ctx, key, &got)
+	e, ok := err.(Error)
+	assert(t, ok && e.MissedKey())
+	assert(t, got.Name == "keep" && got.ID == 0)
+
+	u := structUser{ID: 1, Name: "a", Vip: true, Birthday: time.Now()}
+	_, err = c.HSetStruct(ctx, key, u)
+	assert(t, err == nil)
+	assert(t, c.HGetStruct(ctx, key, &got) == nil)
+	assert(t, got.ID == 1 && got.Name == "a" && got.Vip && got.Birthday.Equal(u.Birthday))
+
+	_, err = c.Del(ctx, key)
+	assert(t, err == nil)
+	e, ok = c.HGetStruct(ctx, key, &got).(Error)
+	assert(t, ok && e.MissedKey())
+
+	// 类型不对不是 MissedKey
+	_, err = c.Set(ctx, key, "v")
+	assert(t, err == nil)
+	err = c.HGetStruct(ctx, key, &got)
+	e, ok = err.(Error)
+	assert(t, err != nil && !(ok && e.MissedKey()))
+}
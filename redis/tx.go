@@ -0,0 +1,138 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+
+	dctx "github.com/dup2X/gopkg/context"
+	"github.com/dup2X/gopkg/elapsed"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const defaultTxRetryTimes = 3
+
+// Tx 基于 WATCH 的乐观锁事务
+// Do 在 WATCH 之后立即执行(用于读取)，Send/Set/HSet 等命令在 EXEC 时放入 MULTI 中原子执行
+type Tx struct {
+	cmdQueue
+	conn *Conn
+}
+
+// Do 在事务所占用的连接上立即执行命令，key 需要通过 Key 加上前缀
+func (tx *Tx) Do(cmd string, args ...interface{}) (interface{}, error) {
+	return tx.conn.Do(cmd, args...)
+}
+
+// Tx 占用一个连接，WATCH watchKeys 后调用 fn，再将 fn 中入队的命令放入 MULTI/EXEC 执行
+// watchKeys 被其他客户端修改导致 EXEC 返回 nil 时重新执行 fn，最多重试 SetTxMaxRetry 次，默认 3 次
+// fn 返回错误时放弃事务并返回该错误
+// cluster 模式下事务在 watchKeys[0] 所在节点执行，所有 key 需要在同一个 slot(可使用 {hash_tag})
+func (m *Manager) Tx(ctx context.Context, watchKeys []string, fn func(tx *Tx) error) error {
+	return m.tx(ctx, m.opt.prefix, m.keys(watchKeys), fn)
+}
+
+// tx watchKeys 已经加上前缀，cluster 模式下由节点的 Manager 执行
+func (m *Manager) tx(ctx context.Context, prefix string, watchKeys []string, fn func(tx *Tx) error) error {
+	if m.cluster != nil {
+		if len(watchKeys) == 0 {
+			return ErrClusterNoKey
+		}
+		node, err := m.cluster.nodeBySlot(keySlot(watchKeys[0]))
+		if err != nil {
+			return err
+		}
+		return node.tx(ctx, prefix, watchKeys, fn)
+	}
+	if m.opt.slaFuse && !dctx.CheckSLA(ctx) {
+		return ErrSLATimeout
+	}
+	et := elapsed.New()
+	et.Start()
+	err := m.runTx(prefix, watchKeys, fn)
+
+	args := make([]interface{}, len(watchKeys))
+	for i, k := range watchKeys {
+		args[i] = k
+	}
+	m.stat(ctx, et.Stop(), err, commandExec, args...)
+	return err
+}
+
+func (m *Manager) runTx(prefix string, watchKeys []string, fn func(tx *Tx) error) error {
+	m.enter()
+	defer m.leave()
+	conn, err := m.acquireConn()
+	if err != nil {
+		return err
+	}
+	tx := &Tx{cmdQueue: cmdQueue{prefix: prefix}, conn: conn}
+	for i := int64(0); i <= m.opt.txMaxRetry; i++ {
+		var ok bool
+		ok, err = tx.run(watchKeys, fn)
+		if err != nil || ok {
+			break
+		}
+		err = ErrTxAborted
+	}
+	if conn.Err() != nil {
+		m.voteUnhealthy(conn.addr)
+		m.discardConn(conn)
+		return err
+	}
+	m.putConn(conn)
+	return err
+}
+
+// run 执行一次 WATCH/MULTI/EXEC，watch 的 key 被修改时返回 false
+func (tx *Tx) run(watchKeys []string, fn func(tx *Tx) error) (bool, error) {
+	tx.cmds = nil
+	if len(watchKeys) > 0 {
+		args := make([]interface{}, len(watchKeys))
+		for i, k := range watchKeys {
+			args[i] = k
+		}
+		if _, err := tx.conn.Do(commandWatch, args...); err != nil {
+			return false, err
+		}
+	}
+	if err := fn(tx); err != nil {
+		tx.conn.Do(commandUnwatch)
+		return false, err
+	}
+	if len(tx.cmds) == 0 {
+		_, err := tx.conn.Do(commandUnwatch)
+		return err == nil, err
+	}
+
+	if err := tx.conn.Send(commandMulti); err != nil {
+		return false, err
+	}
+	for _, c := range tx.cmds {
+		if err := tx.conn.Send(c.name, c.args...); err != nil {
+			return false, err
+		}
+	}
+	reply, err := tx.conn.Do(commandExec)
+	if err != nil {
+		return false, err
+	}
+	if reply == nil {
+		return false, nil
+	}
+	vals, err := redis.Values(reply, nil)
+	if err != nil {
+		return false, err
+	}
+	for i, c := range tx.cmds {
+		if i >= len(vals) {
+			break
+		}
+		if e, ok := vals[i].(redis.Error); ok {
+			c.reply.val, c.reply.err = nil, e
+			continue
+		}
+		c.reply.val, c.reply.err = vals[i], nil
+	}
+	return true, nil
+}
@@ -0,0 +1,70 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// conflictTx 在前 conflicts 次执行 fn 时通过另一个连接修改 watch 的 key，使 EXEC 返回 nil
+func conflictTx(mgr *Manager, conflicts int, runs *int) func(tx *Tx) error {
+	ctx := context.Background()
+	return func(tx *Tx) error {
+		*runs++
+		n, err := redis.Int(tx.Do(commandGet, tx.Key("n")))
+		if err != nil && err != redis.ErrNil {
+			return err
+		}
+		if *runs <= conflicts {
+			if _, err = mgr.Incr(ctx, "n"); err != nil {
+				return err
+			}
+		}
+		tx.Set("n", n+10)
+		return nil
+	}
+}
+
+func TestTxRetry(t *testing.T) {
+	srv, mgr := newFakeManager(t, Prefix("t:"))
+	ctx := context.Background()
+
+	var runs int
+	assert(t, mgr.Tx(ctx, []string{"n"}, conflictTx(mgr, 1, &runs)) == nil)
+	assert(t, runs == 2)
+	assert(t, srv.Calls(commandExec) == 2)
+	// 第二次执行读到了冲突写入的值
+	n, err := redis.Int(mgr.Get(ctx, "n"))
+	assert(t, err == nil && n == 11)
+}
+
+func TestTxMaxRetry(t *testing.T) {
+	ctx := context.Background()
+	for _, c := range []struct {
+		retry int64
+		runs  int
+	}{
+		{-1, defaultTxRetryTimes + 1},
+		{0, 1},
+		{2, 3},
+	} {
+		_, mgr := newFakeManager(t, SetTxMaxRetry(c.retry))
+		var runs int
+		err := mgr.Tx(ctx, []string{"n"}, conflictTx(mgr, 100, &runs))
+		assert(t, err == ErrTxAborted)
+		assert(t, runs == c.runs)
+	}
+}
+
+func TestTxFnError(t *testing.T) {
+	srv, mgr := newFakeManager(t)
+	errFn := errors.New("fn failed")
+	err := mgr.Tx(context.Background(), []string{"n"}, func(tx *Tx) error {
+		tx.Set("n", 1)
+		return errFn
+	})
+	assert(t, err == errFn)
+	assert(t, srv.Calls(commandExec) == 0 && srv.Calls(commandUnwatch) == 1)
+}
@@ -0,0 +1,210 @@
+// Package redis defined redis_client
+package redis
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	zsetWithScores = "WITHSCORES"
+	zsetLimit      = "LIMIT"
+	zsetWeights    = "WEIGHTS"
+	zsetAggregate  = "AGGREGATE"
+)
+
+// ZMember 有序集合中的一个成员
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ZStore ZUnionStore/ZInterStore 的可选参数
+type ZStore struct {
+	// Weights 与 keys 一一对应，为空时都为 1
+	Weights []float64
+	// Aggregate SUM、MIN 或 MAX，为空时为 SUM
+	Aggregate string
+}
+
+// ZIncrBy 为 member 的 score 加上 incr，返回新的 score
+func (m *Manager) ZIncrBy(ctx context.Context, key string, incr float64, member interface{}) (float64, error) {
+	key = m.key(key)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandZIncrBy, key, incr, member)
+	}
+	return redis.Float64(m.do(ctx, action, commandZIncrBy, key, incr, member))
+}
+
+// ZScore 返回 member 的 score，member 不存在时返回 missedKeyErr
+func (m *Manager) ZScore(ctx context.Context, key string, member interface{}) (float64, error) {
+	key = m.key(key)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandZScore, key, member)
+	}
+	return zsetNil(redis.Float64(m.do(ctx, action, commandZScore, key, member)))
+}
+
+// ZRank 返回 member 按 score 升序的排名，从 0 开始，member 不存在时返回 missedKeyErr
+func (m *Manager) ZRank(ctx context.Context, key string, member interface{}) (int64, error) {
+	return m.zrank(ctx, commandZRank, key, member)
+}
+
+// ZRevRank 返回 member 按 score 降序的排名，从 0 开始，member 不存在时返回 missedKeyErr
+func (m *Manager) ZRevRank(ctx context.Context, key string, member interface{}) (int64, error) {
+	return m.zrank(ctx, commandZRevRank, key, member)
+}
+
+func (m *Manager) zrank(ctx context.Context, cmd, key string, member interface{}) (int64, error) {
+	key = m.key(key)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(cmd, key, member)
+	}
+	rank, err := redis.Int64(m.do(ctx, action, cmd, key, member))
+	if err == redis.ErrNil {
+		err = &missedKeyErr{err}
+	}
+	return rank, err
+}
+
+// ZRange 按 score 升序返回排名在 [start, stop] 的成员，负数表示倒数
+func (m *Manager) ZRange(ctx context.Context, key string, start, stop int64) ([]ZMember, error) {
+	return m.zrange(ctx, commandZRange, key, start, stop)
+}
+
+// ZRevRange 按 score 降序返回排名在 [start, stop] 的成员，负数表示倒数
+func (m *Manager) ZRevRange(ctx context.Context, key string, start, stop int64) ([]ZMember, error) {
+	return m.zrange(ctx, commandZRevRange, key, start, stop)
+}
+
+func (m *Manager) zrange(ctx context.Context, cmd, key string, start, stop int64) ([]ZMember, error) {
+	key = m.key(key)
+	args := []interface{}{key, start, stop, zsetWithScores}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	}
+	return zmembers(m.do(ctx, action, cmd, args...))
+}
+
+// ZRangeByScoreWithScores 按 score 升序返回 score 在 [min, max] 的成员
+// min/max 支持 "-inf"、"+inf" 和 "(1" 表示的开区间，count <= 0 时不限制返回个数
+func (m *Manager) ZRangeByScoreWithScores(ctx context.Context, key, min, max string, offset, count int64) ([]ZMember, error) {
+	return m.zrangeByScore(ctx, commandZRangeByScore, key, min, max, offset, count)
+}
+
+// ZRevRangeByScoreWithScores 按 score 降序返回 score 在 [min, max] 的成员，参数同 ZRangeByScoreWithScores
+func (m *Manager) ZRevRangeByScoreWithScores(ctx context.Context, key, max, min string, offset, count int64) ([]ZMember, error) {
+	return m.zrangeByScore(ctx, commandZRevRangeByScore, key, max, min, offset, count)
+}
+
+// zrangeByScore ZREVRANGEBYSCORE 的参数顺序为 max min，由调用方保证
+func (m *Manager) zrangeByScore(ctx context.Context, cmd, key, from, to string, offset, count int64) ([]ZMember, error) {
+	key = m.key(key)
+	args := []interface{}{key, from, to, zsetWithScores}
+	if offset > 0 || count > 0 {
+		if count <= 0 {
+			count = -1
+		}
+		args = append(args, zsetLimit, offset, count)
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	}
+	return zmembers(m.do(ctx, action, cmd, args...))
+}
+
+// ZCard 返回成员个数
+func (m *Manager) ZCard(ctx context.Context, key string) (int64, error) {
+	key = m.key(key)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandZCard, key)
+	}
+	return redis.Int64(m.do(ctx, action, commandZCard, key))
+}
+
+// ZCount 返回 score 在 [min, max] 的成员个数，min/max 格式同 ZRangeByScoreWithScores
+func (m *Manager) ZCount(ctx context.Context, key, min, max string) (int64, error) {
+	key = m.key(key)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandZCount, key, min, max)
+	}
+	return redis.Int64(m.do(ctx, action, commandZCount, key, min, max))
+}
+
+// ZRem 删除成员，返回实际删除的个数
+func (m *Manager) ZRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	key = m.key(key)
+	args := append([]interface{}{key}, members...)
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(commandZRem, args...)
+	}
+	return redis.Int64(m.do(ctx, action, commandZRem, args...))
+}
+
+// ZUnionStore 将 keys 的并集写入 dest，返回 dest 的成员个数，store 可以为 nil
+// cluster 模式下 dest 和 keys 需要在同一个 slot
+func (m *Manager) ZUnionStore(ctx context.Context, dest string, keys []string, store *ZStore) (int64, error) {
+	return m.zstore(ctx, commandZUnionStore, dest, keys, store)
+}
+
+// ZInterStore 将 keys 的交集写入 dest，返回 dest 的成员个数，store 可以为 nil
+// cluster 模式下 dest 和 keys 需要在同一个 slot
+func (m *Manager) ZInterStore(ctx context.Context, dest string, keys []string, store *ZStore) (int64, error) {
+	return m.zstore(ctx, commandZInterStore, dest, keys, store)
+}
+
+func (m *Manager) zstore(ctx context.Context, cmd, dest string, keys []string, store *ZStore) (int64, error) {
+	if store != nil && len(store.Weights) > 0 && len(store.Weights) != len(keys) {
+		return 0, fmt.Errorf("redis: %s got %d weights for %d keys", cmd, len(store.Weights), len(keys))
+	}
+	args := make([]interface{}, 0, 2+len(keys)*2+3)
+	args = append(args, m.key(dest), len(keys))
+	for _, k := range m.keys(keys) {
+		args = append(args, k)
+	}
+	if store != nil {
+		if len(store.Weights) > 0 {
+			args = append(args, zsetWeights)
+			for _, w := range store.Weights {
+				args = append(args, w)
+			}
+		}
+		if store.Aggregate != "" {
+			args = append(args, zsetAggregate, store.Aggregate)
+		}
+	}
+	action := func(conn *Conn) (interface{}, error) {
+		return conn.Do(cmd, args...)
+	}
+	return redis.Int64(m.do(ctx, action, cmd, args...))
+}
+
+// zmembers 解析 WITHSCORES 返回的 member score 交替列表
+func zmembers(reply interface{}, err error) ([]ZMember, error) {
+	vals, err := redis.Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(vals)%2 != 0 {
+		return nil, fmt.Errorf("redis: unexpected WITHSCORES reply length %d", len(vals))
+	}
+	ret := make([]ZMember, len(vals)/2)
+	for i := range ret {
+		score, err := strconv.ParseFloat(vals[i*2+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = ZMember{Member: vals[i*2], Score: score}
+	}
+	return ret, nil
+}
+
+func zsetNil(score float64, err error) (float64, error) {
+	if err == redis.ErrNil {
+		err = &missedKeyErr{err}
+	}
+	return score, err
+}
@@ -0,0 +1,131 @@
+package redis
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestZSet(t *testing.T) {
+	_, mgr := newFakeManager(t, Prefix("t:"))
+	ctx := context.Background()
+
+	for i, m := range []string{"a", "b", "c", "d"} {
+		if _, err := mgr.ZAdd(ctx, "z", float64(i+1), m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	score, err := mgr.ZIncrBy(ctx, "z", 10, "a")
+	if err != nil || score != 11 {
+		t.Fatal(score, err)
+	}
+	if score, err = mgr.ZScore(ctx, "z", "b"); err != nil || score != 2 {
+		t.Fatal(score, err)
+	}
+	if _, err = mgr.ZScore(ctx, "z", "x"); err == nil || !err.(Error).MissedKey() {
+		t.Fatal(err)
+	}
+	rank, err := mgr.ZRank(ctx, "z", "a")
+	if err != nil || rank != 3 {
+		t.Fatal(rank, err)
+	}
+	if rank, err = mgr.ZRevRank(ctx, "z", "a"); err != nil || rank != 0 {
+		t.Fatal(rank, err)
+	}
+	if _, err = mgr.ZRank(ctx, "z", "x"); err == nil || !err.(Error).MissedKey() {
+		t.Fatal(err)
+	}
+
+	ret, err := mgr.ZRange(ctx, "z", 0, 1)
+	if err != nil || !reflect.DeepEqual(ret, []ZMember{{"b", 2}, {"c", 3}}) {
+		t.Fatal(ret, err)
+	}
+	ret, err = mgr.ZRevRange(ctx, "z", 0, -1)
+	if err != nil || len(ret) != 4 || ret[0] != (ZMember{"a", 11}) {
+		t.Fatal(ret, err)
+	}
+	ret, err = mgr.ZRangeByScoreWithScores(ctx, "z", "(2", "+inf", 1, 1)
+	if err != nil || !reflect.DeepEqual(ret, []ZMember{{"d", 4}}) {
+		t.Fatal(ret, err)
+	}
+	ret, err = mgr.ZRevRangeByScoreWithScores(ctx, "z", "+inf", "-inf", 2, 0)
+	if err != nil || !reflect.DeepEqual(ret, []ZMember{{"c", 3}, {"b", 2}}) {
+		t.Fatal(ret, err)
+	}
+
+	n, err := mgr.ZCard(ctx, "z")
+	if err != nil || n != 4 {
+		t.Fatal(n, err)
+	}
+	if n, err = mgr.ZCount(ctx, "z", "2", "4"); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if n, err = mgr.ZRem(ctx, "z", "c", "x"); err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+}
+
+func TestZStore(t *testing.T) {
+	_, mgr := newFakeManager(t, Prefix("t:"))
+	ctx := context.Background()
+
+	mgr.ZAdd(ctx, "z1", 1, "a")
+	mgr.ZAdd(ctx, "z1", 2, "b")
+	mgr.ZAdd(ctx, "z2", 3, "b")
+	mgr.ZAdd(ctx, "z2", 4, "c")
+
+	n, err := mgr.ZUnionStore(ctx, "u", []string{"z1", "z2"}, nil)
+	if err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+	if score, _ := mgr.ZScore(ctx, "u", "b"); score != 5 {
+		t.Fatal(score)
+	}
+	n, err = mgr.ZInterStore(ctx, "i", []string{"z1", "z2"}, &ZStore{Weights: []float64{2, 1}, Aggregate: "MAX"})
+	if err != nil || n != 1 {
+		t.Fatal(n, err)
+	}
+	if score, _ := mgr.ZScore(ctx, "i", "b"); score != 4 {
+		t.Fatal(score)
+	}
+	if _, err = mgr.ZInterStore(ctx, "i", []string{"z1", "z2"}, &ZStore{Weights: []float64{1}}); err == nil {
+		t.Fatal("expect weights error")
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	_, mgr := newFakeManager(t)
+	ctx := context.Background()
+	lb := NewLeaderboard(mgr, "lb")
+
+	for i, m := range []string{"a", "b", "c", "d", "e"} {
+		if err := lb.SetScore(ctx, m, float64(i*10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if score, err := lb.Incr(ctx, "a", 100); err != nil || score != 100 {
+		t.Fatal(score, err)
+	}
+	top, err := lb.Top(ctx, 2)
+	if err != nil || !reflect.DeepEqual(top, []ZMember{{"a", 100}, {"e", 40}}) {
+		t.Fatal(top, err)
+	}
+	rank, err := lb.Rank(ctx, "c")
+	if err != nil || rank != 3 {
+		t.Fatal(rank, err)
+	}
+	around, start, err := lb.Around(ctx, "e", 1)
+	if err != nil || start != 0 || len(around) != 3 || around[2].Member != "d" {
+		t.Fatal(around, start, err)
+	}
+	page, err := lb.Page(ctx, 4, 10)
+	if err != nil || len(page) != 1 || page[0].Member != "b" {
+		t.Fatal(page, err)
+	}
+	if n, err := lb.Remove(ctx, "a", "b"); err != nil || n != 2 {
+		t.Fatal(n, err)
+	}
+	if n, err := lb.Size(ctx); err != nil || n != 3 {
+		t.Fatal(n, err)
+	}
+}